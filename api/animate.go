@@ -23,6 +23,9 @@ func renderFrame(spec Spec, i int) {
 
 	aa := (spec.NumPass > 1)
 	s := tracer.NewSampler(spec.ImageFunc(), spec.Width, spec.Height, aa)
+	if spec.PostProcess.Denoise.Radius != 0 {
+		s.EnableFeatures()
+	}
 
 	for i := 0; i < spec.NumPass; i++ {
 		s.Sample(1) // TODO: Sample(N) is broken for high N
@@ -36,6 +39,7 @@ func renderFrame(spec Spec, i int) {
 		fmt.Println(err)
 	}
 	fname := path.Join(dir, fmt.Sprintf("%05d.jpg", i))
-	check(savef(s.Image(), path.Join(dir, "last.jpg"), ""))
-	check(savef(s.Image(), fname, ""))
+	img := toneMap(&spec, postProcess(&spec, s, 1/float64(spec.Width)))
+	check(savef(img, path.Join(dir, "last.jpg"), ""))
+	check(savef(img, fname, ""))
 }
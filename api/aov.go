@@ -0,0 +1,106 @@
+package api
+
+import (
+	"math"
+	"path"
+
+	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/tracer"
+)
+
+// saveAOVs saves the AOVs with given names, rendered by s,
+// each to its own file. E.g. out.depth.png.
+func saveAOVs(s *tracer.Sampler, names []string) error {
+	for _, name := range names {
+		img := s.AOV(name)
+		if !isHDR(*flagO) {
+			img = visualizeAOV(name, img)
+		}
+		if err := save(img, "."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isHDR returns true if fname has the extension of a floating-point image format.
+// AOVs can be stored as-is in such formats.
+func isHDR(fname string) bool {
+	switch path.Ext(fname) {
+	case ".pfm", ".hdr":
+		return true
+	}
+	return false
+}
+
+// visualizeAOV maps the values of an AOV onto the [0..1] range
+// of 8-bit image formats:
+// normal vectors from [-1..1], depth relative to the largest depth,
+// IDs onto distinct colors.
+// Other AOVs (light, albedo) are returned as-is.
+func visualizeAOV(name string, img imagef.Image) imagef.Image {
+	img = img.Copy()
+	switch name {
+	case tracer.AOVNormal:
+		for _, row := range img {
+			for i, c := range row {
+				row[i] = colorf.Color{R: (c.R + 1) / 2, G: (c.G + 1) / 2, B: (c.B + 1) / 2}
+			}
+		}
+	case tracer.AOVDepth:
+		max := 0.
+		for _, row := range img {
+			for _, c := range row {
+				max = math.Max(max, c.R)
+			}
+		}
+		if max == 0 {
+			return img
+		}
+		for _, row := range img {
+			for i, c := range row {
+				row[i] = c.Mul(1 / max)
+			}
+		}
+	case tracer.AOVObject, tracer.AOVMaterial:
+		for _, row := range img {
+			for i, c := range row {
+				row[i] = idColor(int(c.R)) // IDs are not averaged, so they are exact integers
+			}
+		}
+	}
+	return img
+}
+
+// idColor returns a color to represent ID number id.
+// Neighboring IDs get very different colors. ID 0 (nothing) is black.
+func idColor(id int) colorf.Color {
+	if id == 0 {
+		return colorf.Color{}
+	}
+	// golden ratio hue increments give well-separated hues.
+	const phi = 0.618033988749895
+	h := math.Mod(float64(id)*phi, 1)
+	return hueToColor(h)
+}
+
+// hueToColor converts hue h (0..1) to a fully saturated color.
+func hueToColor(h float64) colorf.Color {
+	h6 := h * 6
+	x := 1 - math.Abs(math.Mod(h6, 2)-1)
+	switch int(h6) {
+	case 0:
+		return colorf.Color{R: 1, G: x, B: 0}
+	case 1:
+		return colorf.Color{R: x, G: 1, B: 0}
+	case 2:
+		return colorf.Color{R: 0, G: 1, B: x}
+	case 3:
+		return colorf.Color{R: 0, G: x, B: 1}
+	case 4:
+		return colorf.Color{R: x, G: 0, B: 1}
+	default:
+		return colorf.Color{R: 1, G: 0, B: x}
+	}
+}
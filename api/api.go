@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef"
 	"github.com/barnex/bruteray/imagef/colorf"
 	"github.com/barnex/bruteray/tracer"
 	"github.com/barnex/bruteray/tracer/lights"
@@ -55,6 +56,15 @@ var (
 	PointLight     = lights.PointLight
 	DiskLight      = lights.DiskLight
 	SunLight       = lights.SunLight
+	SpotLight      = lights.SpotLight
+	IESLight       = lights.IESLight
+	MeshLight      = lights.MeshLight
+
+	TransformedLight = lights.Transformed
+	EnvironmentLight = lights.EnvironmentLight
+	Sky              = lights.Sky
+	Daylight         = lights.Daylight
+	LoadImage        = imagef.MustLoad // e.g. for EnvironmentLight
 
 	Matte          = materials.Matte
 	Reflective     = materials.Reflective
@@ -0,0 +1,392 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer"
+	"github.com/barnex/bruteray/tracer/cameras"
+	"github.com/barnex/bruteray/tracer/lights"
+	"github.com/barnex/bruteray/tracer/materials"
+	"github.com/barnex/bruteray/tracer/objects"
+	"github.com/barnex/bruteray/tracer/objects/gltf"
+)
+
+// A GLTF holds the objects, lights and cameras of a glTF scene, see GLTFFile.
+type GLTF struct {
+	Objects []Object
+	Lights  []Light
+	Cameras []tracer.Camera
+}
+
+// GLTFFile reads a glTF 2.0 scene (JSON .gltf with external or embedded buffers, or binary .glb),
+// e.g. exported from Blender. The result is ready to be used in a Spec:
+// 	g := GLTFFile("scene.glb")
+// 	Render(Spec{
+// 		Objects: g.Objects,
+// 		Lights:  g.Lights,
+// 		Camera:  g.Cameras[0],
+// 		...
+// 	})
+//
+// The node hierarchy of the default scene is flattened: each mesh instance becomes an Object,
+// transformed by its node's world transform. Meshes used by several nodes share their triangles.
+//
+// Materials (metallic-roughness) become Microfacet materials, with base color, metallic and roughness
+// factors and textures. Transmission (KHR_materials_transmission) blends in a RoughRefractive material,
+// alpha blending (alpha mode BLEND, using the base color factor) a Transparent one.
+// Emissive surfaces glow, but do not illuminate the scene (see MeshLight for that).
+// Only texture coordinates TEXCOORD_0 are used.
+//
+// Perspective cameras become Projective cameras. Without an aspect ratio,
+// the default image aspect ratio is assumed for converting the vertical field of view to the horizontal one.
+//
+// Lights (KHR_lights_punctual) become PointLight, SpotLight or SunLight.
+// Intensities are converted from photometric units, so that a white matte surface
+// illuminated by 1 lux (perpendicularly) has brightness 1/π. The light range is ignored.
+func GLTFFile(file string) GLTF {
+	doc, err := gltf.ParseFile(file)
+	check(err)
+	g, err := loadGLTF(doc)
+	if err != nil {
+		fatal(fmt.Sprintf("%v: %v", file, err))
+	}
+	return g
+}
+
+// gltfLoader converts a glTF Document to a GLTF.
+type gltfLoader struct {
+	doc       *gltf.Document
+	meshes    map[int]objects.Interface
+	materials map[int]Material
+	images    map[gltfImageKey]texture.Texture
+	out       GLTF
+}
+
+// images are decoded as color (sRGB) or data (linear)
+type gltfImageKey struct {
+	image  int
+	linear bool
+}
+
+// loadGLTF walks the node hierarchy of the document's default scene.
+// Errors are panicked by the loader methods (or the constructors they call), and returned here.
+func loadGLTF(doc *gltf.Document) (g GLTF, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			g = GLTF{}
+			err = asError(e)
+		}
+	}()
+	l := &gltfLoader{
+		doc:       doc,
+		meshes:    make(map[int]objects.Interface),
+		materials: make(map[int]Material),
+		images:    make(map[gltfImageKey]texture.Texture),
+	}
+	for _, n := range doc.SceneNodes() {
+		l.walk(n, geom.UnitTransform(), 0)
+	}
+	return l.out, nil
+}
+
+func (l *gltfLoader) walk(node int, parent *geom.AffineTransform, depth int) {
+	if depth > len(l.doc.Nodes) {
+		panic(fmt.Errorf("node %v: cyclic hierarchy", node))
+	}
+	n := &l.doc.Nodes[node]
+	world := geom.ComposeLR(n.Transform(), parent)
+
+	if n.Mesh != nil {
+		if m := l.mesh(*n.Mesh); m != nil {
+			l.out.Objects = append(l.out.Objects, Object{objects.Transformed(m, world)})
+		}
+	}
+	if n.Camera != nil {
+		if c := l.camera(&l.doc.Cameras[*n.Camera], world); c != nil {
+			l.out.Cameras = append(l.out.Cameras, c)
+		}
+	}
+	if e := n.Extensions.LightsPunctual; e != nil {
+		l.out.Lights = append(l.out.Lights, l.light(&l.doc.Extensions.LightsPunctual.Lights[e.Light], world))
+	}
+	for _, c := range n.Children {
+		l.walk(c, world, depth+1)
+	}
+}
+
+// mesh returns the (cached) mesh with index i, nil if it has no triangles.
+func (l *gltfLoader) mesh(i int) objects.Interface {
+	if m, ok := l.meshes[i]; ok {
+		return m
+	}
+	var prims []objects.Interface
+	for _, p := range l.doc.Meshes[i].Primitives {
+		if p := l.primitive(&p); p != nil {
+			prims = append(prims, p)
+		}
+	}
+	var m objects.Interface
+	switch len(prims) {
+	case 0:
+	case 1:
+		m = prims[0]
+	default:
+		m = objects.Tree(prims...)
+	}
+	l.meshes[i] = m
+	return m
+}
+
+// primitive returns a mesh for a triangle primitive, nil for points and lines.
+func (l *gltfLoader) primitive(p *gltf.Primitive) objects.Interface {
+	pos, ok := p.Attributes["POSITION"]
+	if !ok || !(p.Mode == gltf.Triangles || p.Mode == gltf.TriangleStrip || p.Mode == gltf.TriangleFan) {
+		return nil
+	}
+	vertices, err := l.doc.Vec3s(pos)
+	l.check(err)
+
+	var idx []int
+	if p.Indices != nil {
+		idx, err = l.doc.Indices(*p.Indices)
+		l.check(err)
+	} else {
+		idx = make([]int, len(vertices))
+		for i := range idx {
+			idx[i] = i
+		}
+	}
+	for _, i := range idx {
+		if i < 0 || i >= len(vertices) {
+			l.check(fmt.Errorf("vertex index out of range: %v, have %v", i, len(vertices)))
+		}
+	}
+	faces := gltfTriangles(p.Mode, idx)
+	if len(faces) == 0 {
+		return nil
+	}
+
+	var attr objects.VertexAttributes
+	if n, ok := p.Attributes["NORMAL"]; ok {
+		attr.Normals, err = l.doc.Vec3s(n)
+		l.check(err)
+	}
+	if t, ok := p.Attributes["TEXCOORD_0"]; ok {
+		attr.UV, err = l.doc.Vec2s(t)
+		l.check(err)
+		for i, uv := range attr.UV {
+			attr.UV[i][1] = 1 - uv[1] // glTF's V axis points down the image
+		}
+	}
+	if attr.Normals != nil && len(attr.Normals) != len(vertices) {
+		l.check(fmt.Errorf("have %v vertices but %v normals", len(vertices), len(attr.Normals)))
+	}
+	if attr.UV != nil && len(attr.UV) != len(vertices) {
+		l.check(fmt.Errorf("have %v vertices but %v texture coordinates", len(vertices), len(attr.UV)))
+	}
+
+	return objects.MeshWithAttributes(l.material(p.Material), vertices, faces, attr)
+}
+
+// gltfTriangles returns the vertex indices of each triangle
+// in a list, strip or fan of triangles.
+func gltfTriangles(mode int, idx []int) [][3]int {
+	var t [][3]int
+	switch mode {
+	case gltf.Triangles:
+		for i := 0; i+2 < len(idx); i += 3 {
+			t = append(t, [3]int{idx[i], idx[i+1], idx[i+2]})
+		}
+	case gltf.TriangleStrip:
+		for i := 0; i+2 < len(idx); i++ {
+			if i%2 == 0 {
+				t = append(t, [3]int{idx[i], idx[i+1], idx[i+2]})
+			} else {
+				t = append(t, [3]int{idx[i+1], idx[i], idx[i+2]}) // keep the winding order
+			}
+		}
+	case gltf.TriangleFan:
+		for i := 1; i+1 < len(idx); i++ {
+			t = append(t, [3]int{idx[0], idx[i], idx[i+1]})
+		}
+	}
+	return t
+}
+
+// material returns the (cached) material with index i.
+// Without material (i == nil), the glTF default material is used:
+// a white, rough metal.
+func (l *gltfLoader) material(i *int) Material {
+	key := -1
+	if i != nil {
+		key = *i
+	}
+	if m, ok := l.materials[key]; ok {
+		return m
+	}
+	var m Material
+	if i == nil {
+		m = materials.Microfacet(White, White, White)
+	} else {
+		m = l.convertMaterial(&l.doc.Materials[*i])
+	}
+	l.materials[key] = m
+	return m
+}
+
+func (l *gltfLoader) convertMaterial(m *gltf.Material) Material {
+	pbr := &m.PBRMetallicRoughness
+
+	f := pbr.BaseColorFactor
+	baseColor := C(f[0], f[1], f[2])
+	var color texture.Texture = baseColor
+	if t := pbr.BaseColorTexture; t != nil {
+		color = gltfMul(l.texture(t.Index, false), baseColor)
+	}
+
+	var roughness, metalness texture.Texture = Gray(pbr.RoughnessFactor), Gray(pbr.MetallicFactor)
+	if t := pbr.MetallicRoughnessTexture; t != nil {
+		tex := l.texture(t.Index, true)
+		roughness = gltfChannel(tex, 1, pbr.RoughnessFactor)
+		metalness = gltfChannel(tex, 2, pbr.MetallicFactor)
+	}
+
+	mat := materials.Microfacet(color, roughness, metalness)
+
+	if t := m.Extensions.Transmission.TransmissionFactor; t > 0 {
+		ior := m.Extensions.IOR.IOR
+		mat = materials.Blend(1-t, mat, t, materials.RoughRefractive(1, ior, roughness, color))
+	}
+
+	if alpha := f[3]; m.AlphaMode == "BLEND" && alpha < 1 {
+		mat = materials.Blend(alpha, mat, 1-alpha, materials.Transparent(White, true))
+	}
+	if alpha := f[3]; m.AlphaMode == "MASK" && alpha < m.AlphaCutoff {
+		mat = materials.Transparent(White, true)
+	}
+
+	e := m.EmissiveFactor
+	emission := C(e[0], e[1], e[2]).Mul(m.Extensions.EmissiveStrength.EmissiveStrength)
+	if emission != (Color{}) {
+		var t texture.Texture = emission
+		if et := m.EmissiveTexture; et != nil {
+			t = gltfMul(l.texture(et.Index, false), emission)
+		}
+		mat = materials.Blend(1, mat, 1, materials.Flat(t))
+	}
+	return mat
+}
+
+// texture returns the (cached) image of texture i.
+// linear is true for data (e.g. roughness), false for colors (sRGB).
+func (l *gltfLoader) texture(i int, linear bool) texture.Texture {
+	src := l.doc.Textures[i].Source
+	if src == nil {
+		l.check(fmt.Errorf("texture %v: no source image", i))
+	}
+	key := gltfImageKey{*src, linear}
+	if t, ok := l.images[key]; ok {
+		return t
+	}
+
+	data, err := l.doc.ImageData(*src)
+	l.check(err)
+	colorspace := imagef.Linear
+	if !linear {
+		colorspace = nil // default: sRGB
+	}
+	img, err := imagef.Decode(bytes.NewReader(data), colorspace)
+	if err != nil {
+		l.check(fmt.Errorf("image %v: %v", *src, err))
+	}
+	t := texture.Bilinear(img)
+	l.images[key] = t
+	return t
+}
+
+// gltfMul multiplies a texture by a constant color.
+func gltfMul(t texture.Texture, c Color) texture.Texture {
+	if c == White {
+		return t
+	}
+	return texture.Func(func(p Vec) Color {
+		return t.At(p).Mul3(c)
+	})
+}
+
+// gltfChannel returns a gray texture with color channel c (0, 1, 2 for R, G, B)
+// of texture t, times factor.
+func gltfChannel(t texture.Texture, c int, factor float64) texture.Texture {
+	return texture.Func(func(p Vec) Color {
+		col := t.At(p)
+		return Gray([3]float64{col.R, col.G, col.B}[c] * factor)
+	})
+}
+
+// camera converts a perspective camera, nil for other types.
+// The camera looks along the node's -Z axis, with +Y up.
+func (l *gltfLoader) camera(c *gltf.Camera, world *geom.AffineTransform) tracer.Camera {
+	p := c.Perspective
+	if c.Type != "perspective" || p == nil {
+		return nil
+	}
+	aspect := p.AspectRatio
+	if aspect == 0 {
+		aspect = float64(defaultImageWidth) / float64(defaultImageHeight)
+	}
+	fov := 2 * math.Atan(aspect*math.Tan(p.Yfov/2))
+	rigid := gltfRigid(world)
+	return cameras.Transform(cameras.Projective(fov), rigid.A, rigid.B)
+}
+
+func (l *gltfLoader) light(gl *gltf.Light, world *geom.AffineTransform) Light {
+	color := C(gl.Color[0], gl.Color[1], gl.Color[2]).Mul(gl.Intensity)
+	rigid := gltfRigid(world)
+
+	// A point light of intensity I (candela) gives irradiance I/d² (lux),
+	// and hence brightness I/(πd²) on a white matte surface.
+	// A PointLight of power P gives P/(4πd²).
+	switch gl.Type {
+	default:
+		panic(fmt.Errorf("unknown light type: %q", gl.Type))
+	case "point":
+		return lights.PointLight(color.Mul(4), rigid.B)
+	case "spot":
+		in, out := gl.Spot.InnerConeAngle, gl.Spot.OuterConeAngle
+		if !(in >= 0 && in <= out && out <= Pi/2) {
+			panic(fmt.Errorf("spot light: need 0 <= innerConeAngle <= outerConeAngle <= π/2, have %v, %v", in, out))
+		}
+		// SpotLight points along -Y, glTF spots along -Z
+		spot := lights.SpotLight(color.Mul(4), in, out, O)
+		return lights.Transformed(spot, geom.ComposeLR(geom.Rotate(O, Ex, 90*Deg), rigid))
+	case "directional":
+		// direction towards the light: the node's +Z axis
+		dir := rigid.TransformDir(Ez)
+		yaw := math.Atan2(-dir[X], -dir[Z])
+		pitch := math.Asin(math.Max(-1, math.Min(1, dir[Y])))
+		return lights.SunLight(color.Mul(1/Pi), 0.53*Deg, yaw, pitch)
+	}
+}
+
+// gltfRigid removes the scale from a node's world transform, keeping rotation and translation.
+// Used for cameras and lights, which must not be scaled.
+func gltfRigid(t *geom.AffineTransform) *geom.AffineTransform {
+	r := *t
+	for i := range r.A {
+		if n := r.A[i].Len(); n != 0 {
+			r.A[i] = r.A[i].Mul(1 / n)
+		}
+	}
+	return &r
+}
+
+func (l *gltfLoader) check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
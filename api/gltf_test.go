@@ -0,0 +1,90 @@
+package api
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/barnex/bruteray/tracer"
+	"github.com/barnex/bruteray/tracer/objects/gltf"
+	"github.com/barnex/bruteray/tracer/test"
+)
+
+const gltfTestdata = "../tracer/objects/gltf/testdata/"
+
+// A checkered cube (embedded PNG texture) and a gold cube (node with a matrix transform),
+// children of a translated group, on a ground plane (triangle strip),
+// lit by a sun, a point light and a spot light, as seen by the file's camera.
+func TestGLTFFile(t *testing.T) {
+	g := GLTFFile(gltfTestdata + "scene.glb")
+	s := Spec{
+		Objects:   g.Objects,
+		Lights:    g.Lights,
+		Recursion: 3,
+	}
+	test.NPassSize(t, s.Scene(), g.Cameras[0], 30, 300, 200, test.DefaultTolerance)
+}
+
+// The JSON version of the test scene, with an external buffer,
+// has the same contents as the binary version.
+func TestGLTFFile_JSON(t *testing.T) {
+	bin := GLTFFile(gltfTestdata + "scene.glb")
+	json := GLTFFile(gltfTestdata + "scene.gltf")
+	if len(json.Objects) != 3 || len(json.Lights) != 3 || len(json.Cameras) != 1 {
+		t.Errorf("got %v objects, %v lights, %v cameras, want 3, 3, 1", len(json.Objects), len(json.Lights), len(json.Cameras))
+	}
+	for i := range bin.Objects {
+		if got, want := json.Objects[i].Bounds(), bin.Objects[i].Bounds(); got != want {
+			t.Errorf("object %v: got bounds %v, want %v", i, got, want)
+		}
+	}
+}
+
+// Lights shine in the direction of their node's -Z axis.
+func TestGLTFFile_LightDirection(t *testing.T) {
+	g := GLTFFile(gltfTestdata + "scene.glb")
+	ctx := tracer.NewCtx(1)
+	ctx.Init(0, 0)
+	ctx.CurrentRecursionDepth = 1
+
+	// the sun's node is rotated -50 deg around X, then 40 deg around Y
+	sun := g.Lights[0]
+	pos, _ := sun.Sample(ctx, O)
+	dir := pos.Normalized()
+	want := V(math.Cos(50*Deg)*math.Sin(40*Deg), math.Sin(50*Deg), math.Cos(50*Deg)*math.Cos(40*Deg))
+	if dir.Sub(want).Len() > 0.01 {
+		t.Errorf("sun: got direction %v, want %v", dir, want)
+	}
+
+	// the spot at (1.5, 2.5, 0) is rotated to point down
+	spot := g.Lights[2]
+	if _, c := spot.Sample(ctx, V(1.5, 0, 0)); c.Gray() == 0 {
+		t.Errorf("spot: no light below")
+	}
+	if _, c := spot.Sample(ctx, V(1.5, 2.5, -2)); c.Gray() != 0 {
+		t.Errorf("spot: light emitted along -Z: %v", c)
+	}
+}
+
+// Invalid files must be reported as errors, also when caught by a constructor (e.g. SpotLight).
+func TestLoadGLTF_Errors(t *testing.T) {
+	for _, c := range []struct {
+		doc  string
+		want string // error must contain
+	}{
+		{`{"nodes": [{"extensions": {"KHR_lights_punctual": {"light": 0}}}],
+		   "extensions": {"KHR_lights_punctual": {"lights": [{"type": "spot", "spot": {"innerConeAngle": 0.8, "outerConeAngle": 0.5}}]}}}`,
+			`innerConeAngle <= outerConeAngle`},
+		{`{"nodes": [{"extensions": {"KHR_lights_punctual": {"light": 0}}}],
+		   "extensions": {"KHR_lights_punctual": {"lights": [{"type": "area"}]}}}`,
+			`unknown light type: "area"`},
+	} {
+		doc, err := gltf.Parse([]byte(`{"asset": {"version": "2.0"}, "scenes": [{"nodes": [0]}], `+c.doc[1:]), ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadGLTF(doc); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("got error %v, want %q", err, c.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"image"
@@ -13,6 +14,9 @@ import (
 	"time"
 
 	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/imagef/hdr"
+	"github.com/barnex/bruteray/imagef/pfm"
+	"github.com/barnex/bruteray/imagef/post"
 	"github.com/barnex/bruteray/imagef/ppm"
 	"github.com/barnex/bruteray/tracer"
 
@@ -23,6 +27,7 @@ import (
 var (
 	flagHTTP   = flag.String("http", "", "HTTP port")
 	flagHalton = flag.Bool("halton", false, "Use Halton Quasi Monte Carlo")
+	flagResume = flag.Bool("resume", false, "Resume rendering from the last checkpoint")
 )
 
 func Render(spec Spec) {
@@ -32,6 +37,7 @@ func Render(spec Spec) {
 	//}else{
 	//	tracer.RandomSequence = random.PseudoRandom
 	//}
+	spec.applyFlags()
 	spec.InitDefaults()
 
 	if *flagPProf != "" {
@@ -47,40 +53,180 @@ func Render(spec Spec) {
 	}
 }
 
+// applyFlags overrides the image size, number of passes and recursion depth
+// with the command line flags -w, -h, -n, -r, if set.
+func (s *Spec) applyFlags() {
+	if *flagW != 0 {
+		s.Width = *flagW
+	}
+	if *flagH != 0 {
+		s.Height = *flagH
+	}
+	if *flagN != 0 {
+		s.NumPass = *flagN
+	}
+	if *flagR != 0 {
+		s.Recursion = *flagR
+	}
+}
+
 func renderLocal(spec Spec) {
 	//print("rendering:", *flagO, Width, "x", Height, ",", NumPass, "passes, ", Recursion, "recursion depth...")
 	s := tracer.NewSampler(spec.ImageFunc(), spec.Width, spec.Height, true)
 	pixs := 1 / float64(spec.Width) //??
+	if spec.PostProcess.Denoise.Radius != 0 {
+		s.EnableFeatures()
+	}
+	check(s.EnableAOV(spec.AOVs...))
 
-	passBeforeSave := 1
 	totalPasses := 0
-	for totalPasses < spec.NumPass {
-		s.Sample(passBeforeSave)
-		totalPasses += passBeforeSave
+	if *flagResume {
+		check(s.LoadCheckpoint(checkpointFile()))
+		totalPasses = maxPassCount(s)
+		print("resuming after", totalPasses, "passes")
+	}
+	lastCheckpoint := totalPasses
 
-		passBeforeSave++
+	totalPasses = renderPasses(&spec, s, totalPasses, func(totalPasses int) bool {
 		printTime("render")
-		//print(s.Stats())
+		printStats(s)
+
+		if spec.CheckpointEvery > 0 && totalPasses-lastCheckpoint >= spec.CheckpointEvery {
+			check(s.SaveCheckpoint(checkpointFile()))
+			lastCheckpoint = totalPasses
+			printTime("checkpoint")
+		}
 
 		//pp := Postprocess.ApplyTo(s.StoredImage(), imagef.PixelSize(s.Bounds().Dx(), s.Bounds().Dy()))
 		//printTime("postprocess")
 		//		check(save(pp, ""))
 
-		img := spec.PostProcess.ApplyTo(s.Image(), pixs)
-		check(save(img, ""))
-		check(savePPM(noExt(*flagO)+".ppm", img))
+		img := postProcess(&spec, s, pixs)
+		display := toneMap(&spec, img)
+		if isFloatFormat(*flagO) {
+			// store linear intensities, tone mapping is for display only
+			check(save(img, ""))
+		} else {
+			check(save(display, ""))
+		}
+		check(savePPM(noExt(*flagO)+".ppm", display))
+		check(saveAOVs(s, spec.AOVs))
 		printTime("encode")
 
-		//check(save(s.SamplingImage(), "-sampling"))
-		//printTime("sampling image")
+		if spec.NoiseThreshold > 0 {
+			check(save(s.SamplingImage(), "-sampling"))
+			printTime("sampling image")
+		}
+		return true
+	})
+
+	if spec.CheckpointEvery > 0 && lastCheckpoint != totalPasses {
+		check(s.SaveCheckpoint(checkpointFile()))
 	}
 
-	img := spec.PostProcess.ApplyTo(s.Image(), pixs)
+	img := toneMap(&spec, postProcess(&spec, s, pixs))
 	check(savePPM(noExt(*flagO)+".ppm", img))
 
 	print("DONE\n")
 }
 
+// renderPasses samples s in batches of increasing size until spec.NumPass passes
+// (or, with a noise threshold, convergence), starting after totalPasses passes.
+// It calls batchDone with the new total after each batch, and stops early if that returns false.
+// It returns the total number of passes.
+//
+// The batches only depend on totalPasses,
+// so that resuming from a checkpoint yields the same image as rendering without interruption.
+func renderPasses(spec *Spec, s *tracer.Sampler, totalPasses int, batchDone func(totalPasses int) bool) int {
+	for totalPasses < spec.NumPass {
+		nPass := batchSize(totalPasses, spec.NumPass)
+		if spec.NoiseThreshold > 0 {
+			numPix, _ := s.SampleAdaptive(context.Background(), nPass, spec.NoiseThreshold, spec.NumPass)
+			if numPix == 0 {
+				print("converged")
+				break
+			}
+			print("sampled", numPix, "pixels")
+		} else {
+			s.Sample(nPass)
+		}
+		totalPasses += nPass
+
+		if !batchDone(totalPasses) {
+			break
+		}
+	}
+	return totalPasses
+}
+
+// batchSize returns the number of passes to sample after totalPasses,
+// clamped to numPass in total.
+// Batches grow by one pass each: 1, 2, 3, ...,
+// so that intermediate results are saved often at first and rarely later on.
+func batchSize(totalPasses, numPass int) int {
+	// batch n ends after n*(n+1)/2 passes
+	n := 1
+	for n*(n+1)/2 <= totalPasses {
+		n++
+	}
+	nPass := n*(n+1)/2 - totalPasses
+	if totalPasses+nPass > numPass {
+		nPass = numPass - totalPasses
+	}
+	return nPass
+}
+
+// postProcess applies spec.PostProcess, except tone mapping, to the image rendered by s,
+// using feature buffers for denoising if they were recorded.
+// The result still holds linear intensities, see toneMap.
+func postProcess(spec *Spec, s *tracer.Sampler, pixelSize float64) imagef.Image {
+	var f *post.Features
+	if spec.PostProcess.Denoise.Radius != 0 {
+		f = &post.Features{
+			Albedo: s.Albedo(),
+			Normal: s.Normal(),
+			Depth:  s.Depth(),
+			StdErr: s.StdErr(),
+		}
+	}
+	p := spec.PostProcess
+	p.ToneMap = post.ToneMapParams{}
+	return p.ApplyToWithFeatures(s.Image(), f, pixelSize)
+}
+
+// toneMap applies spec.PostProcess.ToneMap to img, for display (PNG, JPEG, PPM).
+// Floating-point outputs are stored without tone mapping.
+func toneMap(spec *Spec, img imagef.Image) imagef.Image {
+	if t := spec.PostProcess.ToneMap; t != (post.ToneMapParams{}) {
+		img = post.ApplyToneMap(img, t)
+	}
+	return img
+}
+
+func checkpointFile() string {
+	return noExt(*flagO) + ".checkpoint"
+}
+
+// maxPassCount returns the largest number of passes accumulated by any pixel.
+func maxPassCount(s *tracer.Sampler) int {
+	max := 0
+	for _, row := range s.PassCount() {
+		for _, n := range row {
+			if n > max {
+				max = n
+			}
+		}
+	}
+	return max
+}
+
+// isFloatFormat returns whether fname has the extension of a floating-point image format,
+// which stores linear, unclipped intensities.
+func isFloatFormat(fname string) bool {
+	ext := path.Ext(fname)
+	return ext == ".pfm" || ext == ".hdr"
+}
+
 func save(img image.Image, suffix string) error {
 	return savef(img, *flagO, suffix)
 }
@@ -95,6 +241,17 @@ func savef(img image.Image, fname, suffix string) error {
 		err = png.Encode(&b, img)
 	case ".jpg", ".jpeg":
 		err = jpeg.Encode(&b, img, &jpeg.Options{Quality: JPEGQuality})
+	case ".pfm", ".hdr":
+		// floating-point formats: store linear, unclipped intensities
+		imgf, ok := img.(imagef.Image)
+		if !ok {
+			return fmt.Errorf("save %q: %v requires a floating-point image", fname, ext)
+		}
+		if ext == ".pfm" {
+			err = pfm.Encode(&b, imgf)
+		} else {
+			err = hdr.Encode(&b, imgf)
+		}
 	default:
 		err = fmt.Errorf("save %q: unknown image format extension", fname)
 	}
@@ -112,6 +269,10 @@ func savef(img image.Image, fname, suffix string) error {
 	return err
 }
 
+func printStats(s *tracer.Sampler) {
+	print(fmt.Sprintf("%.1f samples/pixel, %v", s.SamplesPerPixel(), s.Stats()))
+}
+
 var start = time.Now()
 
 func printTime(msg string) {
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/barnex/bruteray/tracer"
+)
+
+// Interrupting after a checkpoint and resuming must yield the same image
+// as rendering without interruption.
+func TestRenderPasses_Resume(t *testing.T) {
+	for _, threshold := range []float64{0, 0.01} {
+		spec, err := LoadSpec("../examples/scenes/showcase.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		spec.Width, spec.Height = 24, 16
+		spec.NumPass = 10
+		spec.NoiseThreshold = threshold
+
+		straight := tracer.NewSampler(spec.ImageFunc(), spec.Width, spec.Height, false)
+		if n := renderPasses(&spec, straight, 0, func(int) bool { return true }); n != spec.NumPass {
+			t.Errorf("threshold %v: straight run: got %v passes, want %v", threshold, n, spec.NumPass)
+		}
+
+		// interrupt after 6 passes, which is not the end of a batch
+		interrupted := tracer.NewSampler(spec.ImageFunc(), spec.Width, spec.Height, false)
+		if n := renderPasses(&spec, interrupted, 0, func(n int) bool { return n < 6 }); n != 6 {
+			t.Fatalf("threshold %v: interrupted after %v passes, want 6", threshold, n)
+		}
+		var checkpoint bytes.Buffer
+		if err := interrupted.WriteCheckpoint(&checkpoint); err != nil {
+			t.Fatal(err)
+		}
+
+		resumed := tracer.NewSampler(spec.ImageFunc(), spec.Width, spec.Height, false)
+		if err := resumed.ReadCheckpoint(&checkpoint); err != nil {
+			t.Fatal(err)
+		}
+		if n := renderPasses(&spec, resumed, maxPassCount(resumed), func(int) bool { return true }); n != spec.NumPass {
+			t.Errorf("threshold %v: resumed run: got %v passes, want %v", threshold, n, spec.NumPass)
+		}
+
+		if got, want := resumed.PassCount(), straight.PassCount(); !reflect.DeepEqual(got, want) {
+			t.Errorf("threshold %v: resumed pass counts differ from uninterrupted run", threshold)
+		}
+		if got, want := resumed.Image(), straight.Image(); !reflect.DeepEqual(got, want) {
+			t.Errorf("threshold %v: resumed image differs from uninterrupted run", threshold)
+		}
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	for _, c := range []struct {
+		total, numPass, want int
+	}{
+		{0, 10, 1},
+		{1, 10, 2},
+		{3, 10, 3},
+		{6, 10, 4},
+		{5, 10, 1}, // resumed mid-batch: finish the batch that ends at 6
+		{7, 10, 3},
+		{7, 8, 1}, // clamped to numPass
+		{9, 10, 1},
+	} {
+		if got := batchSize(c.total, c.numPass); got != c.want {
+			t.Errorf("batchSize(%v, %v): got %v, want %v", c.total, c.numPass, got, c.want)
+		}
+	}
+}
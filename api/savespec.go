@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/imagef/post"
+	"github.com/barnex/bruteray/tracer"
+)
+
+// SaveSpec writes a scene description file (see ParseSpec) from which LoadSpec
+// reconstructs an equivalent Spec. E.g.:
+// 	SaveSpec("scenes/kitchen.json", spec)
+// Meshes and images are written to separate files next to the scene file,
+// named after it (e.g. scenes/kitchen.mesh1.ply, scenes/kitchen.texture1.pfm).
+//
+// Only scene elements constructed by this package and its friends can be saved,
+// not those defined by arbitrary Go functions (e.g. texture.Func, objects.IsoSurface),
+// see package describe. Debug settings are not saved.
+func SaveSpec(file string, s Spec) error {
+	base := filepath.Base(file)
+	e := describe.NewEncoder(filepath.Dir(file), strings.TrimSuffix(base, filepath.Ext(base)))
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := WriteSpec(f, s, e); err != nil {
+		f.Close()
+		return fmt.Errorf("%v: %v", file, err)
+	}
+	return f.Close()
+}
+
+// WriteSpec is like SaveSpec, but writes the scene description to w,
+// and data files (meshes, images) as determined by e.
+// E.g., to write meshes in OBJ rather than PLY format:
+// 	e := describe.NewEncoder("scenes", "kitchen")
+// 	e.MeshFormat = "obj"
+// 	err := WriteSpec(w, spec, e)
+func WriteSpec(w io.Writer, s Spec, e *describe.Encoder) error {
+	n := describe.Node{}
+	set := func(key string, value interface{}, isSet bool) {
+		if isSet {
+			n[key] = value
+		}
+	}
+	set("width", s.Width, s.Width != 0)
+	set("height", s.Height, s.Height != 0)
+	set("numPass", s.NumPass, s.NumPass != 0)
+	set("recursion", s.Recursion, s.Recursion != 0)
+	set("noiseThreshold", s.NoiseThreshold, s.NoiseThreshold != 0)
+	set("checkpointEvery", s.CheckpointEvery, s.CheckpointEvery != 0)
+	set("aovs", s.AOVs, len(s.AOVs) != 0)
+
+	switch s.LightSelection {
+	default:
+		return fmt.Errorf("lightSelection: unknown value: %v", s.LightSelection)
+	case tracer.SampleAllLights:
+	case tracer.SampleLightsByPower:
+		n["lightSelection"] = "power"
+	case tracer.SampleLightTree:
+		n["lightSelection"] = "tree"
+	}
+
+	// describeAt checks for errors after each element, to report where they occurred.
+	describeAt := func(where string, x interface{}) (interface{}, error) {
+		desc := e.Describe(x)
+		if err := e.Err(); err != nil {
+			return nil, fmt.Errorf("%v: %v", where, err)
+		}
+		return desc, nil
+	}
+
+	if s.Camera != nil {
+		desc, err := describeAt("camera", s.Camera)
+		if err != nil {
+			return err
+		}
+		n["camera"] = desc
+	}
+	var lights, objects, media []interface{}
+	for i, l := range s.Lights {
+		desc, err := describeAt(fmt.Sprintf("lights[%v]", i), l)
+		if err != nil {
+			return err
+		}
+		lights = append(lights, desc)
+	}
+	for i, o := range s.Objects {
+		desc, err := describeAt(fmt.Sprintf("objects[%v]", i), o.Interface)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, desc)
+	}
+	for i, m := range s.Media {
+		desc, err := describeAt(fmt.Sprintf("media[%v]", i), m)
+		if err != nil {
+			return err
+		}
+		media = append(media, desc)
+	}
+	set("lights", lights, len(lights) != 0)
+	set("objects", objects, len(objects) != 0)
+	set("media", media, len(media) != 0)
+
+	pp, err := describePost(&s.PostProcess)
+	if err != nil {
+		return fmt.Errorf("postProcess: %v", err)
+	}
+	set("postProcess", pp, len(pp) != 0)
+
+	b, err := json.MarshalIndent(n, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// describePost describes post-processing parameters, see scenePost.
+// Parameters with zero value are omitted.
+func describePost(p *post.Params) (describe.Node, error) {
+	n := describe.Node{}
+	if p.ToneMap.Exposure != 0 {
+		n["exposure"] = p.ToneMap.Exposure
+	}
+	if p.ToneMap.WhitePoint != 0 {
+		n["whitePoint"] = p.ToneMap.WhitePoint
+	}
+	switch p.ToneMap.Operator {
+	default:
+		return nil, fmt.Errorf("toneMap: unknown value: %v", p.ToneMap.Operator)
+	case post.Clip:
+	case post.Reinhard:
+		n["toneMap"] = "reinhard"
+	case post.Filmic:
+		n["toneMap"] = "filmic"
+	case post.ACES:
+		n["toneMap"] = "aces"
+	}
+	if d := p.Denoise; d != (post.DenoiseParams{}) {
+		n["denoise"] = describe.Node{
+			"radius":      d.Radius,
+			"sigmaAlbedo": d.SigmaAlbedo,
+			"sigmaNormal": d.SigmaNormal,
+			"sigmaDepth":  d.SigmaDepth,
+			"sigmaColor":  d.SigmaColor,
+		}
+	}
+	for _, b := range []struct {
+		key string
+		p   post.BloomParams
+	}{
+		{"gaussian", p.Gaussian},
+		{"airy", p.Airy},
+		{"star", p.Star},
+	} {
+		if b.p != (post.BloomParams{}) {
+			n[b.key] = describe.Node{"radius": b.p.Radius, "amplitude": b.p.Amplitude, "threshold": b.p.Threshold}
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,919 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/imagef/post"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer"
+	"github.com/barnex/bruteray/tracer/cameras"
+	"github.com/barnex/bruteray/tracer/lights/ies"
+	"github.com/barnex/bruteray/tracer/materials"
+	"github.com/barnex/bruteray/tracer/media"
+	"github.com/barnex/bruteray/tracer/objects"
+	"github.com/barnex/bruteray/tracer/objects/gltf"
+)
+
+// LoadSpec reads a scene description file, see ParseSpec.
+// File names in the scene (textures, meshes, ...) are relative to the scene file.
+func LoadSpec(file string) (Spec, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Spec{}, err
+	}
+	defer f.Close()
+	s, err := ParseSpec(f, filepath.Dir(file))
+	if err != nil {
+		return Spec{}, fmt.Errorf("%v: %v", file, err)
+	}
+	return s, nil
+}
+
+// ParseSpec reads a scene description in JSON format, so that scenes can be written
+// (and rendered with command bruteray) without writing Go code. E.g.:
+// 	{
+// 		"width": 960, "height": 540, "numPass": 100,
+// 		"camera": {"fov": 60, "position": [0, 1, 4], "pitch": -10},
+// 		"materials": {
+// 			"floor": {"type": "matte", "color": {"type": "checkers", "pitch": [1, 1], "a": 0.8, "b": 0.2}}
+// 		},
+// 		"lights": [
+// 			{"type": "point", "color": [1, 0.9, 0.8], "ev": 6, "position": [2, 4, 3]}
+// 		],
+// 		"objects": [
+// 			{"type": "rectangle", "material": "floor", "size": [10, 10]},
+// 			{"type": "sphere", "material": {"type": "microfacet", "color": [0.8, 0.1, 0.1], "roughness": 0.3},
+// 			 "diam": 1, "center": [0, 0.5, 0]}
+// 		]
+// 	}
+//
+// The top-level properties are those of Spec: "width", "height", "numPass", "recursion",
+// "noiseThreshold", "checkpointEvery", "aovs", "lightSelection" ("all", "power" or "tree"),
+// "camera", "lights", "objects", "media" and "postProcess".
+// Named materials may be defined in "materials", and referred to by name wherever a material is expected.
+//
+// Cameras, lights, objects, materials, textures and media are JSON objects with a "type",
+// mapping onto the function with the same name in this package, with properties named after its arguments.
+// Angles are in degrees. Colors are [r, g, b] or a single number (gray).
+// Lights and objects accept a "transform": a list of operations applied in order, each one of
+// 	{"translate": [x, y, z]}
+// 	{"rotate": [axisX, axisY, axisZ], "angle": degrees, "origin": [x, y, z]}
+// 	{"scale": factor, "origin": [x, y, z]}
+// 	{"matrix": [[a, b, c, tx], [d, e, f, ty], [g, h, i, tz]]}
+//
+// See the sceneFile type and its friends for all types and properties.
+// Unknown types and properties are errors, so that typos do not go unnoticed.
+func ParseSpec(r io.Reader, dir string) (s Spec, err error) {
+	p := &sceneParser{
+		dir:       dir,
+		materials: make(map[string]Material),
+		gltf:      make(map[string]GLTF),
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			s = Spec{}
+			err = asError(e)
+		}
+	}()
+	return p.parse(r), nil
+}
+
+// sceneFile is the top-level object of a scene file.
+type sceneFile struct {
+	Width           int
+	Height          int
+	NumPass         int
+	Recursion       int
+	NoiseThreshold  float64
+	CheckpointEvery int
+	AOVs            []string
+	LightSelection  string
+
+	Camera      *sceneCamera
+	Materials   map[string]json.RawMessage
+	Lights      []json.RawMessage
+	Objects     []json.RawMessage
+	Media       []json.RawMessage
+	PostProcess scenePost
+}
+
+// sceneCamera is a camera:
+// 	"projective" (default): fov (horizontal, default 90), aperture, focusDist
+// 	"environmentMap"
+// 	"isometric": axis ("x", "y" or "z": view direction), size (horizontal viewport size)
+// 	"gltf": the index'th camera in a glTF file
+// Cameras other than "gltf" are placed at position, and rotated by yaw, pitch, roll.
+type sceneCamera struct {
+	Type      string
+	FOV       *float64
+	Aperture  float64
+	FocusDist float64
+	Axis      string
+	Size      float64
+	File      string
+	Index     int
+
+	Position         Vec
+	Yaw, Pitch, Roll float64
+}
+
+// sceneLight is a light source:
+// 	"point":       color (power), position
+// 	"spot":        color (power), innerAngle, outerAngle, position
+// 	"ies":         color (power), file (IES profile), position
+// 	"rectangle":   color (brightness), size [w, h], center
+// 	"disk":        color (brightness), diam, center
+// 	"sun":         color (brightness), diam (angular diameter, default 0.53), yaw, pitch
+// 	"sky":         turbidity (default 3), yaw, pitch
+// 	"daylight":    turbidity (default 3), yaw, pitch (adds a sky and a sun)
+// 	"environment": file (image)
+// 	"mesh":        emission (texture), object
+// 	"gltf":        all lights in a glTF file
+// Colors are multiplied by 2^ev.
+type sceneLight struct {
+	Type       string
+	Color      sceneColor
+	EV         float64
+	Position   Vec
+	Center     Vec
+	Size       []float64
+	Diam       float64
+	InnerAngle float64
+	OuterAngle float64
+	Yaw, Pitch float64
+	Turbidity  float64
+	File       string
+	Emission   json.RawMessage
+	Object     json.RawMessage
+	Transform  []sceneTransform
+}
+
+// sceneObject is an object:
+// 	"sphere":           diam, center
+// 	"box":              size [dx, dy, dz], center
+// 	"boxWithBounds":    min, max
+// 	"cylinder":         diam, height, center, axis ("x", "y" (default) or "z")
+// 	"cylinderWithCaps": diam, height, center
+// 	"rectangle":        size [dx, dz], center (horizontal)
+// 	"disk":             diam, center (horizontal)
+// 	"triangle":         vertices (3)
+// 	"quadrilateral":    vertices (4)
+// 	"backdrop"
+// 	"plyFile":          file, material (optional)
+// 	"objFile":          file, materials (by MTL name, optional)
+// 	"gltf":             all objects in a glTF file
+// 	"tree":             objects
+// 	"and", "or":        objects (intersection, union)
+// 	"andNot":           objects (the first, minus all others)
+// 	"restrict":         objects (the first, restricted to the inside of the second)
+// 	"not":              object (inside and outside swapped, for CSG)
+// 	"hollow":           object (empty inside, for CSG)
+// Objects other than those read from a file, and groups, need a material.
+type sceneObject struct {
+	Type      string
+	Material  json.RawMessage
+	Materials map[string]json.RawMessage
+	Diam      float64
+	Height    float64
+	Size      []float64
+	Center    Vec
+	Min, Max  Vec
+	Axis      string
+	Vertices  []Vec
+	File      string
+	Object    json.RawMessage
+	Objects   []json.RawMessage
+	Transform []sceneTransform
+}
+
+// sceneMaterial is a material:
+// 	"matte", "flat":   color (texture)
+// 	"reflective":      color
+// 	"transparent":     color, consumeRecursion (default true)
+// 	"refractive":      ior (default 1.5), iorOutside (default 1)
+// 	"shiny":           color, reflectivity
+// 	"microfacet":      color, roughness, metalness (textures, default 0)
+// 	"roughRefractive": ior, iorOutside, roughness, color
+// 	"reflectFresnel":  ior, transmitted (material)
+// 	"blend":           weights [a, b], materials [a, b]
+// 	"twoSided":        front, back (materials)
+// A material may also be given as the name of a material in "materials",
+// or as a color (shorthand for a matte material).
+type sceneMaterial struct {
+	Type             string
+	Color            json.RawMessage
+	Roughness        json.RawMessage
+	Metalness        json.RawMessage
+	IOR              float64
+	IOROutside       float64
+	Reflectivity     float64
+	ConsumeRecursion *bool
+	Transmitted      json.RawMessage
+	Weights          []float64
+	Materials        []json.RawMessage
+	Front, Back      json.RawMessage
+}
+
+// sceneTexture is a texture:
+// 	"image":       file, scale [u, v] (optional), nearest (no interpolation, default false)
+// 	"checkers":    pitch [u, v], a, b (textures)
+// 	"scaleUV":     texture, scale [u, v] (optional), pan [u, v] (optional)
+// 	"vertexColor": the vertex colors of a mesh read from a PLY file
+// A texture may also be given as a color, or as an image file name.
+type sceneTexture struct {
+	Type    string
+	File    string
+	Nearest bool
+	Texture json.RawMessage
+	Scale   []float64
+	Pan     []float64
+	Pitch   []float64
+	A, B    json.RawMessage
+}
+
+// sceneMedium is a participating medium:
+// 	"expFog":   density, ambient (color), height
+// 	"fog":      density, height
+// 	"interior": object (shape), absorption (color), scattering
+// 	"volume":   object (bounds), density, albedo (color), g (forward scattering, -1..1)
+// A "volume" has a uniform density inside its bounds.
+// Non-uniform densities (media.Volume with a 3D scalar field) can only be built in Go.
+type sceneMedium struct {
+	Type       string
+	Density    float64
+	Ambient    sceneColor
+	Height     float64
+	Object     json.RawMessage
+	Absorption sceneColor
+	Scattering float64
+	Albedo     sceneColor
+	G          float64
+}
+
+// sceneTransform is one of translate, rotate, scale or matrix.
+// A matrix has 3 rows of 4 elements: the linear part, followed by the translation.
+type sceneTransform struct {
+	Translate *Vec
+	Rotate    *Vec
+	Angle     float64
+	Scale     *float64
+	Origin    Vec
+	Matrix    *[3][4]float64
+}
+
+// scenePost are post-processing parameters, see post.Params.
+// ToneMap is "clip" (default), "reinhard", "filmic" or "aces".
+type scenePost struct {
+	Exposure   float64
+	ToneMap    string
+	WhitePoint float64
+	Denoise    post.DenoiseParams
+	Gaussian   post.BloomParams
+	Airy       post.BloomParams
+	Star       post.BloomParams
+}
+
+// sceneColor is decoded from [r, g, b] or a single number (gray).
+type sceneColor Color
+
+func (c *sceneColor) UnmarshalJSON(b []byte) error {
+	var gray float64
+	if err := json.Unmarshal(b, &gray); err == nil {
+		*c = sceneColor(Gray(gray))
+		return nil
+	}
+	var rgb []float64
+	if err := json.Unmarshal(b, &rgb); err != nil || len(rgb) != 3 {
+		return fmt.Errorf("invalid color: %s", b)
+	}
+	*c = sceneColor(C(rgb[0], rgb[1], rgb[2]))
+	return nil
+}
+
+type sceneParser struct {
+	dir       string
+	defs      map[string]json.RawMessage // named materials, not yet parsed
+	materials map[string]Material        // named materials, parsed
+	resolving map[string]bool            // named materials being parsed, to detect cycles
+	gltf      map[string]GLTF            // glTF files by name
+}
+
+func (p *sceneParser) parse(r io.Reader) Spec {
+	var f sceneFile
+	p.decodeReader(r, &f)
+
+	s := Spec{
+		Width:           f.Width,
+		Height:          f.Height,
+		NumPass:         f.NumPass,
+		Recursion:       f.Recursion,
+		NoiseThreshold:  f.NoiseThreshold,
+		CheckpointEvery: f.CheckpointEvery,
+		AOVs:            f.AOVs,
+	}
+
+	switch f.LightSelection {
+	default:
+		p.errorf("lightSelection: unknown value: %q", f.LightSelection)
+	case "", "all":
+		s.LightSelection = tracer.SampleAllLights
+	case "power":
+		s.LightSelection = tracer.SampleLightsByPower
+	case "tree":
+		s.LightSelection = tracer.SampleLightTree
+	}
+
+	p.defs = f.Materials
+	p.resolving = make(map[string]bool)
+	// parse all named materials, also unused ones, to report errors
+	names := make([]string, 0, len(f.Materials))
+	for name := range f.Materials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p.namedMaterial(name)
+	}
+
+	if f.Camera != nil {
+		p.at("camera", func() { s.Camera = p.camera(f.Camera) })
+	}
+	for i, raw := range f.Lights {
+		p.at(fmt.Sprintf("lights[%v]", i), func() { s.Lights = append(s.Lights, p.lights(raw)...) })
+	}
+	for i, raw := range f.Objects {
+		p.at(fmt.Sprintf("objects[%v]", i), func() { s.Objects = append(s.Objects, p.object(raw)) })
+	}
+	for i, raw := range f.Media {
+		p.at(fmt.Sprintf("media[%v]", i), func() { s.Media = append(s.Media, p.medium(raw)) })
+	}
+	p.at("postProcess", func() { s.PostProcess = p.postProcess(&f.PostProcess) })
+	return s
+}
+
+func (p *sceneParser) camera(c *sceneCamera) tracer.Camera {
+	var cam *cameras.WithTransform
+	switch c.Type {
+	default:
+		p.unknownType(c.Type)
+	case "", "projective":
+		fov := 90.0
+		if c.FOV != nil {
+			fov = *c.FOV
+		}
+		cam = cameras.ProjectiveAperture(fov*Deg, c.Aperture, c.FocusDist)
+	case "environmentMap":
+		cam = cameras.EnvironmentMap()
+	case "isometric":
+		cam = cameras.Isometric(p.axis(c.Axis, Z), c.Size)
+	case "gltf":
+		g := p.gltfFile(c.File)
+		if c.Index < 0 || c.Index >= len(g.Cameras) {
+			p.errorf("%v: camera index out of range: %v, have %v", c.File, c.Index, len(g.Cameras))
+		}
+		return g.Cameras[c.Index]
+	}
+	return cam.Translate(c.Position).YawPitchRoll(c.Yaw*Deg, c.Pitch*Deg, c.Roll*Deg)
+}
+
+func (p *sceneParser) lights(raw json.RawMessage) []Light {
+	var l sceneLight
+	p.decode(raw, &l)
+	color := Color(l.Color).EV(l.EV)
+	if l.Turbidity == 0 {
+		l.Turbidity = 3
+	}
+
+	var lights []Light
+	switch l.Type {
+	default:
+		p.unknownType(l.Type)
+	case "point":
+		lights = append(lights, PointLight(color, l.Position))
+	case "spot":
+		lights = append(lights, SpotLight(color, l.InnerAngle*Deg, l.OuterAngle*Deg, l.Position))
+	case "ies":
+		profile, err := ies.ParseFile(p.path(l.File))
+		p.check(err)
+		lights = append(lights, IESLight(color, profile, l.Position))
+	case "rectangle":
+		size := p.size(l.Size, 2)
+		lights = append(lights, RectangleLight(color, size[0], size[1], l.Center))
+	case "disk":
+		lights = append(lights, DiskLight(color, l.Diam, l.Center))
+	case "sun":
+		if l.Diam == 0 {
+			l.Diam = 0.53
+		}
+		lights = append(lights, SunLight(color, l.Diam*Deg, l.Yaw*Deg, l.Pitch*Deg))
+	case "sky":
+		lights = append(lights, Sky(l.Turbidity, l.Yaw*Deg, l.Pitch*Deg))
+	case "daylight":
+		lights = append(lights, Daylight(l.Turbidity, l.Yaw*Deg, l.Pitch*Deg)...)
+	case "environment":
+		img, err := imagef.Load(p.path(l.File), nil)
+		p.check(err)
+		lights = append(lights, EnvironmentLight(img))
+	case "mesh":
+		var obj Object
+		p.at("object", func() { obj = p.object(l.Object) })
+		var emission texture.Texture
+		p.at("emission", func() { emission = p.texture(l.Emission) })
+		lights = append(lights, MeshLight(emission, obj.Interface))
+	case "gltf":
+		lights = append(lights, p.gltfFile(l.File).Lights...)
+	}
+
+	if len(l.Transform) != 0 {
+		t := p.transform(l.Transform)
+		for i := range lights {
+			lights[i] = TransformedLight(lights[i], t)
+		}
+	}
+	return lights
+}
+
+func (p *sceneParser) object(raw json.RawMessage) Object {
+	var o sceneObject
+	p.decode(raw, &o)
+
+	var obj Object
+	switch o.Type {
+	default:
+		p.unknownType(o.Type)
+	case "sphere":
+		obj = Sphere(p.objMaterial(o.Material), o.Diam, o.Center)
+	case "box":
+		s := p.size(o.Size, 3)
+		obj = Box(p.objMaterial(o.Material), s[0], s[1], s[2], o.Center)
+	case "boxWithBounds":
+		obj = BoxWithBounds(p.objMaterial(o.Material), o.Min, o.Max)
+	case "cylinder":
+		obj = Object{objects.CylinderDir(p.objMaterial(o.Material), p.axis(o.Axis, Y), o.Diam, o.Height, o.Center)}
+	case "cylinderWithCaps":
+		obj = CylinderWithCaps(p.objMaterial(o.Material), o.Diam, o.Height, o.Center)
+	case "rectangle":
+		s := p.size(o.Size, 2)
+		obj = Rectangle(p.objMaterial(o.Material), s[0], s[1], o.Center)
+	case "disk":
+		obj = Object{objects.Disk(p.objMaterial(o.Material), o.Diam, o.Center)}
+	case "triangle":
+		v := p.vertices(o.Vertices, 3)
+		obj = Object{objects.Triangle(p.objMaterial(o.Material), v[0], v[1], v[2])}
+	case "quadrilateral":
+		v := p.vertices(o.Vertices, 4)
+		obj = Object{objects.Quadrilateral(p.objMaterial(o.Material), v[0], v[1], v[2], v[3])}
+	case "backdrop":
+		obj = Backdrop(p.objMaterial(o.Material))
+	case "plyFile":
+		var m Material
+		if len(o.Material) != 0 {
+			m = p.material(o.Material)
+		}
+		mesh, err := objects.LoadPlyFile(m, p.path(o.File))
+		p.check(err)
+		obj = Object{mesh}
+	case "objFile":
+		m := make(map[string]Material)
+		for name, raw := range o.Materials {
+			p.at("materials."+name, func() { m[name] = p.material(raw) })
+		}
+		mesh, err := objects.LoadObjFile(m, p.path(o.File))
+		p.check(err)
+		obj = Object{mesh}
+	case "gltf":
+		g := p.gltfFile(o.File)
+		if len(g.Objects) == 0 {
+			p.errorf("%v: no objects", o.File)
+		}
+		obj = Tree(g.Objects...)
+	case "tree", "and", "or", "andNot", "restrict":
+		obj = p.group(o.Type, o.Objects)
+	case "not", "hollow":
+		var orig Object
+		p.at("object", func() { orig = p.object(o.Object) })
+		if o.Type == "not" {
+			obj = Object{objects.Not(orig.Interface)}
+		} else {
+			obj = Object{objects.Hollow(orig.Interface)}
+		}
+	}
+
+	if len(o.Transform) != 0 {
+		obj = obj.Transform(p.transform(o.Transform))
+	}
+	return obj
+}
+
+// group combines objects into a tree or CSG operation.
+func (p *sceneParser) group(typ string, raw []json.RawMessage) Object {
+	if len(raw) == 0 {
+		p.errorf("%v: need objects", typ)
+	}
+	if typ == "restrict" && len(raw) != 2 {
+		p.errorf("restrict: need 2 objects, have %v", len(raw))
+	}
+	objs := make([]Object, len(raw))
+	for i, raw := range raw {
+		p.at(fmt.Sprintf("objects[%v]", i), func() { objs[i] = p.object(raw) })
+	}
+	if typ == "tree" {
+		return Tree(objs...)
+	}
+	obj := objs[0]
+	for _, o := range objs[1:] {
+		switch typ {
+		case "and":
+			obj = obj.And(o)
+		case "or":
+			obj = obj.Or(o)
+		case "andNot":
+			obj = obj.AndNot(o)
+		case "restrict":
+			obj = obj.Restrict(o)
+		}
+	}
+	return obj
+}
+
+// objMaterial returns an object's material, which is required.
+func (p *sceneParser) objMaterial(raw json.RawMessage) Material {
+	if len(raw) == 0 {
+		p.errorf("missing material")
+	}
+	var m Material
+	p.at("material", func() { m = p.material(raw) })
+	return m
+}
+
+// material parses a material, the name of a material in "materials", or a color (matte).
+func (p *sceneParser) material(raw json.RawMessage) Material {
+	switch firstByte(raw) {
+	case '"':
+		var name string
+		p.decode(raw, &name)
+		return p.namedMaterial(name)
+	case '{':
+	default:
+		var c sceneColor
+		p.decode(raw, &c)
+		return Matte(Color(c))
+	}
+
+	var m sceneMaterial
+	p.decode(raw, &m)
+	if m.IOR == 0 {
+		m.IOR = 1.5
+	}
+	if m.IOROutside == 0 {
+		m.IOROutside = 1
+	}
+	switch m.Type {
+	default:
+		p.unknownType(m.Type)
+		panic("unreachable")
+	case "matte":
+		return Matte(p.texture(m.Color))
+	case "flat":
+		return Flat(p.texture(m.Color))
+	case "reflective":
+		return Reflective(p.color(m.Color))
+	case "transparent":
+		consumeRecursion := true
+		if m.ConsumeRecursion != nil {
+			consumeRecursion = *m.ConsumeRecursion
+		}
+		return Transparent(p.texture(m.Color), consumeRecursion)
+	case "refractive":
+		return materials.Refractive2(m.IOROutside, m.IOR)
+	case "shiny":
+		return Shiny(p.texture(m.Color), m.Reflectivity)
+	case "microfacet":
+		return materials.Microfacet(p.texture(m.Color), p.optTexture(m.Roughness), p.optTexture(m.Metalness))
+	case "roughRefractive":
+		return materials.RoughRefractive(m.IOROutside, m.IOR, p.optTexture(m.Roughness), p.texture(m.Color))
+	case "reflectFresnel":
+		var t Material
+		p.at("transmitted", func() { t = p.material(m.Transmitted) })
+		return ReflectFresnel(m.IOR, t)
+	case "blend":
+		if len(m.Weights) != 2 || len(m.Materials) != 2 {
+			p.errorf("blend: need 2 weights and 2 materials")
+		}
+		var a, b Material
+		p.at("materials[0]", func() { a = p.material(m.Materials[0]) })
+		p.at("materials[1]", func() { b = p.material(m.Materials[1]) })
+		return Blend(m.Weights[0], a, m.Weights[1], b)
+	case "twoSided":
+		var front, back Material
+		p.at("front", func() { front = p.material(m.Front) })
+		p.at("back", func() { back = p.material(m.Back) })
+		return materials.TwoSided(front, back)
+	}
+}
+
+// namedMaterial returns the material defined in "materials".
+func (p *sceneParser) namedMaterial(name string) Material {
+	if m, ok := p.materials[name]; ok {
+		return m
+	}
+	raw, ok := p.defs[name]
+	if !ok {
+		p.errorf("undefined material: %q", name)
+	}
+	if p.resolving[name] {
+		p.errorf("material %q refers to itself", name)
+	}
+	p.resolving[name] = true
+	var m Material
+	p.at("materials."+name, func() { m = p.material(raw) })
+	p.materials[name] = m
+	return m
+}
+
+// texture parses a texture, a color or an image file name. It is required.
+func (p *sceneParser) texture(raw json.RawMessage) texture.Texture {
+	switch firstByte(raw) {
+	case 0:
+		p.errorf("missing color")
+	case '"':
+		var file string
+		p.decode(raw, &file)
+		return p.image(file, false)
+	case '{':
+	default:
+		return p.color(raw)
+	}
+
+	var t sceneTexture
+	p.decode(raw, &t)
+	switch t.Type {
+	default:
+		p.unknownType(t.Type)
+		panic("unreachable")
+	case "image":
+		img := p.image(t.File, t.Nearest)
+		if t.Scale != nil {
+			s := p.size(t.Scale, 2)
+			img = texture.ScaleUV(img, s[0], s[1])
+		}
+		return img
+	case "scaleUV":
+		var tex texture.Texture
+		p.at("texture", func() { tex = p.texture(t.Texture) })
+		if t.Pan != nil {
+			pan := p.size(t.Pan, 2)
+			tex = texture.Pan(tex, pan[0], pan[1])
+		}
+		if t.Scale != nil {
+			s := p.size(t.Scale, 2)
+			tex = texture.ScaleUV(tex, s[0], s[1])
+		}
+		return tex
+	case "vertexColor":
+		return texture.VertexColor
+	case "checkers":
+		pitch := p.size(t.Pitch, 2)
+		var a, b texture.Texture
+		p.at("a", func() { a = p.texture(t.A) })
+		p.at("b", func() { b = p.texture(t.B) })
+		return texture.Checkers(pitch[0], pitch[1], a, b)
+	}
+}
+
+// optTexture is like texture, but returns black if absent
+// (e.g. for zero roughness or metalness).
+func (p *sceneParser) optTexture(raw json.RawMessage) texture.Texture {
+	if len(raw) == 0 {
+		return Black
+	}
+	return p.texture(raw)
+}
+
+func (p *sceneParser) color(raw json.RawMessage) Color {
+	if len(raw) == 0 {
+		p.errorf("missing color")
+	}
+	var c sceneColor
+	p.decode(raw, &c)
+	return Color(c)
+}
+
+func (p *sceneParser) image(file string, nearest bool) texture.Texture {
+	img, err := imagef.Load(p.path(file), nil)
+	p.check(err)
+	if nearest {
+		return texture.Nearest(img)
+	}
+	return texture.Bilinear(img)
+}
+
+func (p *sceneParser) medium(raw json.RawMessage) Medium {
+	var m sceneMedium
+	p.decode(raw, &m)
+	switch m.Type {
+	default:
+		p.unknownType(m.Type)
+		panic("unreachable")
+	case "expFog":
+		return ExpFog(m.Density, Color(m.Ambient), m.Height)
+	case "fog":
+		return Fog(m.Density, m.Height, 0) // numLight is deprecated
+	case "interior":
+		var shape Object
+		p.at("object", func() { shape = p.object(m.Object) })
+		return media.Interior(shape.Interface, Color(m.Absorption), m.Scattering)
+	case "volume":
+		var shape Object
+		p.at("object", func() { shape = p.object(m.Object) })
+		return media.Volume(shape.Interface, texture.ConstScalar3D(m.Density), m.Density, Color(m.Albedo), m.G)
+	}
+}
+
+func (p *sceneParser) transform(t []sceneTransform) *geom.AffineTransform {
+	ops := make([]*geom.AffineTransform, len(t))
+	for i, t := range t {
+		n := 0
+		if t.Translate != nil {
+			ops[i] = geom.Translate(*t.Translate)
+			n++
+		}
+		if t.Rotate != nil {
+			ops[i] = geom.Rotate(t.Origin, *t.Rotate, t.Angle*Deg)
+			n++
+		}
+		if t.Scale != nil {
+			ops[i] = geom.Scale(t.Origin, *t.Scale)
+			n++
+		}
+		if t.Matrix != nil {
+			ops[i] = matrixTransform(t.Matrix)
+			n++
+		}
+		if n != 1 {
+			p.errorf("transform[%v]: need one of translate, rotate, scale or matrix", i)
+		}
+	}
+	return geom.ComposeLR(ops...)
+}
+
+// matrixTransform converts rows [a, b, c, translation] to an affine transform
+// (whose matrix is stored column-major).
+func matrixTransform(m *[3][4]float64) *geom.AffineTransform {
+	var t geom.AffineTransform
+	for i := range m {
+		for j := 0; j < 3; j++ {
+			t.A[j][i] = m[i][j]
+		}
+		t.B[i] = m[i][3]
+	}
+	return &t
+}
+
+func (p *sceneParser) postProcess(s *scenePost) post.Params {
+	op, ok := map[string]post.ToneMap{
+		"":         post.Clip,
+		"clip":     post.Clip,
+		"reinhard": post.Reinhard,
+		"filmic":   post.Filmic,
+		"aces":     post.ACES,
+	}[strings.ToLower(s.ToneMap)]
+	if !ok {
+		p.errorf("toneMap: unknown value: %q", s.ToneMap)
+	}
+	return post.Params{
+		Denoise:  s.Denoise,
+		Gaussian: s.Gaussian,
+		Airy:     s.Airy,
+		Star:     s.Star,
+		ToneMap: post.ToneMapParams{
+			Exposure:   s.Exposure,
+			Operator:   op,
+			WhitePoint: s.WhitePoint,
+		},
+	}
+}
+
+// gltfFile returns the (cached) contents of a glTF file.
+func (p *sceneParser) gltfFile(file string) GLTF {
+	if g, ok := p.gltf[file]; ok {
+		return g
+	}
+	doc, err := gltf.ParseFile(p.path(file))
+	p.check(err)
+	g, err := loadGLTF(doc)
+	p.check(err)
+	p.gltf[file] = g
+	return g
+}
+
+// path returns the path of a file relative to the scene file,
+// which must exist.
+func (p *sceneParser) path(file string) string {
+	if file == "" {
+		p.errorf("missing file")
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(p.dir, file)
+	}
+	_, err := os.Stat(file)
+	p.check(err)
+	return file
+}
+
+func (p *sceneParser) axis(a string, def int) int {
+	switch strings.ToLower(a) {
+	default:
+		p.errorf("axis: need x, y or z, have: %q", a)
+		panic("unreachable")
+	case "":
+		return def
+	case "x":
+		return X
+	case "y":
+		return Y
+	case "z":
+		return Z
+	}
+}
+
+// size checks that s has n elements.
+func (p *sceneParser) size(s []float64, n int) []float64 {
+	if len(s) != n {
+		p.errorf("need %v sizes, have %v", n, len(s))
+	}
+	return s
+}
+
+func (p *sceneParser) vertices(v []Vec, n int) []Vec {
+	if len(v) != n {
+		p.errorf("need %v vertices, have %v", n, len(v))
+	}
+	return v
+}
+
+// decode decodes JSON, rejecting unknown properties.
+func (p *sceneParser) decode(raw json.RawMessage, v interface{}) {
+	p.decodeReader(bytes.NewReader(raw), v)
+}
+
+func (p *sceneParser) decodeReader(r io.Reader, v interface{}) {
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	p.check(d.Decode(v))
+}
+
+// at calls f, prefixing errors with the location in the scene file.
+func (p *sceneParser) at(where string, f func()) {
+	defer func() {
+		if e := recover(); e != nil {
+			panic(fmt.Errorf("%v: %v", where, asError(e)))
+		}
+	}()
+	f()
+}
+
+func (p *sceneParser) unknownType(typ string) {
+	if typ == "" {
+		p.errorf("missing type")
+	}
+	p.errorf("unknown type: %q", typ)
+}
+
+func (p *sceneParser) check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (p *sceneParser) errorf(format string, x ...interface{}) {
+	panic(fmt.Errorf(format, x...))
+}
+
+// asError converts a recovered panic to an error.
+// Constructors panic with a string on invalid arguments.
+func asError(e interface{}) error {
+	if err, ok := e.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", e)
+}
+
+// firstByte returns the first non-whitespace byte of JSON value raw,
+// 0 if empty.
+func firstByte(raw json.RawMessage) byte {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return 0
+	}
+	return raw[0]
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef/post"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer/materials"
+	"github.com/barnex/bruteray/tracer/media"
+	"github.com/barnex/bruteray/tracer/objects"
+	"github.com/barnex/bruteray/tracer/test"
+)
+
+// The example scene file, covering textures, named materials, CSG and transforms.
+func TestLoadSpec(t *testing.T) {
+	s, err := LoadSpec("../examples/scenes/showcase.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Width != 960 || s.Height != 540 || s.NumPass != 200 || s.Recursion != 4 {
+		t.Errorf("got size %vx%v, %v passes, recursion %v", s.Width, s.Height, s.NumPass, s.Recursion)
+	}
+	if len(s.Lights) != 2 || len(s.Objects) != 5 {
+		t.Errorf("got %v lights, %v objects", len(s.Lights), len(s.Objects))
+	}
+	test.NPassSize(t, s.Scene(), s.Camera, 10, 240, 135, test.DefaultTolerance)
+}
+
+func TestParseSpec_Errors(t *testing.T) {
+	for _, c := range []struct {
+		scene string
+		want  string // error must contain
+	}{
+		{`{"widht": 1}`, `unknown field "widht"`},
+		{`{"objects": [{"type": "sphear"}]}`, `objects[0]: unknown type: "sphear"`},
+		{`{"objects": [{"diam": 1}]}`, `objects[0]: missing type`},
+		{`{"objects": [{"type": "sphere", "diam": 1}]}`, `missing material`},
+		{`{"objects": [{"type": "sphere", "material": "red"}]}`, `undefined material: "red"`},
+		{`{"objects": [{"type": "tree", "objects": [{"type": "box", "material": 1, "size": [1, 2]}]}]}`, `objects[0]: objects[0]: need 3 sizes`},
+		{`{"materials": {"a": "b", "b": "a"}}`, `refers to itself`},
+		{`{"materials": {"a": {"type": "matte", "color": [1, 2]}}}`, `materials.a: invalid color`},
+		{`{"lights": [{"type": "sky", "pitch": -10}]}`, `lights[0]: lights: Sky: sun must be above the horizon`},
+		{`{"lights": [{"type": "environment", "file": "nonexistent.hdr"}]}`, `no such file`},
+		{`{"objects": [{"type": "sphere", "material": 1, "transform": [{"scale": 2, "translate": [1, 0, 0]}]}]}`, `need one of translate, rotate, scale or matrix`},
+		{`{"objects": [{"type": "plyFile", "file": "scenefile.go"}]}`, `bad header`},
+		{`{"objects": [{"type": "objFile", "file": "scenefile.go"}]}`, `objects[0]: line`},
+		{`{"postProcess": {"toneMap": "magic"}}`, `toneMap: unknown value`},
+		{`{"lightSelection": "some"}`, `lightSelection: unknown value`},
+	} {
+		_, err := ParseSpec(strings.NewReader(c.scene), ".")
+		if err == nil {
+			t.Errorf("%v: expected error", c.scene)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%v: got error %q, want %q", c.scene, err, c.want)
+		}
+	}
+}
+
+// Named materials may refer to each other, and all ways of writing a material
+// (named, inline, color shorthand) are accepted.
+func TestParseSpec_Materials(t *testing.T) {
+	s, err := ParseSpec(strings.NewReader(`{
+		"materials": {
+			"red":   [1, 0, 0],
+			"shiny": {"type": "blend", "weights": [0.9, 0.1], "materials": ["red", {"type": "reflective", "color": 1}]},
+			"glass": {"type": "reflectFresnel", "transmitted": {"type": "transparent", "color": 1}}
+		},
+		"objects": [
+			{"type": "sphere", "material": "shiny", "diam": 1},
+			{"type": "sphere", "material": 0.5, "diam": 1},
+			{"type": "cylinder", "material": "glass", "diam": 1, "height": 1, "axis": "z"}
+		],
+		"lights": [{"type": "daylight", "yaw": 30, "pitch": 40}],
+		"camera": {"type": "isometric", "axis": "y", "size": 4}
+	}`), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Objects) != 3 || len(s.Lights) != 2 || s.Camera == nil {
+		t.Errorf("got %v objects, %v lights, camera %v", len(s.Objects), len(s.Lights), s.Camera)
+	}
+}
+
+// A uniform volume can be read and written back.
+// Non-uniform volumes cannot be described.
+func TestParseSpec_Volume(t *testing.T) {
+	scene := `{"media": [{"type": "volume", "object": {"type": "sphere", "material": 1, "diam": 2}, "density": 3, "albedo": 0.9, "g": 0.6}]}`
+	s, err := ParseSpec(strings.NewReader(scene), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b1 bytes.Buffer
+	if err := WriteSpec(&b1, s, describe.NewEncoder(".", "scene")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"type": "volume"`, `"density": 3`, `"g": 0.6`} {
+		if !strings.Contains(b1.String(), want) {
+			t.Errorf("saved scene does not contain %v:\n%v", want, b1.String())
+		}
+	}
+	s2, err := ParseSpec(&b1, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s2.Media) != 1 {
+		t.Errorf("got %v media, want 1", len(s2.Media))
+	}
+
+	cloud := media.Volume(objects.Sphere(nil, 2, O), texture.ScalarFunc3D(func(Vec) float64 { return 1 }), 1, White, 0)
+	err = WriteSpec(ioutil.Discard, Spec{Media: []Medium{cloud}}, describe.NewEncoder(".", "scene"))
+	if err == nil || !strings.Contains(err.Error(), "cannot describe volume") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+// A scene built in Go, saved with SaveSpec and loaded back with LoadSpec,
+// must render the same as the original. Saving it again must give the same scene file.
+func TestSaveSpec(t *testing.T) {
+	gold := materials.Microfacet(C(1, 0.77, 0.34), Gray(0.3), White)
+	s := Spec{
+		Width:     960,
+		Height:    540,
+		NumPass:   100,
+		Recursion: 4,
+		Camera:    ProjectiveAperture(55*Deg, 0.01, 4).Translate(V(0, 1.6, 4.2)).YawPitchRoll(5*Deg, -15*Deg, 2*Deg),
+		Lights: []Light{
+			RectangleLight(Gray(8), 1, 1, V(0, 3, 0)),
+			TransformedLight(SpotLight(C(1, 0.8, 0.6).EV(5), 20*Deg, 30*Deg, O), geom.ComposeLR(geom.Pitch(30*Deg), geom.Translate(V(2, 2.5, 2)))),
+		},
+		Objects: []Object{
+			Rectangle(Matte(texture.Checkers(1, 1, Gray(0.7), Gray(0.3))), 8, 8, O),
+			Sphere(Matte(LoadTexture("../assets/monalisa.jpg").Scale(2, 1)), 1, V(-1.3, 0.5, 0)).RotateAt(V(-1.3, 0.5, 0), Ey, 100*Deg),
+			Box(gold, 0.9, 0.9, 0.9, V(0, 0.45, -0.3)).AndNot(Sphere(gold, 1.15, V(0, 0.45, -0.3))),
+			PlyFile(Shiny(Red, 0.1), "../assets/bunny_res4.ply").ScaleToSize(1).WithCenterBottom(V(1.3, 0, 0.2)),
+			CylinderWithCaps(materials.TwoSided(Refractive(1.5), Flat(Blue)), 0.3, 0.6, V(-0.4, 0.3, 1)),
+		},
+		Media:       []Medium{ExpFog(0.02, Gray(0.5), 2)},
+		PostProcess: post.Params{ToneMap: post.ToneMapParams{Operator: post.ACES, Exposure: 0.5}},
+	}
+
+	dir, err := ioutil.TempDir("", "bruteray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "scene.json")
+	if err := SaveSpec(file, s); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := LoadSpec(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// data files are named after the scene file, and shared data is written only once
+	want := []string{"scene.json", "scene.mesh1.ply", "scene.mesh2.ply", "scene.texture1.pfm"}
+	if got, _ := filepath.Glob(filepath.Join(dir, "*")); len(got) != len(want) {
+		t.Errorf("got files %v, want %v", got, want)
+	}
+
+	var b1, b2 bytes.Buffer
+	if err := WriteSpec(&b1, s, describe.NewEncoder(dir, "scene")); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteSpec(&b2, s2, describe.NewEncoder(dir, "scene")); err != nil {
+		t.Fatal(err)
+	}
+	if b1.String() != b2.String() {
+		t.Errorf("saving a loaded scene gives a different scene file:\n%v\nwant:\n%v", b2.String(), b1.String())
+	}
+
+	// meshes may also be saved as OBJ files
+	objDir := filepath.Join(dir, "obj")
+	if err := os.Mkdir(objDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	e := describe.NewEncoder(objDir, "scene")
+	e.MeshFormat = "obj"
+	var b3 bytes.Buffer
+	if err := WriteSpec(&b3, s, e); err != nil {
+		t.Fatal(err)
+	}
+	s3, err := ParseSpec(&b3, objDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s3.Objects) != len(s.Objects) {
+		t.Errorf("OBJ: got %v objects, want %v", len(s3.Objects), len(s.Objects))
+	}
+
+	test.NPassSize(t, s2.Scene(), s2.Camera, 10, 240, 135, test.DefaultTolerance)
+}
+
+func TestSaveSpec_Errors(t *testing.T) {
+	s := Spec{Objects: []Object{Sphere(Matte(White), 1, O), IsoSurface(Matte(White), 1, 1, 1, func(u, v float64) float64 { return 0 })}}
+	err := WriteSpec(ioutil.Discard, s, describe.NewEncoder(".", "scene"))
+	if err == nil || !strings.Contains(err.Error(), "objects[1]: describe: cannot describe") {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
@@ -14,8 +15,6 @@ import (
 	//. "github.com/barnex/bruteray/tracer/types"
 )
 
-//TODO: cancel bakery only, not preview
-
 func Serve(addr string, spec Spec) error {
 	s := newServer(addr, spec)
 	return s.listenAndServe()
@@ -27,7 +26,7 @@ type server struct {
 	httpServer http.Server
 
 	mu        sync.Mutex
-	cancel    chan struct{}
+	cancel    context.CancelFunc // non-nil while baking
 	smplr     *tracer.Sampler
 	smplrView View // View currently being rendred by smplr
 	smplrNum  int
@@ -46,6 +45,7 @@ func newServer(addr string, spec Spec) *server {
 	s.handle("/preview", s.handlePreview)
 	s.handle("/bake", s.handleBake)
 	s.handle("/cancel", s.handleCancel)
+	s.handle("/stats", s.handleStats)
 	return s
 
 }
@@ -70,8 +70,8 @@ func (s *server) handleBake(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
-	// (2) Render (may return "canceled" error)
-	img, err := s.renderView(v)
+	// (2) Render (returns the partially baked image if canceled)
+	img, err := s.renderView(r.Context(), v)
 	if err != nil {
 		return err
 	}
@@ -94,35 +94,36 @@ func (s *server) renderPreview(v View) imagef.Image {
 	return img
 }
 
-func (s *server) renderView(v View) (imagef.Image, error) {
-	cancel, err := s.prepareBakery(v)
+// renderView bakes the view, adding progressively more passes on each call with the same view.
+// When canceled, either via /cancel or because the client went away,
+// renderView returns immediately with the image accumulated so far.
+func (s *server) renderView(c context.Context, v View) (imagef.Image, error) {
+	c, err := s.prepareBakery(c, v)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { // wrong
+	defer func() {
 		s.mu.Lock()
 		defer s.mu.Unlock()
+		s.cancel()
 		s.cancel = nil
 		s.smplrNum++
 	}()
 
-	s.smplr.SampleWithCancel(s.smplrNum, cancel)
-	img := s.smplr.Image()
-
-	if img == nil {
-		return nil, errors.New("baking cancelled")
+	if err := s.smplr.SampleContext(c, s.smplrNum); err != nil {
+		log.Println("bake:", err)
 	}
-	return img, nil
+	return s.smplr.Image(), nil
 }
 
-func (s *server) prepareBakery(v View) (chan struct{}, error) {
+func (s *server) prepareBakery(c context.Context, v View) (context.Context, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.cancel != nil {
 		return nil, errors.New("already baking")
 	}
-	s.cancel = make(chan struct{})
+	c, s.cancel = context.WithCancel(c)
 
 	if s.smplr == nil || s.smplrView != v {
 		spec := v.ApplyTo(s.spec)
@@ -131,20 +132,45 @@ func (s *server) prepareBakery(v View) (chan struct{}, error) {
 		s.smplrNum = 1
 	}
 
-	return s.cancel, nil
+	return c, nil
 }
 
+// handleCancel stops the bake in progress, if any.
+// The bake request then returns the partially baked image.
 func (s *server) handleCancel(w http.ResponseWriter, r *http.Request) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.cancel == nil {
 		return nil // already done
 	}
-	close(s.cancel)
-	s.cancel = nil
+	s.cancel()
 	return nil
 }
 
+// handleStats responds with the performance counters (JSON)
+// of the last completed bake, accumulated over all bakes of the current view.
+// A bake in progress only adds its counters when it completes or is canceled.
+func (s *server) handleStats(w http.ResponseWriter, r *http.Request) error {
+	s.mu.Lock()
+	smplr := s.smplr
+	s.mu.Unlock()
+
+	var resp statsResponse
+	if smplr != nil {
+		resp.Stats = smplr.Stats()
+		resp.RaysPerSecond = resp.Stats.RaysPerSecond()
+		resp.SamplesPerPixel = smplr.SamplesPerPixel()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(resp)
+}
+
+type statsResponse struct {
+	tracer.Stats
+	RaysPerSecond   float64
+	SamplesPerPixel float64
+}
+
 func (s *server) handle(prefix string, h handler) {
 	s.mux.Handle(prefix, h)
 }
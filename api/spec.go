@@ -21,6 +21,27 @@ type Spec struct {
 	Recursion int
 	NumPass   int
 
+	// LightSelection determines how light sources are sampled,
+	// e.g. tracer.SampleLightTree for scenes with many lights.
+	// See tracer.Scene.SetLightSelection.
+	LightSelection tracer.LightSelection
+
+	// If NoiseThreshold > 0, sampling is adaptive: pixels stop receiving passes
+	// once their standard error (in sRGB brightness) drops below NoiseThreshold.
+	// NumPass is then the budget: the maximum number of passes per pixel.
+	// See tracer.Sampler.SampleAdaptive.
+	NoiseThreshold float64
+
+	// If CheckpointEvery > 0, the render state is saved to a checkpoint file
+	// (output file name with extension .checkpoint) every CheckpointEvery passes,
+	// and when done. Rendering can be resumed from there with flag -resume.
+	CheckpointEvery int
+
+	// AOVs lists the additional images to render alongside the color
+	// (e.g. tracer.AOVDepth, tracer.AOVLight(0)).
+	// Each is saved to its own file, e.g. out.depth.png.
+	AOVs []string
+
 	Width  int
 	Height int
 
@@ -43,7 +64,9 @@ func (s *Spec) Scene() *tracer.Scene {
 	for i := range objs {
 		objs[i] = s.Objects[i].Interface
 	}
-	return tracer.NewSceneWithMedia(s.Recursion, s.Media, s.Lights, objs...)
+	scene := tracer.NewSceneWithMedia(s.Recursion, s.Media, s.Lights, objs...)
+	scene.SetLightSelection(s.LightSelection)
+	return scene
 }
 
 // TODO: remove!!!! aargh
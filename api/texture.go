@@ -1,6 +1,9 @@
 package api
 
-import "github.com/barnex/bruteray/texture"
+import (
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/texture"
+)
 
 type Texture struct {
 	texture.Texture
@@ -23,3 +26,8 @@ func (t Texture) HeightMap() func(u, v float64) float64 {
 		return t.Texture.At(Vec{u, v, 0}).R
 	}
 }
+
+// Describe implements describe.Describer.
+func (t Texture) Describe(e *describe.Encoder) interface{} {
+	return e.Describe(t.Texture)
+}
@@ -0,0 +1,61 @@
+// Command bruteray renders a scene description file (see api.ParseSpec for the format).
+// Usage:
+// 	bruteray [flags] scene.json
+// The flags are those understood by api.Render, e.g.:
+// 	bruteray -n 10 -w 480 -h 270 scene.json   // quick preview
+// 	bruteray -o scene.png scene.json
+// The output file defaults to the scene file name, with extension .jpeg.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/barnex/bruteray/api"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bruteray [flags] scene.json")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	fname := flag.Arg(0)
+
+	if !isSet("o") {
+		base := path.Base(fname)
+		check(flag.Set("o", base[:len(base)-len(path.Ext(base))]+".jpeg"))
+	}
+
+	spec, err := api.LoadSpec(fname)
+	check(err)
+	api.Render(spec)
+}
+
+// isSet returns true if flag name was set on the command line.
+func isSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func check(e error) {
+	if e != nil {
+		fatal(e)
+	}
+}
+
+func fatal(x ...interface{}) {
+	fmt.Fprintln(os.Stderr, x...)
+	os.Exit(1)
+}
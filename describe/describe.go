@@ -0,0 +1,229 @@
+// Package describe turns scene elements (objects, materials, textures, lights, cameras, media)
+// back into descriptions in the scene file format read by api.ParseSpec.
+// This way, scenes built in Go can be saved (see api.SaveSpec), e.g. for archiving,
+// for comparing versions of a render setup, or for rendering with command bruteray.
+//
+// Scene elements describe themselves by implementing Describer,
+// like the built-in implementations in packages objects, materials, texture, lights, cameras and media do.
+// Elements defined by arbitrary Go functions (e.g. texture.Func, objects.IsoSurface) cannot be described.
+package describe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/imagef/pfm"
+)
+
+// A Describer can describe itself in the scene file format.
+type Describer interface {
+	// Describe returns a JSON value (typically a Node) from which the scene file parser
+	// constructs an equivalent element. Nested elements are described with e.Describe,
+	// large data (meshes, images) is written to separate files with e.File.
+	Describe(e *Encoder) interface{}
+}
+
+// A Node describes a scene element as a JSON object: its "type",
+// and properties named after the constructor's arguments. E.g.:
+// 	Node{"type": "sphere", "diam": 1.0, "center": Vec{0, 1, 0}, "material": ...}
+type Node map[string]interface{}
+
+// MarshalJSON encodes the type first, followed by the other properties in alphabetical order,
+// so that descriptions are readable, and can be compared with diff.
+func (n Node) MarshalJSON() ([]byte, error) {
+	keys := make([]string, 0, len(n))
+	for k := range n {
+		if k != "type" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := n["type"]; ok {
+		keys = append([]string{"type"}, keys...)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		value, err := json.Marshal(n[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Color describes a color as [r, g, b], or as a single number if gray.
+func Color(c colorf.Color) interface{} {
+	if c.R == c.G && c.G == c.B {
+		return c.R
+	}
+	return [3]float64{c.R, c.G, c.B}
+}
+
+// Degrees converts an angle from radians to degrees, as used in scene files.
+// The result is rounded to 9 decimals, so that angles survive a round trip
+// through radians unchanged (e.g. 30 rather than 29.999999999999996).
+func Degrees(radians float64) float64 {
+	return math.Round(radians/geom.Deg*1e9) / 1e9
+}
+
+// Transform describes an affine transformation as a list of transform operations:
+// a translation, or a matrix with 3 rows of 4 elements (the linear part followed by the translation).
+func Transform(t *geom.AffineTransform) []Node {
+	if t.A == geom.UnitMatrix() {
+		return []Node{{"translate": t.B}}
+	}
+	var m [3][4]float64
+	for i := range m {
+		for j := 0; j < 3; j++ {
+			m[i][j] = t.A[j][i] // t.A is stored column-major
+		}
+		m[i][3] = t.B[i]
+	}
+	return []Node{{"matrix": m}}
+}
+
+// WithTransform adds transform t to a description of an object or light,
+// after the transforms it may already have.
+func WithTransform(desc interface{}, t *geom.AffineTransform) interface{} {
+	n, ok := desc.(Node)
+	if !ok {
+		return desc // nil (error already recorded), or not transformable (e.g. a color)
+	}
+	prev, _ := n["transform"].([]Node)
+	n["transform"] = append(prev, Transform(t)...)
+	return n
+}
+
+// An Encoder holds the state needed to describe a scene:
+// where to write data files, which have already been written,
+// and the first error that occurred.
+type Encoder struct {
+	// MeshFormat is the file format for triangle meshes: "ply" (default) or "obj".
+	// OBJ files cannot hold vertex colors, meshes with vertex colors are always written as PLY.
+	MeshFormat string
+
+	dir    string                 // directory where data files are written
+	prefix string                 // file name prefix of data files
+	files  map[interface{}]string // data files written so far, by key
+	count  map[string]int         // number of data files written so far, by kind
+	err    error
+}
+
+// NewEncoder returns an Encoder that writes data files to directory dir,
+// with names starting with prefix. E.g.:
+// 	NewEncoder("scenes", "kitchen") // writes scenes/kitchen.mesh1.ply, scenes/kitchen.texture1.pfm, ...
+func NewEncoder(dir, prefix string) *Encoder {
+	return &Encoder{
+		dir:    dir,
+		prefix: prefix,
+		files:  make(map[interface{}]string),
+		count:  make(map[string]int),
+	}
+}
+
+// Describe returns the description of x, which is a Describer or a color.
+// If x cannot be described, nil is returned and the error is recorded (see Err).
+// A nil x is described as nil.
+func (e *Encoder) Describe(x interface{}) interface{} {
+	switch x := x.(type) {
+	case nil:
+		return nil
+	case colorf.Color:
+		return Color(x)
+	case Describer:
+		return x.Describe(e)
+	default:
+		e.Errorf("cannot describe %T", x)
+		return nil
+	}
+}
+
+// File writes data that is too large for the scene file (e.g. a mesh or an image)
+// to a separate file, and returns its name relative to the scene file.
+// The name is made from the encoder's prefix and the given kind and extension,
+// e.g. File(mesh, "mesh.ply", ...) writes "prefix.mesh1.ply".
+//
+// Key identifies the data (e.g. a pointer to it), so that data shared by several
+// scene elements is only written once.
+func (e *Encoder) File(key interface{}, kind string, write func(w io.Writer) error) string {
+	if name, ok := e.files[key]; ok {
+		return name
+	}
+	ext := filepath.Ext(kind)
+	kind = strings.TrimSuffix(kind, ext)
+	e.count[kind]++
+	name := fmt.Sprintf("%v.%v%v%v", e.prefix, kind, e.count[kind], ext)
+	if err := writeFile(filepath.Join(e.dir, name), write); err != nil {
+		e.setErr(err)
+	}
+	e.files[key] = name
+	return name
+}
+
+// Image writes img to a PFM file, which holds linear, unclipped colors like imagef.Image,
+// and returns its name (see File). E.g.:
+// 	Image(img, "texture") // writes "prefix.texture1.pfm"
+func (e *Encoder) Image(img imagef.Image, kind string) string {
+	if img.NumPixels() == 0 {
+		e.Errorf("empty image")
+		return ""
+	}
+	// the pixel storage identifies the image, so that shared images are written once
+	return e.File(&img[0][0], kind+".pfm", func(w io.Writer) error {
+		// pfm.Encode wants the top row first, imagef.Image has the bottom row first.
+		rows := make([][]colorf.Color, len(img))
+		for i := range img {
+			rows[len(img)-1-i] = img[i]
+		}
+		return pfm.Encode(w, rows)
+	})
+}
+
+func writeFile(fname string, write func(w io.Writer) error) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Errorf records an error, e.g. when an element cannot be described.
+// Only the first error is kept.
+func (e *Encoder) Errorf(format string, x ...interface{}) {
+	e.setErr(fmt.Errorf("describe: "+format, x...))
+}
+
+func (e *Encoder) setErr(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Err returns the first error that occurred, if any.
+func (e *Encoder) Err() error {
+	return e.err
+}
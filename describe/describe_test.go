@@ -0,0 +1,54 @@
+package describe
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef/colorf"
+)
+
+func TestNode_MarshalJSON(t *testing.T) {
+	n := Node{"material": 0.5, "diam": 1.0, "type": "sphere", "center": geom.Vec{0, 1, 0}}
+	b, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"type":"sphere","center":[0,1,0],"diam":1,"material":0.5}`; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	e := NewEncoder(".", "test")
+	for _, c := range []struct {
+		x    interface{}
+		want string
+	}{
+		{nil, `null`},
+		{colorf.Gray(0.5), `0.5`},
+		{colorf.Red, `[1,0,0]`},
+		{Transform(geom.Translate(geom.Vec{1, 2, 3})), `[{"translate":[1,2,3]}]`},
+		{Transform(geom.Scale(geom.Vec{}, 2)), `[{"matrix":[[2,0,0,0],[0,2,0,0],[0,0,2,0]]}]`},
+		{Degrees(30 * geom.Deg), `30`},
+	} {
+		var desc interface{} = c.x
+		if _, ok := c.x.(colorf.Color); ok || c.x == nil {
+			desc = e.Describe(c.x)
+		}
+		b, err := json.Marshal(desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.want {
+			t.Errorf("%v: got %s, want %v", c.x, b, c.want)
+		}
+	}
+	if e.Err() != nil {
+		t.Errorf("unexpected error: %v", e.Err())
+	}
+	e.Describe(struct{}{})
+	if e.Err() == nil {
+		t.Errorf("expected error")
+	}
+}
@@ -93,12 +93,11 @@ func (a Vec) Cross(b Vec) Vec {
 // mutually orthogonal.
 func MakeBasis(x Vec) (y, z Vec) {
 	x.Normalize()
-
-	//y = x
-	//y[argMin(y)] = 1
-	//y.Normalize()
-	panic("todo")
-
+	t := x
+	t[argMin(t)] = 1
+	y = t.Cross(x).Normalized()
+	z = x.Cross(y)
+	return y, z
 }
 
 func argMin(v Vec) int {
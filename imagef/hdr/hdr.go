@@ -0,0 +1,200 @@
+// Package hdr provides support for images in the Radiance RGBE (.hdr) format,
+// as described by https://en.wikipedia.org/wiki/RGBE_image_format.
+//
+// RGBE stores linear, unclipped colors with a shared 8-bit exponent.
+// This is the most common format for HDR environment maps.
+// Images are represented as rows of colors, top row first.
+// This package does not depend on package imagef (which uses it for loading),
+// but imagef.Image can be passed to Encode, and is assignable from Decode's result.
+package hdr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/barnex/bruteray/imagef/colorf"
+)
+
+const format = "32-bit_rle_rgbe"
+
+// Encode writes img as a Radiance RGBE image.
+// Scanlines are stored flat (without run-length encoding).
+func Encode(w io.Writer, img [][]colorf.Color) error {
+	width, height := size(img)
+	if _, err := fmt.Fprintf(w, "#?RADIANCE\nFORMAT=%v\n\n-Y %v +X %v\n", format, height, width); err != nil {
+		return err
+	}
+	buf := make([]byte, 4*width)
+	for _, row := range img {
+		for ix, c := range row {
+			rgbe := toRGBE(c)
+			copy(buf[4*ix:], rgbe[:])
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads a Radiance RGBE image, with flat or run-length encoded scanlines.
+// Only the standard orientation (-Y height +X width) is supported.
+func Decode(r io.Reader) ([][]colorf.Color, error) {
+	in := bufio.NewReader(r)
+
+	// header: lines of text, terminated by an empty line.
+	magic, err := in.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("hdr: read header: %v", err)
+	}
+	if !strings.HasPrefix(magic, "#?") {
+		return nil, errors.New("hdr: not a Radiance file")
+	}
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("hdr: read header: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT="+format {
+			return nil, fmt.Errorf("hdr: unsupported %v", line)
+		}
+	}
+
+	var width, height int
+	resolution, err := in.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("hdr: read resolution: %v", err)
+	}
+	if _, err := fmt.Sscanf(resolution, "-Y %d +X %d", &height, &width); err != nil {
+		return nil, fmt.Errorf("hdr: unsupported resolution string %q", strings.TrimSpace(resolution))
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("hdr: bad size %vx%v", width, height)
+	}
+
+	img := makeImage(width, height)
+	scanline := make([]byte, 4*width)
+	for iy := range img {
+		if err := readScanline(in, scanline); err != nil {
+			return nil, fmt.Errorf("hdr: read scanline %v: %v", iy, err)
+		}
+		for ix := range img[iy] {
+			img[iy][ix] = fromRGBE(scanline[4*ix:])
+		}
+	}
+	return img, nil
+}
+
+// readScanline reads one scanline of RGBE pixels into dst (4 bytes per pixel).
+func readScanline(in *bufio.Reader, dst []byte) error {
+	width := len(dst) / 4
+	head, err := in.Peek(4)
+	if err != nil {
+		return err
+	}
+
+	// Run-length encoded scanlines start with 2, 2, followed by the width.
+	// Otherwise, the scanline is flat.
+	isRLE := width >= 8 && width < 0x8000 && head[0] == 2 && head[1] == 2 && head[2]&0x80 == 0
+	if !isRLE {
+		_, err := io.ReadFull(in, dst)
+		return err
+	}
+	if n := int(head[2])<<8 | int(head[3]); n != width {
+		return fmt.Errorf("run-length encoded width %v, want %v", n, width)
+	}
+	if _, err := in.Discard(4); err != nil {
+		return err
+	}
+
+	// The four components are stored separately, each run-length encoded.
+	for c := 0; c < 4; c++ {
+		for ix := 0; ix < width; {
+			count, err := in.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 { // run
+				n := int(count - 128)
+				if ix+n > width {
+					return errors.New("bad run length")
+				}
+				v, err := in.ReadByte()
+				if err != nil {
+					return err
+				}
+				for ; n > 0; n-- {
+					dst[4*ix+c] = v
+					ix++
+				}
+			} else { // literal
+				n := int(count)
+				if n == 0 || ix+n > width {
+					return errors.New("bad literal length")
+				}
+				for ; n > 0; n-- {
+					v, err := in.ReadByte()
+					if err != nil {
+						return err
+					}
+					dst[4*ix+c] = v
+					ix++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// toRGBE converts a linear color to 8-bit mantissas with a shared exponent.
+// Negative components are clipped to zero.
+func toRGBE(c colorf.Color) [4]byte {
+	r, g, b := math.Max(c.R, 0), math.Max(c.G, 0), math.Max(c.B, 0)
+	v := math.Max(r, math.Max(g, b))
+	if v < 1e-32 || math.IsNaN(v) {
+		return [4]byte{}
+	}
+	m, e := math.Frexp(v)
+	if e > 127 {
+		return [4]byte{255, 255, 255, 255} // overflow
+	}
+	scale := m * 256 / v
+	return [4]byte{byte(r * scale), byte(g * scale), byte(b * scale), byte(e + 128)}
+}
+
+// fromRGBE is the inverse of toRGBE.
+func fromRGBE(rgbe []byte) colorf.Color {
+	if rgbe[3] == 0 {
+		return colorf.Color{}
+	}
+	f := math.Ldexp(1, int(rgbe[3])-(128+8))
+	return colorf.Color{
+		R: float64(rgbe[0]) * f,
+		G: float64(rgbe[1]) * f,
+		B: float64(rgbe[2]) * f,
+	}
+}
+
+func size(img [][]colorf.Color) (width, height int) {
+	if len(img) == 0 {
+		return 0, 0
+	}
+	return len(img[0]), len(img)
+}
+
+func makeImage(w, h int) [][]colorf.Color {
+	list := make([]colorf.Color, w*h)
+	img := make([][]colorf.Color, h)
+	for i := range img {
+		img[i] = list[i*w : (i+1)*w]
+	}
+	return img
+}
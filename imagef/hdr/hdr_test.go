@@ -0,0 +1,66 @@
+package hdr_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/imagef/hdr"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+func TestRoundTrip(t *testing.T) {
+	img := testImg()
+	var b bytes.Buffer
+	if err := hdr.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	got, err := hdr.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for iy := range img {
+		for ix := range img[iy] {
+			// 8-bit mantissa: relative error of the brightest component below 1/128
+			want := img[iy][ix]
+			tol := math.Max(want.R, math.Max(want.G, want.B)) / 128
+			g := got[iy][ix]
+			if math.Abs(g.R-want.R) > tol || math.Abs(g.G-want.G) > tol || math.Abs(g.B-want.B) > tol {
+				t.Fatalf("pixel %v,%v: got %v, want %v", ix, iy, g, want)
+			}
+		}
+	}
+}
+
+func TestDecode_RLE(t *testing.T) {
+	// 8x1 image, run-length encoded: R, G, B each a run of 8 bytes 128,
+	// E: a literal of 8 bytes 129.
+	data := []byte("#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y 1 +X 8\n" +
+		"\x02\x02\x00\x08" +
+		"\x88\x80" +
+		"\x88\x80" +
+		"\x88\x80" +
+		"\x08\x81\x81\x81\x81\x81\x81\x81\x81")
+	img, err := hdr.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ix := range img[0] {
+		if got, want := img[0][ix], (Color{1, 1, 1}); got != want {
+			t.Errorf("pixel %v: got %v, want %v", ix, got, want)
+		}
+	}
+}
+
+// testImg has values well outside [0..1], which must not be clipped.
+func testImg() imagef.Image {
+	const W, H = 30, 20
+	img := imagef.MakeImage(W, H)
+	for i := 0; i < W; i++ {
+		for j := 0; j < H; j++ {
+			img[j][i] = Color{R: float64(i) * 16, G: float64(j) / 16, B: 1000}
+		}
+	}
+	return img
+}
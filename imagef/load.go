@@ -3,10 +3,15 @@ package imagef
 import (
 	"bufio"
 	"image"
+	"io"
 	"log"
 	"os"
+	"path"
+	"strings"
 
 	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/imagef/hdr"
+	"github.com/barnex/bruteray/imagef/pfm"
 
 	_ "image/jpeg"
 	_ "image/png"
@@ -20,27 +25,50 @@ func MustLoad(fname string) Image {
 	return img
 }
 
+// Load reads an image file (JPEG, PNG, or one of the HDR formats
+// PFM (.pfm) and Radiance RGBE (.hdr), selected by extension).
+// The bottom row is returned first.
+//
+// colorspace converts 8/16-bit values to linear intensities
+// (default: colorf.SRGBToLinear). It is ignored for HDR formats,
+// which already hold linear intensities.
 func Load(fname string, colorspace func(float64) float64) (Image, error) {
-	if colorspace == nil {
-		colorspace = colorf.SRGBToLinear
-	}
 	f, err := os.Open(fname)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
-	srgb, _, err := image.Decode(bufio.NewReader(f))
+
+	switch strings.ToLower(path.Ext(fname)) {
+	case ".pfm":
+		return flipped(pfm.Decode(bufio.NewReader(f)))
+	case ".hdr":
+		return flipped(hdr.Decode(bufio.NewReader(f)))
+	}
+
+	return Decode(bufio.NewReader(f), colorspace)
+}
+
+// Decode reads a JPEG or PNG image from r, e.g. an image embedded in another file.
+// Like Load, the bottom row is returned first,
+// and colorspace converts the 8/16-bit values to linear intensities (default: colorf.SRGBToLinear).
+func Decode(r io.Reader, colorspace func(float64) float64) (Image, error) {
+	if colorspace == nil {
+		colorspace = colorf.SRGBToLinear
+	}
+	srgb, _, err := image.Decode(r)
 	if err != nil {
 		return nil, err
 	}
 
-	w := srgb.Bounds().Dx()
-	h := srgb.Bounds().Dy()
+	bounds := srgb.Bounds()
+	w := bounds.Dx()
+	h := bounds.Dy()
 	img := MakeImage(w, h)
 
 	for y := 0; y < h; y++ {
 		for x := 0; x < w; x++ {
-			r, g, b, _ := srgb.At(x, y).RGBA()
+			r, g, b, _ := srgb.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
 			Y := h - 1 - y
 			img[Y][x] = colorf.Color{
 				colorspace(float64(r) / 0xffff),
@@ -52,4 +80,16 @@ func Load(fname string, colorspace func(float64) float64) (Image, error) {
 	return img, nil
 }
 
+// flipped turns a decoded image upside down,
+// so that its bottom row comes first (like images returned by Load).
+func flipped(img [][]colorf.Color, err error) (Image, error) {
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(img)-1; i < j; i, j = i+1, j-1 {
+		img[i], img[j] = img[j], img[i]
+	}
+	return img, nil
+}
+
 func Linear(s float64) float64 { return s }
@@ -0,0 +1,118 @@
+// Package pfm provides support for images in the Portable Float Map format,
+// as defined by http://www.pauldebevec.com/Research/HDR/PFM/.
+//
+// PFM stores linear, unclipped 32-bit floating-point colors.
+// Images are represented as rows of colors, top row first.
+// This package does not depend on package imagef (which uses it for loading),
+// but imagef.Image can be passed to Encode, and is assignable from Decode's result.
+package pfm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/barnex/bruteray/imagef/colorf"
+)
+
+// Encode writes img as a color PFM image (little-endian).
+func Encode(w io.Writer, img [][]colorf.Color) error {
+	width, height := size(img)
+	// negative scale means little-endian
+	if _, err := fmt.Fprintf(w, "PF\n%v %v\n-1.0\n", width, height); err != nil {
+		return err
+	}
+
+	// rows are stored bottom-to-top
+	buf := make([]byte, 12*width)
+	for iy := height - 1; iy >= 0; iy-- {
+		for ix, c := range img[iy] {
+			b := buf[12*ix:]
+			binary.LittleEndian.PutUint32(b[0:], math.Float32bits(float32(c.R)))
+			binary.LittleEndian.PutUint32(b[4:], math.Float32bits(float32(c.G)))
+			binary.LittleEndian.PutUint32(b[8:], math.Float32bits(float32(c.B)))
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads a color ("PF") or grayscale ("Pf") PFM image.
+// The top row is returned first.
+func Decode(r io.Reader) ([][]colorf.Color, error) {
+	in := bufio.NewReader(r)
+
+	var (
+		format        string
+		width, height int
+		scale         float64
+	)
+	if _, err := fmt.Fscan(in, &format, &width, &height, &scale); err != nil {
+		return nil, fmt.Errorf("pfm: read header: %v", err)
+	}
+	// exactly one whitespace character separates the header from the data
+	if _, err := in.ReadByte(); err != nil {
+		return nil, fmt.Errorf("pfm: read header: %v", err)
+	}
+
+	var numChan int
+	switch format {
+	case "PF":
+		numChan = 3
+	case "Pf":
+		numChan = 1
+	default:
+		return nil, fmt.Errorf("pfm: bad format %q", format)
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("pfm: bad size %vx%v", width, height)
+	}
+	if scale == 0 {
+		return nil, errors.New("pfm: bad scale 0")
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+
+	img := makeImage(width, height)
+	buf := make([]byte, 4*numChan*width)
+	for iy := height - 1; iy >= 0; iy-- {
+		if _, err := io.ReadFull(in, buf); err != nil {
+			return nil, fmt.Errorf("pfm: read data: %v", err)
+		}
+		for ix := range img[iy] {
+			var v [3]float64
+			for c := 0; c < numChan; c++ {
+				v[c] = float64(math.Float32frombits(order.Uint32(buf[4*(numChan*ix+c):])))
+			}
+			if numChan == 1 {
+				v[1], v[2] = v[0], v[0]
+			}
+			img[iy][ix] = colorf.Color{R: v[0], G: v[1], B: v[2]}
+		}
+	}
+	return img, nil
+}
+
+func size(img [][]colorf.Color) (width, height int) {
+	if len(img) == 0 {
+		return 0, 0
+	}
+	return len(img[0]), len(img)
+}
+
+func makeImage(w, h int) [][]colorf.Color {
+	list := make([]colorf.Color, w*h)
+	img := make([][]colorf.Color, h)
+	for i := range img {
+		img[i] = list[i*w : (i+1)*w]
+	}
+	return img
+}
@@ -0,0 +1,54 @@
+package pfm_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/imagef/pfm"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+func TestRoundTrip(t *testing.T) {
+	img := testImg()
+	var b bytes.Buffer
+	if err := pfm.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pfm.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for iy := range img {
+		for ix := range img[iy] {
+			// values are exactly representable as float32
+			if got[iy][ix] != img[iy][ix] {
+				t.Fatalf("pixel %v,%v: got %v, want %v", ix, iy, got[iy][ix], img[iy][ix])
+			}
+		}
+	}
+}
+
+func TestDecode_Gray(t *testing.T) {
+	// 2x1 grayscale, big-endian: 1.0, 0.5
+	data := []byte("Pf\n2 1\n1.0\n\x3f\x80\x00\x00\x3f\x00\x00\x00")
+	img, err := pfm.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := img[0][1], (Color{0.5, 0.5, 0.5}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// testImg has values well outside [0..1], which must not be clipped.
+func testImg() imagef.Image {
+	const W, H = 30, 20
+	img := imagef.MakeImage(W, H)
+	for i := 0; i < W; i++ {
+		for j := 0; j < H; j++ {
+			img[j][i] = Color{R: float64(i) * 16, G: float64(j) / 16, B: -1}
+		}
+	}
+	return img
+}
@@ -0,0 +1,130 @@
+package post
+
+import (
+	"math"
+
+	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/imagef/colorf"
+)
+
+// DenoiseParams configures Denoise. The zero value disables denoising.
+// Zero-valued sigmas take sensible defaults.
+type DenoiseParams struct {
+	Radius      int     // half-width of the filter window, in pixels. 0 disables denoising
+	SigmaAlbedo float64 // tolerated albedo difference between pixels that are blended (default 0.1)
+	SigmaNormal float64 // tolerated normal vector difference (default 0.3)
+	SigmaDepth  float64 // tolerated relative depth difference (default 0.1)
+	SigmaColor  float64 // tolerated color difference, in units of the standard error (default 2)
+}
+
+// Features are auxiliary images that guide denoising.
+// Albedo, Normal and Depth hold the first surface seen in each pixel
+// (see tracer.Sampler.EnableFeatures). StdErr holds the noise level
+// of each pixel (see tracer.Sampler.StdErr).
+type Features struct {
+	Albedo imagef.Image
+	Normal imagef.Image // X, Y, Z components stored as R, G, B
+	Depth  imagef.Image // stored in all three channels
+	StdErr imagef.Image
+}
+
+// Denoise returns a copy of img where noise has been removed by a joint bilateral filter:
+// each pixel is replaced by a weighted average over the window around it.
+// The weights decrease with distance, but also with differences in albedo, normal and depth,
+// so that features like edges and textures are preserved.
+// Finally, pixels whose colors differ by significantly more than their
+// standard error are not blended, which preserves features (e.g. shadow borders)
+// that have already converged.
+func Denoise(img imagef.Image, f *Features, p DenoiseParams) imagef.Image {
+	p.setDefaults()
+	w, h := img.Size()
+	dst := imagef.MakeImage(w, h)
+	sigmaSpace := float64(p.Radius) / 2
+
+	for iy := 0; iy < h; iy++ {
+		for ix := 0; ix < w; ix++ {
+			var (
+				acc  colorf.Color
+				norm float64
+			)
+			for jy := max(iy-p.Radius, 0); jy <= min(iy+p.Radius, h-1); jy++ {
+				for jx := max(ix-p.Radius, 0); jx <= min(ix+p.Radius, w-1); jx++ {
+					d2 := float64(sqr(jx-ix) + sqr(jy-iy))
+					weight := math.Exp(-d2/(2*sqr64(sigmaSpace))) * p.weight(img, f, ix, iy, jx, jy)
+					acc = acc.MAdd(weight, img[jy][jx])
+					norm += weight
+				}
+			}
+			// norm > 0 because a pixel always has weight 1 with respect to itself.
+			dst[iy][ix] = acc.Mul(1 / norm)
+		}
+	}
+	return dst
+}
+
+// weight returns the similarity (0..1) between pixels i and j, based on their features.
+func (p *DenoiseParams) weight(img imagef.Image, f *Features, ix, iy, jx, jy int) float64 {
+	exponent := 0.
+
+	// albedo
+	exponent += dist2(f.Albedo[iy][ix], f.Albedo[jy][jx]) / (2 * sqr64(p.SigmaAlbedo))
+
+	// normal
+	exponent += dist2(f.Normal[iy][ix], f.Normal[jy][jx]) / (2 * sqr64(p.SigmaNormal))
+
+	// depth, relative
+	di, dj := f.Depth[iy][ix].R, f.Depth[jy][jx].R
+	if scale := math.Max(di, dj); scale > 0 {
+		exponent += sqr64((di-dj)/scale) / (2 * sqr64(p.SigmaDepth))
+	}
+
+	// color, relative to the noise level
+	ei, ej := f.StdErr[iy][ix], f.StdErr[jy][jx]
+	variance := sqr64(ei.R) + sqr64(ei.G) + sqr64(ei.B) + sqr64(ej.R) + sqr64(ej.G) + sqr64(ej.B)
+	if variance == 0 {
+		if img[iy][ix] != img[jy][jx] {
+			return 0 // converged and different
+		}
+	} else if !math.IsInf(variance, 0) {
+		exponent += dist2(img[iy][ix], img[jy][jx]) / (2 * sqr64(p.SigmaColor) * variance)
+	}
+
+	return math.Exp(-exponent)
+}
+
+func (p *DenoiseParams) setDefaults() {
+	if p.SigmaAlbedo == 0 {
+		p.SigmaAlbedo = 0.1
+	}
+	if p.SigmaNormal == 0 {
+		p.SigmaNormal = 0.3
+	}
+	if p.SigmaDepth == 0 {
+		p.SigmaDepth = 0.1
+	}
+	if p.SigmaColor == 0 {
+		p.SigmaColor = 2
+	}
+}
+
+// dist2 returns the squared distance between colors a and b.
+func dist2(a, b colorf.Color) float64 {
+	return sqr64(a.R-b.R) + sqr64(a.G-b.G) + sqr64(a.B-b.B)
+}
+
+func sqr(x int) int           { return x * x }
+func sqr64(x float64) float64 { return x * x }
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,55 @@
+package post
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/barnex/bruteray/imagef"
+)
+
+// Denoise must reduce noise in flat regions,
+// but preserve edges present in the albedo.
+func TestDenoise(t *testing.T) {
+	const w, h = 40, 30
+	const noise = 0.1
+	rng := rand.New(rand.NewSource(1))
+
+	img := imagef.MakeImage(w, h)
+	f := &Features{
+		Albedo: imagef.MakeImage(w, h),
+		Normal: imagef.MakeImage(w, h),
+		Depth:  imagef.MakeImage(w, h),
+		StdErr: imagef.MakeImage(w, h),
+	}
+	for iy := 0; iy < h; iy++ {
+		for ix := 0; ix < w; ix++ {
+			a := 0.2 // left half dark, right half bright
+			if ix >= w/2 {
+				a = 0.8
+			}
+			f.Albedo[iy][ix] = C(a, a, a)
+			f.Normal[iy][ix] = C(0, 0, 1)
+			f.Depth[iy][ix] = C(1, 1, 1)
+			f.StdErr[iy][ix] = C(noise, noise, noise)
+			v := a + noise*rng.NormFloat64()
+			img[iy][ix] = C(v, v, v)
+		}
+	}
+
+	dst := Denoise(img, f, DenoiseParams{Radius: 3})
+
+	var errBefore, errAfter float64
+	for iy := 0; iy < h; iy++ {
+		for ix := 0; ix < w; ix++ {
+			want := f.Albedo[iy][ix].R
+			errBefore += sqr64(img[iy][ix].R - want)
+			errAfter += sqr64(dst[iy][ix].R - want)
+		}
+	}
+	errBefore = math.Sqrt(errBefore / (w * h))
+	errAfter = math.Sqrt(errAfter / (w * h))
+	if errAfter > errBefore/3 {
+		t.Errorf("rms error before: %v, after: %v, want at least 3x smaller", errBefore, errAfter)
+	}
+}
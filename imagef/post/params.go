@@ -1,12 +1,14 @@
-// Package post implements image post-processing effects, like bloom.
+// Package post implements image post-processing effects, like bloom and tone mapping.
 package post
 
 import "github.com/barnex/bruteray/imagef"
 
 type Params struct {
+	Denoise  DenoiseParams // applied first, requires Features (see ApplyToWithFeatures)
 	Gaussian BloomParams
 	Airy     BloomParams
 	Star     BloomParams
+	ToneMap  ToneMapParams // applied after bloom
 }
 
 type BloomParams struct {
@@ -15,7 +17,17 @@ type BloomParams struct {
 	Threshold float64
 }
 
+// ApplyTo applies all post-processing effects in p, except Denoise, to img.
 func (p *Params) ApplyTo(img imagef.Image, pixelSize float64) imagef.Image {
+	return p.ApplyToWithFeatures(img, nil, pixelSize)
+}
+
+// ApplyToWithFeatures is like ApplyTo, but also denoises the image
+// (if p.Denoise is set) using features f.
+func (p *Params) ApplyToWithFeatures(img imagef.Image, f *Features, pixelSize float64) imagef.Image {
+	if d := p.Denoise; d.Radius != 0 && f != nil {
+		img = Denoise(img, f, d)
+	}
 	if b := p.Gaussian; b.Radius != 0 {
 		img = ApplyGaussianBloom(img, pixelSize, b.Radius, b.Amplitude, b.Threshold)
 	}
@@ -25,6 +37,9 @@ func (p *Params) ApplyTo(img imagef.Image, pixelSize float64) imagef.Image {
 	if b := p.Star; b.Radius != 0 {
 		img = ApplyStarBloom(img, pixelSize, b.Radius, b.Amplitude, b.Threshold)
 	}
+	if t := p.ToneMap; !t.isZero() {
+		img = ApplyToneMap(img, t)
+	}
 	return img
 }
 
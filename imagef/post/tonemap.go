@@ -0,0 +1,108 @@
+package post
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/barnex/bruteray/imagef"
+	"github.com/barnex/bruteray/imagef/colorf"
+)
+
+// ToneMapParams specifies how linear intensities are converted to display values.
+// The zero value leaves the image unchanged (intensities above 1 will be clipped when encoded).
+type ToneMapParams struct {
+	Exposure   float64 // exposure correction in EV (stops): intensities are multiplied by 2^Exposure
+	Operator   ToneMap // curve that compresses highlights
+	WhitePoint float64 // intensity (after exposure) that is mapped to 1. 0 means the operator's default
+}
+
+// A ToneMap is a curve that maps linear intensities [0..inf] onto display values [0..1].
+type ToneMap int
+
+const (
+	Clip     ToneMap = iota // no compression: intensities above 1 are clipped.
+	Reinhard                // x/(1+x), or x(1+x/w²)/(1+x) with white point w
+	Filmic                  // John Hable's filmic curve (Uncharted 2). Default white point 11.2
+	ACES                    // Krzysztof Narkowicz' fit of the ACES reference rendering transform
+)
+
+// Default white point for Filmic. Other operators default to an infinite white point,
+// i.e. intensities only approach 1 asymptotically.
+const filmicWhitePoint = 11.2
+
+func (p *ToneMapParams) isZero() bool {
+	return *p == ToneMapParams{}
+}
+
+// ApplyToneMap returns a copy of img with exposure correction
+// and tone mapping operator p applied to each color channel.
+func ApplyToneMap(img imagef.Image, p ToneMapParams) imagef.Image {
+	f := p.curve()
+	exposure := colorf.EV(p.Exposure)
+	img2 := img.Copy()
+	for _, row := range img2 {
+		for i, c := range row {
+			c = c.Mul(exposure)
+			row[i] = colorf.Color{R: f(c.R), G: f(c.G), B: f(c.B)}
+		}
+	}
+	return img2
+}
+
+// curve returns the tone mapping function, normalized to the white point.
+func (p *ToneMapParams) curve() func(float64) float64 {
+	w := p.WhitePoint
+	switch p.Operator {
+	default:
+		panic(fmt.Sprintf("post: unknown tone map operator: %v", p.Operator))
+	case Clip:
+		if w == 0 {
+			return func(x float64) float64 { return x }
+		}
+		return func(x float64) float64 { return x / w }
+	case Reinhard:
+		if w == 0 {
+			return reinhard
+		}
+		return func(x float64) float64 { return reinhard(x) * (1 + x/(w*w)) }
+	case Filmic:
+		if w == 0 {
+			w = filmicWhitePoint
+		}
+		scale := 1 / hable(w)
+		return func(x float64) float64 { return hable(x) * scale }
+	case ACES:
+		if w == 0 {
+			return aces
+		}
+		scale := 1 / aces(w)
+		return func(x float64) float64 { return math.Min(aces(x)*scale, 1) }
+	}
+}
+
+func reinhard(x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return x / (1 + x)
+}
+
+// hable is John Hable's filmic curve,
+// see http://filmicworlds.com/blog/filmic-tonemapping-operators/.
+func hable(x float64) float64 {
+	const A, B, C, D, E, F = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	if x <= 0 {
+		return 0
+	}
+	return ((x*(A*x+C*B) + D*E) / (x*(A*x+B) + D*F)) - E/F
+}
+
+// aces is Krzysztof Narkowicz' fit of the ACES filmic curve,
+// see https://knarkowicz.wordpress.com/2016/01/06/aces-filmic-tone-mapping-curve/.
+func aces(x float64) float64 {
+	const a, b, c, d, e = 2.51, 0.03, 2.43, 0.59, 0.14
+	if x <= 0 {
+		return 0
+	}
+	return math.Min((x*(a*x+b))/(x*(c*x+d)+e), 1)
+}
@@ -0,0 +1,54 @@
+package post
+
+import (
+	"math"
+	"testing"
+
+	"github.com/barnex/bruteray/imagef"
+)
+
+// All tone map curves must map 0 to 0, the white point to 1,
+// and be monotonically increasing.
+func TestToneMap_Curves(t *testing.T) {
+	for _, op := range []ToneMap{Clip, Reinhard, Filmic, ACES} {
+		p := ToneMapParams{Operator: op, WhitePoint: 4}
+		f := p.curve()
+		if got := f(0); got != 0 {
+			t.Errorf("operator %v: f(0): got %v, want 0", op, got)
+		}
+		if got := f(4); math.Abs(got-1) > 1e-9 {
+			t.Errorf("operator %v: f(white point): got %v, want 1", op, got)
+		}
+		prev := 0.
+		for x := 0.01; x < 4; x += 0.01 {
+			y := f(x)
+			if !(y > prev) {
+				t.Errorf("operator %v: not increasing at %v", op, x)
+				break
+			}
+			prev = y
+		}
+	}
+}
+
+func TestToneMap_Exposure(t *testing.T) {
+	img := imagef.MakeImage(1, 1)
+	img[0][0] = C(1, 2, 4)
+	got := ApplyToneMap(img, ToneMapParams{Exposure: -1})[0][0]
+	if want := C(0.5, 1, 2); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if img[0][0] != C(1, 2, 4) {
+		t.Errorf("ApplyToneMap modified its input")
+	}
+}
+
+// Highlights must be compressed below 1 (no clipping)
+func TestToneMap_Reinhard(t *testing.T) {
+	img := imagef.MakeImage(1, 1)
+	img[0][0] = C(1, 3, 1000)
+	got := ApplyToneMap(img, ToneMapParams{Operator: Reinhard})[0][0]
+	if want := C(0.5, 0.75, 1000./1001.); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
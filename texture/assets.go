@@ -3,6 +3,7 @@ package texture
 import (
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/geom"
 	. "github.com/barnex/bruteray/imagef/colorf"
 	"github.com/barnex/bruteray/util"
@@ -17,17 +18,27 @@ import (
 // E.g.:
 // 	Checkers(1, 1, color.White, color.Black)
 func Checkers(pitchU, pitchV float64, a, b Texture) Texture {
-	pitchU *= 2
-	pitchV *= 2
-	return Func(func(p Vec) Color {
-		u := p[0]
-		v := p[1]
-		if (floor(u*pitchU)+floor(v*pitchV))%2 == 0 {
-			return a.At(Vec{u, v})
-		} else {
-			return b.At(Vec{u, v})
-		}
-	})
+	return &checkers{pitchU, pitchV, a, b}
+}
+
+type checkers struct {
+	pitchU, pitchV float64
+	a, b           Texture
+}
+
+func (c *checkers) At(p Vec) Color {
+	u := p[0]
+	v := p[1]
+	if (floor(u*2*c.pitchU)+floor(v*2*c.pitchV))%2 == 0 {
+		return c.a.At(Vec{u, v})
+	} else {
+		return c.b.At(Vec{u, v})
+	}
+}
+
+// Describe implements describe.Describer.
+func (c *checkers) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "checkers", "pitch": [2]float64{c.pitchU, c.pitchV}, "a": e.Describe(c.a), "b": e.Describe(c.b)}
 }
 
 func Grid(width, pitchU, pitchV float64, a, b Texture) Texture {
@@ -45,3 +56,18 @@ func Grid(width, pitchU, pitchV float64, a, b Texture) Texture {
 func floor(x float64) int {
 	return int(math.Floor(x))
 }
+
+// VertexColor renders the vertex colors of a mesh (see objects.MeshWithAttributes),
+// by interpreting the local coordinates as a color.
+var VertexColor Texture = vertexColor{}
+
+type vertexColor struct{}
+
+func (vertexColor) At(p Vec) Color {
+	return Color{p[0], p[1], p[2]}
+}
+
+// Describe implements describe.Describer.
+func (vertexColor) Describe(*describe.Encoder) interface{} {
+	return describe.Node{"type": "vertexColor"}
+}
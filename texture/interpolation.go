@@ -8,6 +8,7 @@ package texture
 import (
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/imagef"
 	"github.com/barnex/bruteray/imagef/colorf"
@@ -33,12 +34,22 @@ func (n *nearest) AtUV(u, v float64) colorf.Color {
 	return atIndex(img, i, j)
 }
 
+// Describe implements describe.Describer.
+func (n *nearest) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "image", "file": e.Image(n.img, "texture"), "nearest": true}
+}
+
 type bilinear struct{ img imagef.Image }
 
 func (n *bilinear) At(p geom.Vec) colorf.Color {
 	return n.AtUV(p[0], p[1])
 }
 
+// Describe implements describe.Describer.
+func (n *bilinear) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "image", "file": e.Image(n.img, "texture")}
+}
+
 // https://en.wikipedia.org/wiki/Bilinear_interpolation
 func (f *bilinear) AtUV(u, v float64) colorf.Color {
 	img := f.img
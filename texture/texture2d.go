@@ -3,6 +3,7 @@ package texture
 import (
 	"log"
 
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/imagef"
 	. "github.com/barnex/bruteray/imagef/colorf"
@@ -13,6 +14,12 @@ func MustLoad(file string) Texture {
 	return &bilinear{img}
 }
 
+// Bilinear turns an image into a texture, interpolating bilinearly between pixels.
+// The image is repeated outside of the unit square (like MustLoad).
+func Bilinear(img imagef.Image) Texture {
+	return &bilinear{img}
+}
+
 func HeightMap(file string) Texture {
 	img, err := imagef.Load(file, imagef.Linear)
 	if err != nil {
@@ -43,3 +50,12 @@ func (p *panned) AtUV(u, v float64) Color {
 func (p *panned) At(P geom.Vec) Color {
 	return p.AtUV(P[0], P[1])
 }
+
+// Describe implements describe.Describer.
+func (p *panned) Describe(e *describe.Encoder) interface{} {
+	n := describe.Node{"type": "scaleUV", "texture": e.Describe(p.orig), "scale": [2]float64{1 / p.iScaleU, 1 / p.iScaleV}}
+	if p.deltaU != 0 || p.deltaV != 0 {
+		n["pan"] = [2]float64{p.deltaU, p.deltaV}
+	}
+	return n
+}
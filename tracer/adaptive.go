@@ -0,0 +1,137 @@
+package tracer
+
+import (
+	"context"
+	"math"
+
+	. "github.com/barnex/bruteray/imagef"
+	. "github.com/barnex/bruteray/imagef/colorf"
+)
+
+// AdaptiveMinPasses is the number of passes every pixel receives
+// before SampleAdaptive considers its noise level. Fewer samples
+// do not yield a meaningful estimate of the standard error.
+const AdaptiveMinPasses = 4
+
+// SampleAdaptive is like SampleContext, but only adds nPass samples
+// to the pixels that still need them. I.e. pixels whose standard error
+// is below threshold, or who already received maxPasses passes, are skipped.
+// Pixels never receive more than maxPasses passes in total, a pixel close to the maximum
+// receives fewer than nPass samples. maxPasses = 0 means no maximum.
+//
+// The standard error is measured in perceived (sRGB) brightness,
+// so that the threshold is meaningful for both dark and bright regions.
+// E.g., a threshold of 1./256. means that the remaining noise
+// is roughly below the resolution of an 8-bit image.
+//
+// To avoid missing rare but bright samples (e.g. caustics),
+// a pixel keeps being sampled as long as any of its 8 neighbors
+// still exceeds the threshold.
+//
+// The number of pixels that were sampled is returned.
+// When it is zero, the image has converged (or exhausted its budget)
+// and further calls have no effect.
+func (s *Sampler) SampleAdaptive(c context.Context, nPass int, threshold float64, maxPasses int) (int, error) {
+	w, h := s.imageSize()
+
+	noisy := makeBool2D(w, h)
+	for iy := 0; iy < h; iy++ {
+		for ix := 0; ix < w; ix++ {
+			noisy[iy][ix] = s.n[iy][ix] < AdaptiveMinPasses || s.stdErrGamma(ix, iy) > threshold
+		}
+	}
+
+	passes := make([][]int, h)
+	numPix := 0
+	for iy := 0; iy < h; iy++ {
+		passes[iy] = make([]int, w)
+		for ix := 0; ix < w; ix++ {
+			n := nPass
+			if maxPasses != 0 && s.n[iy][ix]+n > maxPasses {
+				n = maxPasses - s.n[iy][ix]
+			}
+			if n > 0 && anyNeighbor(noisy, ix, iy) {
+				passes[iy][ix] = n
+				numPix++
+			}
+		}
+	}
+
+	if numPix == 0 {
+		return 0, nil
+	}
+	return numPix, s.sample(c, nPass, passes)
+}
+
+// stdErrGamma returns the standard error of pixel ix, iy,
+// in perceived (gamma-corrected) brightness. I.e. the largest
+// error over the three color channels.
+func (s *Sampler) stdErrGamma(ix, iy int) float64 {
+	n := float64(s.n[iy][ix])
+	if n < 2 {
+		return math.Inf(1)
+	}
+	mean := s.imagef(ix, iy)
+	v := s.variancef(ix, iy)
+	e := math.Max(stdErrGamma(mean.R, v.R, n), stdErrGamma(mean.G, v.G, n))
+	return math.Max(e, stdErrGamma(mean.B, v.B, n))
+}
+
+func stdErrGamma(mean, variance, n float64) float64 {
+	if variance <= 0 { // may be slightly negative due to round-off
+		return 0
+	}
+	e := math.Sqrt(variance/n) * SRGBSlope(math.Max(mean, 0))
+	if math.IsNaN(e) {
+		return 0
+	}
+	return e
+}
+
+// anyNeighbor returns true if pixel ix, iy or any of its 8 neighbors is set.
+func anyNeighbor(img [][]bool, ix, iy int) bool {
+	for j := iy - 1; j <= iy+1; j++ {
+		if j < 0 || j >= len(img) {
+			continue
+		}
+		for i := ix - 1; i <= ix+1; i++ {
+			if i < 0 || i >= len(img[j]) {
+				continue
+			}
+			if img[j][i] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SamplingImage returns a debug image showing the number of passes
+// accumulated in each pixel, relative to the maximum number of passes
+// (white) over all pixels. This visualizes where SampleAdaptive
+// concentrated its effort.
+func (s *Sampler) SamplingImage() Image {
+	max := 0
+	for _, row := range s.n {
+		for _, n := range row {
+			if n > max {
+				max = n
+			}
+		}
+	}
+	return s.memoize(func(ix, iy int) Color {
+		if max == 0 {
+			return Color{}
+		}
+		return Gray(float64(s.n[iy][ix]) / float64(max))
+	})
+}
+
+func makeBool2D(w, h int) [][]bool {
+	list := make([]bool, w*h)
+	img := make([][]bool, h)
+	for i := range img {
+		img[i] = list[i*w : (i+1)*w]
+	}
+	return img
+}
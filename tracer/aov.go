@@ -0,0 +1,313 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	. "github.com/barnex/bruteray/geom"
+	. "github.com/barnex/bruteray/imagef"
+	. "github.com/barnex/bruteray/imagef/colorf"
+)
+
+// Names of AOVs ("Arbitrary Output Variables"): images that the Sampler
+// can render alongside the color (see Sampler.EnableAOV).
+// Values are averaged over all samples in a pixel, like the color,
+// except for IDs, which cannot be averaged: they hold the ID seen by the first sample.
+// Samples with a NaN color are ignored, like for the color.
+const (
+	AOVAlbedo   = "albedo"   // first-hit albedo (see AlbedoMaterial)
+	AOVNormal   = "normal"   // first-hit unit normal, X, Y, Z stored as R, G, B
+	AOVDepth    = "depth"    // first-hit distance along the camera ray (HitRecord.T)
+	AOVObject   = "object"   // first-hit object ID (see Features), in all three channels
+	AOVMaterial = "material" // first-hit material ID (see Scene.MaterialID), in all three channels
+	AOVDirect   = "direct"   // light reaching the first hit directly from the light sources (see Ctx.AddDirect)
+	AOVIndirect = "indirect" // all other light: color minus direct. Includes light sources seen directly
+)
+
+// AOVLight returns the name of the AOV holding the direct light
+// from light source number i (in Scene.Lights), e.g. "light0".
+func AOVLight(i int) string {
+	return fmt.Sprint(aovLightPrefix, i)
+}
+
+const aovLightPrefix = "light"
+
+// aovSample holds the AOVs of the current sample.
+type aovSample struct {
+	Features
+	direct Color   // sum of all direct light
+	lights []Color // direct light per light source
+	weight float64 // weight of the material currently being shaded, see Ctx.SetDirectWeight
+
+	wanted         bool // record AOVs?
+	wantMaterialID bool // MaterialID is not free, only when wanted
+}
+
+func (a *aovSample) reset() {
+	a.Features = Features{}
+	a.direct = Color{}
+	for i := range a.lights {
+		a.lights[i] = Color{}
+	}
+	a.weight = 1
+}
+
+// AddDirect records the contribution of light source number i (in Scene.Lights)
+// to the brightness of the first surface hit by a camera ray.
+// Materials that explicitly sample light sources (like Matte)
+// should report each light's contribution here, for use in the direct and per-light AOVs.
+// Calls at deeper recursion levels are ignored, as are calls when no AOVs are being recorded.
+func (c *Ctx) AddDirect(i int, contribution Color) {
+	if !c.aov.wanted || c.CurrentRecursionDepth != 1 {
+		return
+	}
+	a := &c.aov
+	contribution = contribution.Mul(a.weight)
+	a.direct = a.direct.Add(contribution)
+	for len(a.lights) <= i {
+		a.lights = append(a.lights, Color{})
+	}
+	a.lights[i] = a.lights[i].Add(contribution)
+}
+
+// ScaleDirect multiplies all direct light recorded so far by f.
+// E.g. used by media that attenuate the light reaching the camera.
+func (c *Ctx) ScaleDirect(f float64) {
+	if !c.aov.wanted || c.CurrentRecursionDepth != 1 {
+		return
+	}
+	a := &c.aov
+	a.direct = a.direct.Mul(f)
+	for i := range a.lights {
+		a.lights[i] = a.lights[i].Mul(f)
+	}
+}
+
+// DirectWeight returns the weight by which contributions passed to AddDirect are multiplied.
+// See SetDirectWeight.
+func (c *Ctx) DirectWeight() float64 {
+	return c.aov.weight
+}
+
+// SetDirectWeight sets the weight by which contributions passed to AddDirect are multiplied.
+// Materials that blend other materials with given weights (like Blend)
+// should set the weight accordingly while shading each of them, and restore it afterwards. E.g.:
+// 	w := ctx.DirectWeight()
+// 	ctx.SetDirectWeight(w * 0.3)
+// 	c := material.Shade(ctx, s, r, h)
+// 	ctx.SetDirectWeight(w)
+// 	return c.Mul(0.3)
+func (c *Ctx) SetDirectWeight(w float64) {
+	c.aov.weight = w
+}
+
+// aovKind enumerates the different kinds of AOV.
+type aovKind int
+
+const (
+	aovAlbedo aovKind = iota
+	aovNormal
+	aovDepth
+	aovObject
+	aovMaterial
+	aovDirect
+	aovIndirect
+	aovLight
+)
+
+var aovKinds = map[string]aovKind{
+	AOVAlbedo:   aovAlbedo,
+	AOVNormal:   aovNormal,
+	AOVDepth:    aovDepth,
+	AOVObject:   aovObject,
+	AOVMaterial: aovMaterial,
+	AOVDirect:   aovDirect,
+	AOVIndirect: aovIndirect,
+}
+
+// aovChannel accumulates one AOV in the Sampler.
+type aovChannel struct {
+	name  string
+	kind  aovKind
+	light int     // light index for aovLight
+	sum   Image   // sum of all samples, not used for IDs
+	id    [][]int // ID seen by the first sample, -1 if none yet. Only for IDs (see isID)
+}
+
+// isID returns true for AOVs holding IDs (object, material),
+// which are not averaged.
+func (ch *aovChannel) isID() bool {
+	return ch.kind == aovObject || ch.kind == aovMaterial
+}
+
+func parseAOV(name string) (kind aovKind, light int, err error) {
+	if k, ok := aovKinds[name]; ok {
+		return k, 0, nil
+	}
+	if strings.HasPrefix(name, aovLightPrefix) {
+		if i, err := strconv.Atoi(name[len(aovLightPrefix):]); err == nil && i >= 0 {
+			return aovLight, i, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("unknown AOV: %q", name)
+}
+
+// sampleID returns the ID seen by a sample, for ID AOVs.
+func (ch *aovChannel) sampleID(a *aovSample) int {
+	switch ch.kind {
+	default:
+		panic(fmt.Sprintf("bug: not an ID aovKind: %v", ch.kind))
+	case aovObject:
+		return a.ObjectID
+	case aovMaterial:
+		return a.MaterialID
+	}
+}
+
+// value returns the AOV value of a sample with color c, for all but ID AOVs.
+func (ch *aovChannel) value(c Color, a *aovSample) Color {
+	switch ch.kind {
+	default:
+		panic(fmt.Sprintf("bug: bad aovKind: %v", ch.kind))
+	case aovAlbedo:
+		return a.Albedo
+	case aovNormal:
+		return Color{a.Normal[X], a.Normal[Y], a.Normal[Z]}
+	case aovDepth:
+		return Gray(a.Depth)
+	case aovDirect:
+		return a.direct
+	case aovIndirect:
+		return c.MAdd(-1, a.direct)
+	case aovLight:
+		if ch.light < len(a.lights) {
+			return a.lights[ch.light]
+		}
+		return Color{}
+	}
+}
+
+// EnableAOV makes the Sampler render the AOVs with given names
+// (e.g. AOVDepth, AOVLight(0)), in addition to the color.
+// Their images can be retrieved with AOV.
+// It should be called before the first call to Sample.
+func (s *Sampler) EnableAOV(names ...string) error {
+	w, h := s.imageSize()
+	for _, name := range names {
+		if s.aovChannel(name) != nil {
+			continue // already enabled
+		}
+		kind, light, err := parseAOV(name)
+		if err != nil {
+			return err
+		}
+		ch := aovChannel{name: name, kind: kind, light: light}
+		if ch.isID() {
+			ch.id = makeIDs(w, h)
+		} else {
+			ch.sum = MakeImage(w, h)
+		}
+		s.aovs = append(s.aovs, ch)
+	}
+	return nil
+}
+
+// AOVNames returns the names of all enabled AOVs.
+func (s *Sampler) AOVNames() []string {
+	var names []string
+	for _, ch := range s.aovs {
+		names = append(names, ch.name)
+	}
+	return names
+}
+
+// AOV returns the image of an AOV enabled by EnableAOV,
+// averaged over all samples in each pixel.
+// IDs are not averaged, they are the ID seen by the first sample in each pixel,
+// stored in all three channels.
+func (s *Sampler) AOV(name string) Image {
+	ch := s.aovChannel(name)
+	if ch == nil {
+		panic(fmt.Sprintf("tracer.Sampler: AOV %q not enabled", name))
+	}
+	return s.memoize(func(ix, iy int) Color {
+		n := s.n[iy][ix]
+		if n == 0 {
+			return Color{}
+		}
+		if ch.isID() {
+			return Gray(math.Max(0, float64(ch.id[iy][ix])))
+		}
+		return ch.sum[iy][ix].Mul(1 / float64(n))
+	})
+}
+
+func (s *Sampler) aovChannel(name string) *aovChannel {
+	for i := range s.aovs {
+		if s.aovs[i].name == name {
+			return &s.aovs[i]
+		}
+	}
+	return nil
+}
+
+// addAOVs accumulates the AOVs of a sample with color c in pixel ix, iy.
+// It must not be called for samples with a NaN color.
+func (s *Sampler) addAOVs(ix, iy int, c Color, a *aovSample) {
+	for i := range s.aovs {
+		ch := &s.aovs[i]
+		if ch.isID() {
+			if ch.id[iy][ix] < 0 { // first sample
+				ch.id[iy][ix] = ch.sampleID(a)
+			}
+			continue
+		}
+		ch.sum[iy][ix] = ch.sum[iy][ix].Add(ch.value(c, a))
+	}
+}
+
+// makeIDs returns storage for an ID AOV, with no IDs recorded yet (-1).
+func makeIDs(w, h int) [][]int {
+	id := make([][]int, h)
+	for iy := range id {
+		id[iy] = make([]int, w)
+		for ix := range id[iy] {
+			id[iy][ix] = -1
+		}
+	}
+	return id
+}
+
+// initCtx prepares ctx for recording the AOVs enabled in s.
+func (s *Sampler) initCtx(ctx *Ctx) {
+	ctx.aov.wanted = len(s.aovs) != 0
+	ctx.aov.wantMaterialID = s.aovChannel(AOVMaterial) != nil
+}
+
+// EnableFeatures enables the AOVs needed for denoising:
+// albedo, normal and depth. See Albedo, Normal, Depth.
+func (s *Sampler) EnableFeatures() {
+	if err := s.EnableAOV(AOVAlbedo, AOVNormal, AOVDepth); err != nil {
+		panic(err) // bug
+	}
+}
+
+// Albedo returns the albedo AOV (see AOVAlbedo).
+// EnableFeatures must have been called before sampling.
+func (s *Sampler) Albedo() Image {
+	return s.AOV(AOVAlbedo)
+}
+
+// Normal returns the normal AOV (see AOVNormal).
+// EnableFeatures must have been called before sampling.
+func (s *Sampler) Normal() Image {
+	return s.AOV(AOVNormal)
+}
+
+// Depth returns the depth AOV (see AOVDepth).
+// EnableFeatures must have been called before sampling.
+func (s *Sampler) Depth() Image {
+	return s.AOV(AOVDepth)
+}
@@ -4,7 +4,10 @@ import (
 	"math"
 	"testing"
 
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/tracer"
 	. "github.com/barnex/bruteray/tracer/cameras"
 	"github.com/barnex/bruteray/tracer/test"
 	. "github.com/barnex/bruteray/tracer/types"
@@ -176,3 +179,57 @@ func TestProjective_FOV(t *testing.T) {
 		test.DefaultTolerance,
 	)
 }
+
+// A camera's description (position and yaw, pitch, roll) must reconstruct the same camera,
+// also when looking straight up or down, where yaw and roll are ambiguous.
+func TestDescribe(t *testing.T) {
+	ctx := tracer.NewCtx(1)
+	for _, c := range []struct{ yaw, pitch, roll float64 }{
+		{0, 0, 0},
+		{30, -20, 10},
+		{-170, 80, -45},
+		{120, 90, 0},
+		{45, -90, 30},
+	} {
+		cam := Projective(60*Deg).Translate(Vec{1, 2, 3}).YawPitchRoll(c.yaw*Deg, c.pitch*Deg, c.roll*Deg)
+		e := describe.NewEncoder("", "")
+		n := cam.Describe(e).(describe.Node)
+		if err := e.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if n["type"] != "projective" || math.Abs(n["fov"].(float64)-60) > 1e-9 || n["position"] != (Vec{1, 2, 3}) {
+			t.Errorf("%v: got %v", c, n)
+		}
+		if math.Abs(c.pitch) != 90 {
+			if got := [3]float64{n["yaw"].(float64), n["pitch"].(float64), n["roll"].(float64)}; !approxEqual(got, [3]float64{c.yaw, c.pitch, c.roll}) {
+				t.Errorf("%v: got yaw, pitch, roll %v", c, got)
+			}
+		}
+		deg := func(key string) float64 { return n[key].(float64) * Deg }
+		cam2 := Projective(deg("fov")).Translate(n["position"].(Vec)).YawPitchRoll(deg("yaw"), deg("pitch"), deg("roll"))
+		for _, uv := range [][2]float64{{0.2, 0.3}, {0.9, 0.6}} {
+			r1 := *cam.RayFrom(ctx, uv[0], uv[1])
+			r2 := *cam2.RayFrom(ctx, uv[0], uv[1])
+			if !approxEqual(r1.Dir, r2.Dir) || !approxEqual(r1.Start, r2.Start) {
+				t.Errorf("%v: got ray %v, want %v", c, r2, r1)
+			}
+		}
+	}
+
+	unit := geom.UnitMatrix()
+	scaled := Transform(Projective(60*Deg), unit.Mulf(2), Vec{})
+	e := describe.NewEncoder("", "")
+	scaled.Describe(e)
+	if e.Err() == nil {
+		t.Errorf("scaled camera: expected error")
+	}
+}
+
+func approxEqual(a, b [3]float64) bool {
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
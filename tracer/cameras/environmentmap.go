@@ -3,6 +3,8 @@ package cameras
 import (
 	"math"
 
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
@@ -36,3 +38,8 @@ func (envMap) RayFrom(ctx *Ctx, u, v float64) *Ray {
 	}
 	return r
 }
+
+// describe implements baseCamera.
+func (envMap) describe() (describe.Node, geom.Matrix) {
+	return describe.Node{"type": "environmentMap"}, geom.UnitMatrix()
+}
@@ -3,6 +3,8 @@ package cameras
 import (
 	"fmt"
 
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
@@ -41,4 +43,10 @@ func (c *isometric) RayFrom(ctx *Ctx, u, v float64) *Ray {
 	return r
 }
 
+// describe implements baseCamera.
+// The view direction is described by the camera's rotation, relative to the Z axis.
+func (c *isometric) describe() (describe.Node, geom.Matrix) {
+	return describe.Node{"type": "isometric", "axis": "z", "size": c.size}, geom.UnitMatrix()
+}
+
 const isoOffset = 4096
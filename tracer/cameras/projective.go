@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/tracer/sequence"
 	. "github.com/barnex/bruteray/tracer/types"
@@ -48,6 +49,17 @@ type projective struct {
 	diaphragm func(u, v float64) (x, y float64) // aperture shape. transforms lens samples [0..1] to positions on the lens [-1..1]
 }
 
+// describe implements baseCamera.
+func (c *projective) describe() (describe.Node, geom.Matrix) {
+	n := describe.Node{
+		"type":      "projective",
+		"fov":       describe.Degrees(2 * math.Atan(0.5/c.focalLen)),
+		"aperture":  c.aperture,
+		"focusDist": c.focusDist,
+	}
+	return n, geom.YawPitchRoll(180*Deg, 0, 0).A
+}
+
 // fovToFocalLen converts a Field Of View (in radians) to focal length
 // corresponding to a sensor of size 1.
 //
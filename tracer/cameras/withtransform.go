@@ -1,6 +1,9 @@
 package cameras
 
 import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/tracer"
 	. "github.com/barnex/bruteray/tracer/types"
@@ -81,3 +84,66 @@ func translate(c Camera, delta Vec) *WithTransform {
 func yawPitchRoll(c Camera, yaw, pitch, roll float64) *WithTransform {
 	return Transform(c, geom.YawPitchRoll(yaw, pitch, roll).A, Vec{})
 }
+
+// Describe implements describe.Describer.
+// The camera is described by its original type, position and yaw, pitch, roll
+// (see sceneCamera in package api). Transforms other than rotations cannot be described.
+func (c *WithTransform) Describe(e *describe.Encoder) interface{} {
+	orig, ok := c.orig.(baseCamera)
+	if !ok {
+		e.Errorf("cannot describe camera %T", c.orig)
+		return nil
+	}
+	n, base := orig.describe()
+	// c.matrix = rotation * base, see Transform
+	inv := base.Inverse()
+	yaw, pitch, roll, ok := decomposeYawPitchRoll(c.matrix.Mul(&inv))
+	if !ok {
+		e.Errorf("cannot describe camera: transform is not a rotation")
+		return nil
+	}
+	n["position"] = c.pos
+	n["yaw"] = describe.Degrees(yaw)
+	n["pitch"] = describe.Degrees(pitch)
+	n["roll"] = describe.Degrees(roll)
+	return n
+}
+
+// baseCamera is implemented by the cameras in this package
+// that are wrapped by WithTransform, so that they can be described.
+type baseCamera interface {
+	// describe returns the description of the camera, without position or rotation,
+	// and the rotation matrix applied by its constructor.
+	describe() (n describe.Node, base geom.Matrix)
+}
+
+// decomposeYawPitchRoll returns yaw, pitch and roll (radians) such that
+// 	geom.YawPitchRoll(yaw, pitch, roll).A == m
+// ok is false if m is not a rotation matrix.
+// When looking straight up or down, yaw and roll are ambiguous and roll is chosen 0.
+func decomposeYawPitchRoll(m geom.Matrix) (yaw, pitch, roll float64, ok bool) {
+	const tol = 1e-9
+	for i := range m {
+		for j := range m {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(m[i].Dot(m[j])-want) > tol {
+				return 0, 0, 0, false
+			}
+		}
+	}
+	if m[0].Cross(m[1]).Dot(m[2]) < 0 {
+		return 0, 0, 0, false // reflection
+	}
+
+	// m[i] is the image of unit vector i, the view direction (Z) only depends on yaw and pitch.
+	pitch = math.Asin(math.Max(-1, math.Min(1, -m[Z][Y])))
+	if math.Sqrt(m[Z][X]*m[Z][X]+m[Z][Z]*m[Z][Z]) < tol {
+		return math.Atan2(-m[X][Z], m[X][X]), pitch, 0, true
+	}
+	yaw = math.Atan2(m[Z][X], m[Z][Z])
+	roll = math.Atan2(m[X][Y], m[Y][Y])
+	return yaw, pitch, roll, true
+}
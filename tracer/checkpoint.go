@@ -0,0 +1,144 @@
+package tracer
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+
+	. "github.com/barnex/bruteray/imagef"
+)
+
+// checkpoint is the serialized state of a Sampler.
+type checkpoint struct {
+	Sum   Image
+	SumSq Image
+	N     [][]int // pass counts, also used to initialize the quasi-random sequences (Ctx.Init)
+	Stats Stats
+
+	AOVs   map[string]Image   // sums of the enabled AOVs, except IDs
+	AOVIDs map[string][][]int // enabled ID AOVs (see aovChannel.isID)
+}
+
+// WriteCheckpoint serializes the Sampler's accumulated state,
+// so that rendering can later be resumed with ReadCheckpoint.
+// It must not be called concurrently with Sample.
+func (s *Sampler) WriteCheckpoint(w io.Writer) error {
+	aovs := make(map[string]Image)
+	ids := make(map[string][][]int)
+	for _, ch := range s.aovs {
+		if ch.isID() {
+			ids[ch.name] = ch.id
+		} else {
+			aovs[ch.name] = ch.sum
+		}
+	}
+	return gob.NewEncoder(w).Encode(&checkpoint{
+		Sum:    s.sum,
+		SumSq:  s.sumSq,
+		N:      s.n,
+		Stats:  s.Stats(),
+		AOVs:   aovs,
+		AOVIDs: ids,
+	})
+}
+
+// ReadCheckpoint restores the state previously written by WriteCheckpoint.
+// The Sampler must have been constructed with the same image size,
+// and, obviously, for the same scene.
+//
+// Samples only depend on the pixel and pass number,
+// so that resuming from a checkpoint yields bit-for-bit the same image
+// as rendering without interruption.
+func (s *Sampler) ReadCheckpoint(r io.Reader) error {
+	var c checkpoint
+	if err := gob.NewDecoder(r).Decode(&c); err != nil {
+		return err
+	}
+	w, h := s.imageSize()
+	if !c.hasSize(w, h) {
+		return fmt.Errorf("read checkpoint: image size does not match %vx%v", w, h)
+	}
+	for _, ch := range s.aovs {
+		_, ok := c.AOVs[ch.name]
+		if ch.isID() {
+			_, ok = c.AOVIDs[ch.name]
+		}
+		if !ok {
+			return fmt.Errorf("read checkpoint: AOV %q was not recorded", ch.name)
+		}
+	}
+	s.sum = c.Sum
+	s.sumSq = c.SumSq
+	s.n = c.N
+	for i := range s.aovs {
+		ch := &s.aovs[i]
+		if ch.isID() {
+			ch.id = c.AOVIDs[ch.name]
+		} else {
+			ch.sum = c.AOVs[ch.name]
+		}
+	}
+	s.statsMu.Lock()
+	s.stats = c.Stats
+	s.statsMu.Unlock()
+	return nil
+}
+
+// SaveCheckpoint writes a checkpoint to file fname (see WriteCheckpoint).
+// The file is replaced atomically, so that a crash while saving
+// does not destroy the previous checkpoint.
+func (s *Sampler) SaveCheckpoint(fname string) error {
+	tmp := fname + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	b := bufio.NewWriter(f)
+	if err := s.WriteCheckpoint(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := b.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fname)
+}
+
+// LoadCheckpoint reads a checkpoint from file fname (see ReadCheckpoint).
+func (s *Sampler) LoadCheckpoint(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.ReadCheckpoint(bufio.NewReader(f))
+}
+
+// hasSize returns true if all images in c have size w x h.
+func (c *checkpoint) hasSize(w, h int) bool {
+	if len(c.Sum) != h || len(c.SumSq) != h || len(c.N) != h {
+		return false
+	}
+	for iy := 0; iy < h; iy++ {
+		if len(c.Sum[iy]) != w || len(c.SumSq[iy]) != w || len(c.N[iy]) != w {
+			return false
+		}
+	}
+	for _, img := range c.AOVs {
+		if len(img) != h || len(img[0]) != w {
+			return false
+		}
+	}
+	for _, id := range c.AOVIDs {
+		if len(id) != h || len(id[0]) != w {
+			return false
+		}
+	}
+	return true
+}
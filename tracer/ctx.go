@@ -38,6 +38,8 @@ type Ctx struct {
 
 	rays  pool
 	Stats Stats
+
+	aov aovSample // AOVs of the current sample, if wanted
 }
 
 const pseudo = false
@@ -48,23 +50,26 @@ func NewCtx(numPix int) *Ctx {
 	c := &Ctx{
 		sequence1: sequence.NewHalton(2, 3, 1, sh),
 		sequence2: sequence.NewHalton(5, 7, 1, sh),
-		sequence3: sequence.PseudoRandom(),
+		sequence3: sequence.PseudoRandom(3),
 		sequenceL: sequence.NewHalton(5, 7, 11, sh),
 		AA:        sequence.NewHalton(2, 3, 1, sh),
 		rays:      pool{new: func() interface{} { return new(Ray) }},
 	}
 
+	c.aov.reset()
+
 	if pseudo {
-		c.sequence1 = sequence.PseudoRandom()
-		c.sequence2 = sequence.PseudoRandom()
-		c.sequence3 = sequence.PseudoRandom()
-		c.sequenceL = sequence.PseudoRandom()
-		c.AA = sequence.PseudoRandom()
+		c.sequence1 = sequence.PseudoRandom(1)
+		c.sequence2 = sequence.PseudoRandom(2)
+		c.sequence3 = sequence.PseudoRandom(3)
+		c.sequenceL = sequence.PseudoRandom(4)
+		c.AA = sequence.PseudoRandom(5)
 	}
 	return c
 }
 
 func (c *Ctx) Init(pixel, pass int) {
+	c.aov.reset()
 	c.sequence1.Init(pixel, pass)
 	c.sequence2.Init(pixel, pass)
 	c.sequence3.Init(pixel, pass)
@@ -85,6 +90,17 @@ func (c *Ctx) Generate2() (u, v float64) {
 	}
 }
 
+// Generate1 returns a pseudo-random number between 0 and 1.
+// Unlike Generate2, which returns the same quasi-random numbers
+// when called repeatedly at the same recursion depth, Generate1 returns
+// a new number on each call. Intended for additional random decisions,
+// e.g. choosing between reflection and transmission after Generate2
+// has been used to sample a direction.
+func (c *Ctx) Generate1() float64 {
+	u, _ := c.sequence3.Generate2()
+	return u
+}
+
 func (c *Ctx) GenerateLens() (u, v float64) {
 	return c.sequence3.Generate2()
 }
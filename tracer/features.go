@@ -0,0 +1,119 @@
+package tracer
+
+import (
+	"math"
+	"reflect"
+
+	. "github.com/barnex/bruteray/geom"
+	. "github.com/barnex/bruteray/imagef/colorf"
+)
+
+// Features hold auxiliary information about the first surface seen by a camera ray.
+// Unlike the color, features are (nearly) noise-free after a single pass.
+// This makes them useful guides for denoising (see post.Denoise).
+type Features struct {
+	Albedo     Color   // surface color, disregarding illumination (see AlbedoMaterial)
+	Normal     Vec     // unit surface normal, facing the camera
+	Depth      float64 // distance along the ray
+	ObjectID   int     // 1 + index of the object in Scene.ObjectsAndLights, 0 if nothing was hit
+	MaterialID int     // see Scene.MaterialID, 0 if nothing was hit
+}
+
+// An AlbedoMaterial can report the color of a surface fragment,
+// disregarding its illumination. E.g. for a Matte surface,
+// this is the diffuse reflectivity.
+//
+// Materials that do not implement AlbedoMaterial are assumed to be white.
+type AlbedoMaterial interface {
+	Albedo(h HitCoords) Color
+}
+
+// AlbedoOf returns the albedo of material m at h,
+// or white if m does not implement AlbedoMaterial.
+func AlbedoOf(m Material, h HitCoords) Color {
+	if a, ok := m.(AlbedoMaterial); ok {
+		return a.Albedo(h)
+	}
+	return Color{1, 1, 1}
+}
+
+// recordFeatures stores the features of the first hit, if requested via Ctx.
+// idx is the index of the object that was hit, or -1.
+// Rays that do not hit anything have zero features.
+func (c *Ctx) recordFeatures(s *Scene, r *Ray, front *HitRecord, idx int, h HitCoords) {
+	if !c.aov.wanted || c.CurrentRecursionDepth != 1 {
+		return
+	}
+	if math.IsInf(front.T, 0) || front.Material == blackMat || idx < 0 {
+		c.aov.Features = Features{}
+		return
+	}
+	normal := h.Normal
+	if normal.Dot(r.Dir) > 0 {
+		normal = normal.Mul(-1)
+	}
+	c.aov.Features = Features{
+		Albedo:   AlbedoOf(front.Material, h),
+		Normal:   normal,
+		Depth:    front.T,
+		ObjectID: idx + 1,
+	}
+	if c.aov.wantMaterialID {
+		c.aov.MaterialID = s.MaterialID(front.Material)
+	}
+}
+
+// A MaterialObject is an Object that reports the materials of its surfaces.
+// This allows the Scene to assign material IDs in a fixed order (see Scene.MaterialID).
+// The implementations in package objects all do.
+type MaterialObject interface {
+	Object
+
+	// Materials returns the materials of the object's surfaces, in a fixed order.
+	// Objects composed of other objects return the materials of their parts.
+	Materials() []Material
+}
+
+// MaterialsOf returns the materials of object o, see MaterialObject.
+// Objects that do not implement MaterialObject have no known materials.
+func MaterialsOf(o Object) []Material {
+	if o, ok := o.(MaterialObject); ok {
+		return o.Materials()
+	}
+	return nil
+}
+
+// MaterialID returns a number that uniquely identifies material m within the Scene.
+// IDs are assigned consecutively, starting from 1, when the Scene is constructed,
+// in order of appearance in the objects and lights (see MaterialObject).
+// So they do not change between renders of the same Scene.
+// Materials that were not reported by any object have ID 0, like no material at all.
+func (s *Scene) MaterialID(m Material) int {
+	return s.materialIDs[materialKey(m)]
+}
+
+// materialIDs assigns material IDs (see Scene.MaterialID) to the materials of objs.
+func materialIDs(objs []Object) map[interface{}]int {
+	ids := make(map[interface{}]int)
+	for _, o := range objs {
+		for _, m := range MaterialsOf(o) {
+			if m == nil {
+				continue // e.g. objects that only serve as a shape
+			}
+			if key := materialKey(m); ids[key] == 0 {
+				ids[key] = len(ids) + 1
+			}
+		}
+	}
+	return ids
+}
+
+// materialKey returns a map key that identifies material m.
+func materialKey(m Material) interface{} {
+	// Not all materials can be used as map keys (e.g. materials.Func),
+	// use the underlying pointer for those.
+	if !reflect.TypeOf(m).Comparable() {
+		return reflect.ValueOf(m).Pointer()
+	}
+	return m
+}
@@ -85,3 +85,13 @@ type TransparentMaterial interface {
 type Medium interface {
 	Filter(ctx *Ctx, s *Scene, r *Ray, tMax float64, original Color) Color
 }
+
+// An OccludingMedium is a Medium that also attenuates light sources,
+// i.e. casts shadows (see Scene.Occlude).
+type OccludingMedium interface {
+	Medium
+
+	// Transmittance returns the fraction of light that
+	// traverses the medium between the start of ray r and distance len.
+	Transmittance(ctx *Ctx, r *Ray, len float64) float64
+}
@@ -0,0 +1,225 @@
+package lights
+
+import (
+	"math"
+	"sort"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/tracer/objects"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// EnvironmentLight constructs a light source that surrounds the entire scene,
+// like the sky, from an equirectangular environment map. E.g.:
+// 	sky := EnvironmentLight(imagef.MustLoad("sky.hdr"))
+//
+// The image uses the same projection as cameras.EnvironmentMap:
+// the horizontal axis spans 360 degrees, with the center column along the -Z axis,
+// the vertical axis spans 180 degrees from the -Y axis (bottom row) to the +Y axis (top row).
+// So an environment map rendered with cameras.EnvironmentMap can be used as-is.
+// High dynamic range images (e.g. Radiance .hdr, see imagef.Load)
+// give much more realistic lighting than JPEG or PNG.
+//
+// The image determines the brightness seen in each direction.
+// Rays that do not hit any object see the environment (without the need for a Backdrop),
+// and the environment illuminates the scene like any other light source:
+// directions are importance-sampled proportionally to their brightness,
+// so that small, bright features like the sun cast sharp shadows without excessive noise.
+//
+// The environment can be rotated with Transformed (but not translated,
+// it is infinitely far away).
+func EnvironmentLight(img Image) Light {
+	w, h := img.Size()
+	if w == 0 || h == 0 {
+		panic("lights: EnvironmentLight: empty image")
+	}
+	return &environmentMap{
+		environment: newEnvironment(w, h, func(dir Vec) Color {
+			ix, iy := envPixel(dir, w, h)
+			return img[iy][ix]
+		}),
+		img: img,
+	}
+}
+
+// environmentMap is the environment returned by EnvironmentLight,
+// which remembers its image so that it can describe itself.
+type environmentMap struct {
+	*environment
+	img Image
+}
+
+// Describe implements describe.Describer.
+func (l *environmentMap) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "environment", "file": e.Image(l.img, "environment")}
+}
+
+// newEnvironment constructs an environment light with given radiance (brightness seen in direction dir).
+// For importance sampling, the radiance is tabulated on a w x h equirectangular grid
+// (evaluated at the pixel centers), which should be fine enough to resolve bright features.
+func newEnvironment(w, h int, radiance func(dir Vec) Color) *environment {
+	l := &environment{
+		radiance: radiance,
+		w:        w,
+		h:        h,
+		rowCDF:   make([]float64, h),
+		pixelCDF: make([][]float64, h),
+	}
+	l.object = objects.Backdrop(&envMaterial{l})
+
+	// Pixels are chosen with probability proportional to their brightness
+	// times their solid angle (proportional to the cosine of their latitude),
+	// first the row, then the pixel within the row.
+	total := 0.0
+	for iy := 0; iy < h; iy++ {
+		row := 0.0
+		l.pixelCDF[iy] = make([]float64, w)
+		v := (float64(iy) + 0.5) / float64(h)
+		cosθ := math.Cos(latitude(v))
+		for ix := 0; ix < w; ix++ {
+			u := (float64(ix) + 0.5) / float64(w)
+			row += radiance(envDir(u, v)).Gray() * cosθ
+			l.pixelCDF[iy][ix] = row
+		}
+		total += row
+		l.rowCDF[iy] = total
+	}
+	if total == 0 {
+		panic("lights: environment light: black image")
+	}
+	return l
+}
+
+// envDistance is the distance at which Sample places the environment:
+// further than any object, but closer than a Backdrop (1e99),
+// which should not cast shadows from the environment.
+const envDistance = 1e90
+
+type environment struct {
+	radiance func(dir Vec) Color // brightness seen in direction dir (unit vector)
+	w, h     int
+	rowCDF   []float64   // cumulative (unnormalized) probability of rows
+	pixelCDF [][]float64 // cumulative (unnormalized) probability of pixels within each row
+	object   Object
+}
+
+// Sample implements tracer.Light.
+func (l *environment) Sample(ctx *Ctx, target Vec) (Vec, Color) {
+	u, v := ctx.Generate2()
+
+	// choose a row, then a pixel within the row, re-using the remainder
+	// of u, v as uniform random numbers for the position within the pixel
+	iy, v := searchCDF(l.rowCDF, v)
+	ix, u := searchCDF(l.pixelCDF[iy], u)
+	dir := envDir((float64(ix)+u)/float64(l.w), (float64(iy)+v)/float64(l.h))
+	pdf := l.PDF(target, dir)
+	if pdf == 0 {
+		return target, Color{}
+	}
+
+	// Like planar lights, intensities are normalized so that a white reflector
+	// yields intens*cosθ. Hence the Monte Carlo estimate L(dir)/pdf gets a factor 1/π.
+	return target.MAdd(envDistance, dir), l.radiance(dir).Mul(1 / (Pi * pdf))
+}
+
+// PDF implements tracer.PDFLight.
+func (l *environment) PDF(target, dir Vec) float64 {
+	ix, iy := envPixel(dir, l.w, l.h)
+	p := l.pixelCDF[iy][ix]
+	if ix > 0 {
+		p -= l.pixelCDF[iy][ix-1]
+	}
+	p /= l.rowCDF[l.h-1] // probability of choosing this pixel
+
+	// convert to probability per solid angle: the pixel spans 2π/w radians in longitude
+	// and π/h in latitude, multiplied by the cosine of the latitude.
+	cosθ := math.Sqrt(math.Max(0, 1-dir[geom.Y]*dir[geom.Y]))
+	if cosθ == 0 {
+		return 0
+	}
+	return p * float64(l.w*l.h) / (2 * Pi * Pi * cosθ)
+}
+
+// Object implements tracer.Light.
+func (l *environment) Object() Object {
+	return l.object
+}
+
+// envUV maps a direction (unit vector) to equirectangular image coordinates between 0 and 1,
+// the inverse of envDir.
+func envUV(dir Vec) (u, v float64) {
+	φ := math.Atan2(dir[geom.X], dir[geom.Z])
+	u = -φ / (2 * Pi)
+	if u < 0 {
+		u += 1
+	}
+	v = math.Asin(math.Max(-1, math.Min(1, dir[geom.Y])))/Pi + 0.5
+	return u, v
+}
+
+// envDir maps equirectangular image coordinates between 0 and 1 to a direction,
+// like cameras.EnvironmentMap.
+func envDir(u, v float64) Vec {
+	φ := -u * 2 * Pi
+	θ := latitude(v)
+	return Vec{
+		math.Sin(φ) * math.Cos(θ),
+		math.Sin(θ),
+		math.Cos(φ) * math.Cos(θ),
+	}
+}
+
+func latitude(v float64) float64 {
+	return (v - 0.5) * Pi
+}
+
+// envPixel returns the indices of the pixel seen in direction dir (unit vector),
+// for an equirectangular image of size w x h.
+func envPixel(dir Vec, w, h int) (ix, iy int) {
+	u, v := envUV(dir)
+	ix = clampIndex(int(u*float64(w)), w)
+	iy = clampIndex(int(v*float64(h)), h)
+	return ix, iy
+}
+
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+// searchCDF returns the index i chosen by random number u (uniform between 0 and 1)
+// from a cumulative (unnormalized) probability distribution,
+// and the remainder of u, again uniform between 0 and 1.
+func searchCDF(cdf []float64, u float64) (int, float64) {
+	x := u * cdf[len(cdf)-1]
+	i := clampIndex(sort.Search(len(cdf), func(i int) bool { return cdf[i] > x }), len(cdf))
+	start := 0.0
+	if i > 0 {
+		start = cdf[i-1]
+	}
+	if cdf[i] == start {
+		return i, 0.5
+	}
+	return i, clamp01((x - start) / (cdf[i] - start))
+}
+
+func clamp01(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+// envMaterial is the material of the environment's backdrop,
+// seen by rays that do not hit any object.
+type envMaterial struct {
+	l *environment
+}
+
+// Shade implements tracer.Material.
+func (m *envMaterial) Shade(_ *Ctx, _ *Scene, _ *Ray, h HitCoords) Color {
+	return m.l.radiance(h.Local.Normalized()) // backdrop's local coordinates are the ray direction
+}
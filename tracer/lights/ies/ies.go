@@ -0,0 +1,283 @@
+// Package ies parses photometric data in the IES LM-63 format,
+// which describes the angular distribution of light emitted by a luminaire
+// (a "goniometric profile"). Manufacturers provide such files for their fixtures.
+// See lights.IESLight.
+package ies
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Profile holds the luminous intensity (in candela) emitted by a luminaire
+// as a function of the vertical and horizontal angle (in degrees),
+// using type C photometry:
+//
+// The vertical angle is measured from the nadir (0: straight down, 90: horizontal, 180: straight up).
+//
+// The horizontal angle is measured around the vertical axis, counterclockwise as seen from above.
+// If the file only contains horizontal angles in part of the full circle, the profile is
+// symmetric: 0 only means rotational symmetry, 0 to 90 quadrant symmetry,
+// and 0 to 180 mirror symmetry in the 0-180 plane.
+type Profile struct {
+	Vertical   []float64   // vertical angles (degrees), increasing
+	Horizontal []float64   // horizontal angles (degrees), increasing
+	Candela    [][]float64 // Candela[h][v] is the intensity at Horizontal[h], Vertical[v]
+}
+
+// ParseFile reads a profile from an IES file.
+func ParseFile(fname string) (*Profile, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a profile in the IES LM-63 format (1986, 1991, 1995 or 2002).
+// Only type C photometry (by far the most common) is supported.
+// The candela values are scaled by the file's multiplier.
+func Parse(r io.Reader) (p *Profile, e error) {
+	defer func() {
+		if err := recover(); err != nil {
+			p = nil
+			e = errors.New(fmt.Sprint(err))
+		}
+	}()
+	parser := parser{s: bufio.NewScanner(r)}
+	return parser.parse(), nil
+}
+
+// At returns the intensity (candela) in the direction given by the vertical and horizontal angle (degrees),
+// interpolating linearly between the tabulated angles. The intensity is zero at vertical angles
+// outside of the tabulated range.
+func (p *Profile) At(vertical, horizontal float64) float64 {
+	v, vw, ok := bracket(p.Vertical, vertical)
+	if !ok {
+		return 0
+	}
+	h, hw, _ := bracket(p.Horizontal, p.fold(horizontal))
+	at := func(h int) float64 {
+		c := p.Candela[h][v]
+		if vw > 0 {
+			c = (1-vw)*c + vw*p.Candela[h][v+1]
+		}
+		return c
+	}
+	c := at(h)
+	if hw > 0 {
+		c = (1-hw)*c + hw*at(h+1)
+	}
+	return c
+}
+
+// Max returns the maximum tabulated intensity (candela).
+func (p *Profile) Max() float64 {
+	max := 0.0
+	for _, row := range p.Candela {
+		for _, c := range row {
+			max = math.Max(max, c)
+		}
+	}
+	return max
+}
+
+// fold maps a horizontal angle onto the tabulated range,
+// using the profile's symmetry.
+func (p *Profile) fold(h float64) float64 {
+	h = math.Mod(h, 360)
+	if h < 0 {
+		h += 360
+	}
+	switch last := p.Horizontal[len(p.Horizontal)-1]; {
+	case last == 0:
+		return 0
+	case last <= 90:
+		if h > 180 {
+			h = 360 - h
+		}
+		if h > 90 {
+			h = 180 - h
+		}
+	case last <= 180:
+		if h > 180 {
+			h = 360 - h
+		}
+	}
+	return h
+}
+
+// bracket returns index i such that x lies between angles[i] and angles[i+1],
+// and the relative position w (between 0 and 1) between them.
+// ok is false if x lies outside of the range of angles.
+// A single angle is treated as a constant (and bracketed as index 0, weight 0).
+func bracket(angles []float64, x float64) (i int, w float64, ok bool) {
+	n := len(angles)
+	if n == 1 {
+		return 0, 0, x == angles[0]
+	}
+	if x < angles[0] || x > angles[n-1] {
+		return 0, 0, false
+	}
+	i = sort.SearchFloat64s(angles, x) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i > n-2 {
+		i = n - 2
+	}
+	w = (x - angles[i]) / (angles[i+1] - angles[i])
+	return i, w, true
+}
+
+type parser struct {
+	s      *bufio.Scanner
+	fields []string // remaining numbers on the current line
+}
+
+func (p *parser) parse() *Profile {
+	// header: keywords until TILT=
+	for {
+		line := p.line()
+		if strings.HasPrefix(line, "TILT=") {
+			if tilt := strings.TrimPrefix(line, "TILT="); tilt == "INCLUDE" {
+				p.skipTilt()
+			} else if tilt != "NONE" {
+				p.panicf("unsupported TILT=%v", tilt)
+			}
+			break
+		}
+	}
+
+	p.atof()               // number of lamps
+	p.atof()               // lumens per lamp
+	multiplier := p.atof() // candela multiplier
+	numVert := p.atoi()    // number of vertical angles
+	numHoriz := p.atoi()   // number of horizontal angles
+	photometricType := p.atoi()
+	p.atof() // units type
+	p.atof() // width
+	p.atof() // length
+	p.atof() // height
+	p.atof() // ballast factor
+	p.atof() // future use / ballast-lamp photometric factor
+	p.atof() // input watts
+
+	if photometricType != 1 {
+		p.panicf("unsupported photometric type %v, only type C (1) is supported", photometricType)
+	}
+	if numVert < 1 || numHoriz < 1 {
+		p.panicf("bad number of angles: %v x %v", numVert, numHoriz)
+	}
+
+	prof := &Profile{
+		Vertical:   p.atofs(numVert),
+		Horizontal: p.atofs(numHoriz),
+		Candela:    make([][]float64, numHoriz),
+	}
+	for h := range prof.Candela {
+		prof.Candela[h] = p.atofs(numVert)
+		for v := range prof.Candela[h] {
+			prof.Candela[h][v] *= multiplier
+		}
+	}
+	if !sort.Float64sAreSorted(prof.Vertical) || !sort.Float64sAreSorted(prof.Horizontal) {
+		p.panicf("angles not in increasing order")
+	}
+	return prof
+}
+
+// skipTilt skips the lamp-to-luminaire geometry and tilt angles and factors.
+func (p *parser) skipTilt() {
+	p.atoi() // lamp-to-luminaire geometry
+	n := p.atoi()
+	p.atofs(n) // angles
+	p.atofs(n) // multiplying factors
+}
+
+// line returns the next line.
+func (p *parser) line() string {
+	if !p.s.Scan() {
+		if err := p.s.Err(); err != nil {
+			p.panicf("%v", err)
+		}
+		p.panicf("unexpected end of file")
+	}
+	return strings.TrimSpace(p.s.Text())
+}
+
+// next returns the next whitespace or comma-separated number, which may be on the next line(s).
+func (p *parser) next() string {
+	for len(p.fields) == 0 {
+		p.fields = strings.FieldsFunc(p.line(), func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+	}
+	f := p.fields[0]
+	p.fields = p.fields[1:]
+	return f
+}
+
+func (p *parser) atof() float64 {
+	x, err := strconv.ParseFloat(p.next(), 64)
+	if err != nil {
+		p.panicf("%v", err)
+	}
+	return x
+}
+
+func (p *parser) atoi() int {
+	return int(p.atof()) // some files write integers as 1.0
+}
+
+func (p *parser) atofs(n int) []float64 {
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = p.atof()
+	}
+	return x
+}
+
+func (p *parser) panicf(format string, x ...interface{}) {
+	panic("ies: " + fmt.Sprintf(format, x...))
+}
+
+// Write writes p in the IES LM-63-2002 format, which Parse reads back.
+// Only the photometric data is written: a single lamp with a candela multiplier of 1,
+// and no luminous opening dimensions.
+func Write(w io.Writer, p *Profile) error {
+	nv, nh := len(p.Vertical), len(p.Horizontal)
+	if nv == 0 || nh == 0 || len(p.Candela) != nh {
+		return fmt.Errorf("ies: bad number of angles: %v x %v, %v rows of candela", nv, nh, len(p.Candela))
+	}
+	b := bufio.NewWriter(w)
+	fmt.Fprint(b, "IESNA:LM-63-2002\nTILT=NONE\n")
+	fmt.Fprintf(b, "1 -1 1 %v %v 1 2 0 0 0\n", nv, nh) // lamps, lumens (absolute), multiplier, angles, type C, meters, dimensions
+	fmt.Fprint(b, "1 1 0\n")                           // ballast factor, future use, input watts
+	numbers := func(x []float64) {
+		for i, x := range x {
+			if i != 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.FormatFloat(x, 'g', -1, 64))
+		}
+		b.WriteByte('\n')
+	}
+	numbers(p.Vertical)
+	numbers(p.Horizontal)
+	for _, row := range p.Candela {
+		if len(row) != nv {
+			return fmt.Errorf("ies: have %v vertical angles but %v candela values", nv, len(row))
+		}
+		numbers(row)
+	}
+	return b.Flush()
+}
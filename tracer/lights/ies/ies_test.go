@@ -0,0 +1,90 @@
+package ies
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ExampleParseFile() {
+	p, err := ParseFile("testdata/wallwasher.ies")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(p.Vertical)
+	fmt.Println(p.Horizontal)
+	fmt.Println(p.Candela)
+	fmt.Println(p.Max())
+
+	//Output:
+	// [0 15 30 45 60 75 90]
+	// [0 90 180]
+	// [[150 180 225 210 120 30 0] [150 135 90 45 15 3 0] [150 90 30 7.5 1.5 0 0]]
+	// 225
+}
+
+func TestProfile_At(t *testing.T) {
+	p, err := ParseFile("testdata/wallwasher.ies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		v, h float64
+		want float64
+	}{
+		{0, 0, 150},
+		{30, 0, 225},
+		{37.5, 0, 217.5},    // interpolate vertically
+		{30, 45, 157.5},     // interpolate horizontally
+		{30, 270, 90},       // mirror symmetry: 270 = 90
+		{30, -90, 90},       // -90 = 270
+		{30, 180, 30},       //
+		{100, 0, 0},         // outside of vertical range
+		{30, 360 + 180, 30}, // wrap around
+	} {
+		if got := p.At(c.v, c.h); got != c.want {
+			t.Errorf("At(%v, %v): got %v, want %v", c.v, c.h, got, c.want)
+		}
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"IESNA:LM-63-2002\nTILT=NONE\n1 1000 1 2 1 2 2 0 0 0\n1 1 10\n0 90\n0\n1 0\n", // type B
+		"IESNA:LM-63-2002\nTILT=NONE\n1 1000 1 2 1 1 2 0 0 0\n1 1 10\n0 90\n0\n1\n",   // truncated
+		"IESNA:LM-63-2002\nTILT=NONE\n1 1000 1 2 1 1 2 0 0 0\n1 1 10\n90 0\n0\n1 0\n", // not sorted
+	} {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("Parse(%q): expected error", in)
+		}
+	}
+}
+
+// A written profile parses back to the original.
+func TestWrite(t *testing.T) {
+	want, err := ParseFile("testdata/wallwasher.ies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Candela[1][2] = 1. / 3 // needs full precision
+	var buf bytes.Buffer
+	if err := Write(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	want.Candela = want.Candela[:1]
+	if err := Write(&buf, want); err == nil {
+		t.Errorf("expected error")
+	}
+}
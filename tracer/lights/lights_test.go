@@ -1,13 +1,20 @@
 package lights
 
 import (
+	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef"
 	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer"
 	"github.com/barnex/bruteray/tracer/cameras"
+	"github.com/barnex/bruteray/tracer/lights/ies"
 	"github.com/barnex/bruteray/tracer/materials"
 	"github.com/barnex/bruteray/tracer/objects"
+	"github.com/barnex/bruteray/tracer/sequence"
 	"github.com/barnex/bruteray/tracer/test"
 	. "github.com/barnex/bruteray/tracer/types"
 )
@@ -226,3 +233,309 @@ func TestSunLight_Position(t *testing.T) {
 		test.DefaultTolerance,
 	)
 }
+
+// The probability density reported by PDF must integrate to 1
+// over all directions in which the light is visible.
+func TestPDF(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	target := Vec{0.1, 0, 0.2}
+	for _, c := range []struct {
+		name  string
+		light Light
+	}{
+		{"rectangle", RectangleLight(colorf.White, 1, 2, Vec{0, 0.5, 0})},
+		{"disk", DiskLight(colorf.White, 1, Vec{0, 0.5, 0})},
+		{"transformed", Transformed(RectangleLight(colorf.White, 1, 2, Vec{0, 0.5, 0}), geom.Rotate(O, Ez, 20*Deg))},
+		{"environment", EnvironmentLight(testEnvironment())},
+		{"sky", Sky(3, 20*Deg, 30*Deg)},
+		{"mesh", MeshLight(texture.Checkers(4, 4, colorf.White, colorf.Gray(0.1)), testDome())},
+	} {
+		l := c.light.(PDFLight)
+		const N = 200000
+		integral := 0.0
+		for i := 0; i < N; i++ {
+			dir := sequence.UniformSphere(rng.Float64(), rng.Float64())
+			integral += l.PDF(target, dir) * 4 * Pi / N
+		}
+		if math.Abs(integral-1) > 0.02 {
+			t.Errorf("%v: integral of PDF: got %v, want 1", c.name, integral)
+		}
+	}
+}
+
+// Direct lighting by a large, nearby light with multiple importance sampling
+// should converge to the same brightness as plain path tracing
+// (where the light is replaced by its Object).
+func TestMIS(t *testing.T) {
+	white := materials.Matte(colorf.White.EV(-1))
+	shiny := materials.Microfacet(colorf.White, colorf.Gray(0.3), colorf.White)
+	for _, m := range []Material{white, shiny} {
+		light := RectangleLight(colorf.White, 2, 2, Vec{0, 0.3, 0})
+		cam := cameras.Projective(60*Deg).Translate(Vec{0, 0.1, 1.5})
+		mis := NewScene(2, []Light{light}, test.Sheet(m, 0))
+		pathTraced := NewScene(2, []Light{}, test.Sheet(m, 0), light.Object())
+
+		got := average(mis, cam, 64)
+		want := average(pathTraced, cam, 1024)
+		if math.Abs(got-want) > 0.02*want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func average(s *Scene, c Camera, nPass int) float64 {
+	sampler := tracer.NewSampler(s.ImageFunc(c), 16, 16, true)
+	sampler.Sample(nPass)
+	acc := 0.0
+	for _, row := range sampler.Image() {
+		for _, c := range row {
+			acc += c.Gray()
+		}
+	}
+	return acc / (16 * 16)
+}
+
+// Test that selecting one light by importance converges to the same result
+// as sampling all lights, for a scene with many lights.
+func TestLightSelection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Slow")
+	}
+	white := materials.Matte(colorf.White.EV(-1))
+	// not too shiny, specular highlights of point lights converge slowly
+	glossy := materials.Microfacet(colorf.White, colorf.Gray(0.6), colorf.White)
+
+	var lights []Light
+	for i := -3; i <= 3; i++ {
+		for j := -3; j <= 3; j++ {
+			pos := Vec{float64(i) * 0.4, 0.2 + 0.05*float64(i+j+6), float64(j) * 0.4}
+			power := colorf.Color{1, 0.8, 0.6}.Mul(0.2 + 0.1*float64((i+j+6)%4))
+			if (i+j)%2 == 0 {
+				lights = append(lights, PointLight(power.Mul(4), pos))
+			} else {
+				lights = append(lights, RectangleLight(power.Mul(20), 0.1, 0.1, pos))
+			}
+		}
+	}
+	lights = append(lights, Transformed(
+		RectangleLight(colorf.White.Mul(5), 0.2, 0.2, O),
+		geom.ComposeLR(geom.Pitch(-20*Deg), geom.Scale(O, 0.5), geom.Translate(Vec{0.3, 0.5, 0.3})),
+	))
+
+	cam := cameras.Projective(60*Deg).Translate(Vec{0, 0.6, 2})
+	for _, m := range []Material{white, glossy} {
+		s := NewScene(2, lights, test.Sheet(m, 0))
+		want := average(s, cam, 256)
+		for _, sel := range []tracer.LightSelection{tracer.SampleLightsByPower, tracer.SampleLightTree} {
+			s.SetLightSelection(sel)
+			got := average(s, cam, 1024)
+			if math.Abs(got-want) > 0.02*want {
+				t.Errorf("LightSelection %v: got %v, want %v", sel, got, want)
+			}
+		}
+		s.SetLightSelection(tracer.SampleAllLights)
+	}
+}
+
+// Lighting by an environment map should converge to the same brightness
+// as plain path tracing (where the light is replaced by its Object).
+func TestEnvironmentLight_Converge(t *testing.T) {
+	white := materials.Matte(colorf.White.EV(-1))
+	shiny := materials.Microfacet(colorf.White, colorf.Gray(0.3), colorf.White)
+	for _, m := range []Material{white, shiny} {
+		env := Transformed(EnvironmentLight(testEnvironment()), geom.Yaw(30*Deg))
+		cam := cameras.Projective(60*Deg).Translate(Vec{0, 0.5, 2})
+		objs := []Object{test.Sheet(m, 0), test.Sphere(m, 1, Vec{0, 0.5, 0})}
+		sampled := NewScene(2, []Light{env}, objs...)
+		// one more level of recursion, to reach the light after as many bounces
+		pathTraced := NewScene(3, []Light{}, append(objs, env.Object())...)
+
+		got := average(sampled, cam, 64)
+		want := average(pathTraced, cam, 2048)
+		if math.Abs(got-want) > 0.02*want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// A sky photo lights a matte and a shiny sphere.
+func TestEnvironmentLight(t *testing.T) {
+	sky := EnvironmentLight(imagef.MustLoad("../../assets/sky1.jpg"))
+	test.NPassSize(t,
+		NewScene(
+			3,
+			[]Light{sky},
+			test.Sphere(materials.Matte(colorf.White.EV(-0.3)), 1, Vec{-0.6, 0.5, 0}),
+			test.Sphere(materials.Microfacet(colorf.White, colorf.Gray(0.2), colorf.White), 1, Vec{0.6, 0.5, 0}),
+			test.Sheet(materials.Matte(colorf.White.EV(-1)), 0),
+		),
+		cameras.Projective(60*Deg).Translate(Vec{0, 0.8, 2.5}),
+		64,       // nPass
+		150, 100, // size
+		0.05,
+	)
+}
+
+// testEnvironment returns a small environment map with a dim gradient
+// and a bright "sun" (not too small, for the sake of path-traced references).
+func testEnvironment() Image {
+	img := imagef.MakeImage(64, 32)
+	for iy := range img {
+		for ix := range img[iy] {
+			img[iy][ix] = colorf.Color{0.3, 0.4, 0.6}.Mul(float64(iy) / 32)
+		}
+	}
+	for iy := 22; iy < 26; iy++ {
+		for ix := 8; ix < 12; ix++ {
+			img[iy][ix] = colorf.Color{10, 9, 8}
+		}
+	}
+	return img
+}
+
+// Sky seen from the ground, with the sun in the south-west, 30 degrees above the horizon.
+func TestSky(t *testing.T) {
+	test.NPassSize(t,
+		NewScene(
+			1,
+			[]Light{Sky(3, 135*Deg, 30*Deg)},
+		),
+		cameras.EnvironmentMap(),
+		1,        // nPass
+		200, 100, // size
+		test.DefaultTolerance,
+	)
+}
+
+// An outdoor scene lit by Daylight, in the late afternoon with a slightly hazy sky.
+func TestDaylight(t *testing.T) {
+	white := materials.Matte(colorf.White.EV(-0.3))
+	test.NPassSize(t,
+		NewScene(
+			3,
+			Daylight(4, -60*Deg, 20*Deg),
+			test.Sphere(white, 1, Vec{-0.6, 0.5, 0}),
+			test.Sphere(materials.Microfacet(colorf.White, colorf.Gray(0.2), colorf.White), 1, Vec{0.6, 0.5, 0}),
+			test.Sheet(white, 0),
+		),
+		cameras.Projective(60*Deg).Translate(Vec{0, 0.8, 2.5}),
+		64,       // nPass
+		150, 100, // size
+		0.05,
+	)
+}
+
+// A spot pointing down, and a transformed spot pointing sideways
+// with a hard edge (equal inner and outer angle).
+func TestSpotLight(t *testing.T) {
+	white := materials.Matte(colorf.White)
+	test.NPassSize(t,
+		NewScene(
+			1,
+			[]Light{
+				SpotLight(colorf.Color{1, 0.8, 0.6}.EV(5), 10*Deg, 25*Deg, Vec{-1, 2, -1}),
+				Transformed(
+					SpotLight(colorf.Color{0.6, 0.8, 1}.EV(5), 15*Deg, 15*Deg, Vec{0, 0, 0}),
+					geom.ComposeLR(geom.Rotate(O, Ez, -60*Deg), geom.Translate(Vec{2, 1.5, -1})),
+				),
+			},
+			test.Sheet(white, 0),
+			test.Sphere(white, 0.5, Vec{-1, 0.25, -1}),
+		),
+		cameras.Projective(90*Deg).Translate(Vec{0, 2, 2}).YawPitchRoll(0, -30*Deg, 0),
+		1,        // nPass
+		150, 100, // size
+		test.DefaultTolerance,
+	)
+}
+
+// An asymmetric wall washer, turned so that its main beam (horizontal angle 0) lights the wall.
+func TestIESLight(t *testing.T) {
+	profile, err := ies.ParseFile("ies/testdata/wallwasher.ies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	white := materials.Matte(colorf.White)
+	test.NPassSize(t,
+		NewScene(
+			1,
+			[]Light{
+				Transformed(
+					IESLight(colorf.White.EV(6), profile, O),
+					geom.ComposeLR(geom.Rotate(O, Ey, 90*Deg), geom.Translate(Vec{0, 2, -0.5})),
+				),
+			},
+			test.Sheet(white, 0),
+			objects.RectangleWithVertices(white, Vec{-3, 0, -1.5}, Vec{3, 0, -1.5}, Vec{-3, 4, -1.5}),
+		),
+		cameras.Projective(90*Deg).Translate(Vec{0, 1, 2}),
+		1,        // nPass
+		150, 100, // size
+		test.DefaultTolerance,
+	)
+}
+
+// testDome returns a mesh that curves over TestPDF's target point,
+// so that it does not hide any of its own parts.
+func testDome() objects.Interface {
+	return objects.Parametric(nil, 9, 9, func(u, v float64) Vec {
+		x, z := 2*u-1, 2*v-1
+		return Vec{x, 0.5 - 0.2*(x*x+z*z), z}
+	})
+}
+
+// testLampShade returns an open cone, like a lamp shade,
+// with UV coordinates running around (u) and along (v) the cone.
+func testLampShade(center Vec) objects.Interface {
+	return objects.Parametric(nil, 33, 5, func(u, v float64) Vec {
+		φ := u * 2 * Pi
+		r := 0.3 - 0.15*v
+		return center.Add(Vec{r * math.Cos(φ), 0.3 * v, r * math.Sin(φ)})
+	})
+}
+
+// Lighting by a mesh light should converge to the same brightness
+// as plain path tracing (where the light is replaced by its Object).
+// The lamp shade partially hides its own inside, which tests self-occlusion.
+func TestMeshLight_Converge(t *testing.T) {
+	white := materials.Matte(colorf.White.EV(-1))
+	shiny := materials.Microfacet(colorf.White, colorf.Gray(0.3), colorf.White)
+	emission := texture.Checkers(4, 2, colorf.White.EV(2), colorf.Color{0.5, 0.2, 0})
+	for _, m := range []Material{white, shiny} {
+		light := MeshLight(emission, testLampShade(Vec{0, 0.3, 0}))
+		cam := cameras.Projective(60*Deg).Translate(Vec{0, 0.8, 1.5}).YawPitchRoll(0, -20*Deg, 0)
+		sampled := NewScene(2, []Light{light}, test.Sheet(m, 0))
+		pathTraced := NewScene(2, []Light{}, test.Sheet(m, 0), light.Object())
+
+		got := average(sampled, cam, 64)
+		want := average(pathTraced, cam, 1024)
+		if math.Abs(got-want) > 0.02*want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// A glowing, textured lamp shade and a transformed glowing teapot.
+func TestMeshLight(t *testing.T) {
+	white := materials.Matte(colorf.White.EV(-0.3))
+	stripes := texture.Checkers(8, 0, colorf.Color{1, 0.8, 0.5}.EV(3), colorf.Color{0.05, 0.02, 0})
+	teapot := objects.PlyFile(nil, "../../assets/teapot.ply")
+	test.NPassSize(t,
+		NewScene(
+			2,
+			[]Light{
+				MeshLight(stripes, testLampShade(Vec{-0.5, 0.5, 0})),
+				Transformed(
+					MeshLight(colorf.Color{0.3, 0.6, 1}.EV(-1), teapot),
+					geom.ComposeLR(geom.Rotate(O, Ex, -90*Deg), geom.Scale(O, 0.06), geom.Translate(Vec{0.6, 0, -0.2})),
+				),
+			},
+			test.Sheet(white, 0),
+			test.Sphere(white, 0.4, Vec{0, 0.2, 0.3}),
+		),
+		cameras.Projective(60*Deg).Translate(Vec{0, 1, 2}).YawPitchRoll(0, -20*Deg, 0),
+		64,       // nPass
+		150, 100, // size
+		0.05,
+	)
+}
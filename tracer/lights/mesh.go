@@ -0,0 +1,222 @@
+package lights
+
+import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer/objects"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// MeshLight turns a triangle mesh into a light source, whose surface emits light
+// with the brightness given by the emission texture (evaluated at the mesh's UV coordinates).
+// E.g. neon signs, glowing text or lamp shades:
+// 	shade := objects.PlyFile(nil, "lampshade.ply")
+// 	light := MeshLight(Color{1, 0.9, 0.7}.EV(3), shade)
+//
+// The mesh may be constructed by any of the mesh functions in package objects
+// (Mesh, MeshWithUV, PlyFile, ObjFile, Rectangle, ...), see objects.Triangles.
+// The mesh's own material is not used.
+//
+// Both sides of the surface emit light. Light emitted by parts of the mesh that are
+// hidden behind other parts of the mesh (e.g. the inside of a closed mesh) is properly blocked.
+//
+// Triangles are sampled in proportion to their area times their (estimated) brightness,
+// so that bright parts of the mesh receive most samples.
+func MeshLight(emission texture.Texture, mesh objects.Interface) Light {
+	tris, ok := objects.Triangles(mesh)
+	if !ok {
+		panic("lights: MeshLight: not a triangle mesh")
+	}
+	if len(tris) == 0 {
+		panic("lights: MeshLight: empty mesh")
+	}
+
+	l := &meshLight{
+		mesh:     mesh,
+		emission: emission,
+		tris:     make([]meshLightTriangle, len(tris)),
+		cdf:      make([]float64, len(tris)),
+	}
+	faces := make([]objects.Interface, len(tris))
+	var totalPower float64
+	for i, t := range tris {
+		mt := &l.tris[i]
+		mt.MeshTriangle = t
+		n := t.Pos[1].Sub(t.Pos[0]).Cross(t.Pos[2].Sub(t.Pos[0]))
+		mt.area = n.Len() / 2
+		mt.normal = n.Normalized()
+		mt.brightness = mt.estimateBrightness(emission)
+		totalPower += mt.area * mt.brightness
+		faces[i] = objects.Triangle(&meshLightFace{l, i}, t.Pos[0], t.Pos[1], t.Pos[2])
+	}
+	if !(totalPower > 0) {
+		panic("lights: MeshLight: mesh does not emit light")
+	}
+
+	// Make sure that every triangle is sampled sometimes,
+	// in case the brightness was underestimated.
+	minBrightness := 1e-3 * totalPower / l.area()
+	acc := 0.0
+	for i := range l.tris {
+		t := &l.tris[i]
+		t.brightness = math.Max(t.brightness, minBrightness)
+		acc += t.area * t.brightness
+		l.cdf[i] = acc
+	}
+	l.totalPower = acc
+	l.object = objects.Tree(faces...)
+	return l
+}
+
+type meshLight struct {
+	mesh       objects.Interface // as passed to MeshLight, for Describe
+	emission   texture.Texture
+	tris       []meshLightTriangle
+	cdf        []float64 // cumulative area*brightness of triangles
+	totalPower float64   // sum of area*brightness
+	object     objects.Interface
+}
+
+type meshLightTriangle struct {
+	objects.MeshTriangle
+	area       float64
+	normal     Vec
+	brightness float64 // estimated average brightness, determines the sampling probability
+}
+
+// Sample implements tracer.Light.
+func (l *meshLight) Sample(ctx *Ctx, target Vec) (Vec, Color) {
+	u, v := ctx.Generate2()
+	i, u := searchCDF(l.cdf, u)
+	t := &l.tris[i]
+
+	// uniformly distributed point on the triangle, with barycentric coordinates b1, b2
+	su := math.Sqrt(u)
+	b1, b2 := su*(1-v), su*v
+	pos := t.at(b1, b2)
+
+	delta := target.Sub(pos)
+	dist := delta.Len()
+	dir := delta.Mul(1 / dist)
+	cosθ := math.Abs(t.normal.Dot(dir))
+	if cosθ == 0 || l.occluded(ctx, target, pos, dist) {
+		return pos, Color{}
+	}
+
+	// Like planar lights, the surface brightness is normalized so that a white reflector
+	// yields intens*cosθ. Hence the factor 1/π.
+	pdf := t.brightness / l.totalPower // per unit area
+	intens := l.emission.At(t.uv(b1, b2)).Mul(cosθ / (Pi * dist * dist * pdf))
+
+	// offset from the surface towards the target, to avoid self-shadowing
+	// by objects that coincide with the light (e.g. a sign on a wall).
+	if t.normal.Dot(dir) < 0 {
+		pos = pos.MAdd(-Tiny, t.normal)
+	} else {
+		pos = pos.MAdd(Tiny, t.normal)
+	}
+	return pos, intens
+}
+
+// occluded returns true if the point pos of the mesh, at distance dist from target,
+// is hidden from target by another part of the mesh.
+func (l *meshLight) occluded(ctx *Ctx, target, pos Vec, dist float64) bool {
+	r := ctx.Ray()
+	defer ctx.PutRay(r)
+	r.Start = target
+	r.Dir = pos.Sub(target).Mul(1 / dist)
+	t := l.object.Intersect(r).T
+	return t > 0 && t < dist*(1-1e-6)-Tiny
+}
+
+// PDF implements tracer.PDFLight.
+func (l *meshLight) PDF(target, dir Vec) float64 {
+	h := l.object.Intersect(&Ray{Start: target, Dir: dir})
+	f, ok := h.Material.(*meshLightFace)
+	if !(h.T > 0) || !ok {
+		return 0
+	}
+	t := &l.tris[f.i]
+	cosθ := math.Abs(t.normal.Dot(dir))
+	if cosθ == 0 {
+		return 0
+	}
+	// probability density per area, converted to per solid angle
+	pdf := t.brightness / l.totalPower
+	return pdf * h.T * h.T / cosθ
+}
+
+// Object implements tracer.Light.
+func (l *meshLight) Object() Object {
+	return l.object
+}
+
+// LightBounds implements tracer.ImportanceLight.
+func (l *meshLight) LightBounds() (LightBounds, bool) {
+	bb := l.object.Bounds()
+	center := bb.Min.Add(bb.Max).Mul(0.5)
+	return LightBounds{
+		// like planar lights: peak intensity totalPower/π, vs. power/4π for a point light
+		Power:  Color{1, 1, 1}.Mul(4 * l.totalPower),
+		Center: center,
+		Radius: bb.Max.Sub(center).Len(),
+	}, true
+}
+
+func (l *meshLight) area() float64 {
+	a := 0.0
+	for i := range l.tris {
+		a += l.tris[i].area
+	}
+	return a
+}
+
+// at returns the position with barycentric coordinates b1, b2 (with respect to vertices 1 and 2).
+func (t *meshLightTriangle) at(b1, b2 float64) Vec {
+	p := t.Pos
+	return p[0].Mul(1-b1-b2).MAdd(b1, p[1]).MAdd(b2, p[2])
+}
+
+// uv returns the UV coordinates at barycentric coordinates b1, b2,
+// as a Vec suitable for texture look-up.
+func (t *meshLightTriangle) uv(b1, b2 float64) Vec {
+	uv := t.UV
+	b0 := 1 - b1 - b2
+	return Vec{
+		b0*uv[0][0] + b1*uv[1][0] + b2*uv[2][0],
+		b0*uv[0][1] + b1*uv[1][1] + b2*uv[2][1],
+		0,
+	}
+}
+
+// estimateBrightness returns the average brightness of the emission
+// at the vertices and center of the triangle.
+func (t *meshLightTriangle) estimateBrightness(emission texture.Texture) float64 {
+	b := 0.0
+	for _, c := range [][2]float64{{0, 0}, {1, 0}, {0, 1}, {1. / 3, 1. / 3}} {
+		b += emission.At(t.uv(c[0], c[1])).Gray()
+	}
+	return b / 4
+}
+
+// meshLightFace is the material of a mesh light's triangles,
+// it records the triangle's index for PDF.
+type meshLightFace struct {
+	l *meshLight
+	i int
+}
+
+// Shade implements tracer.Material.
+func (m *meshLightFace) Shade(_ *Ctx, _ *Scene, _ *Ray, h HitCoords) Color {
+	// objects.Triangle assigns UV coordinates (1,0) and (0,1) to vertices 1 and 2,
+	// hence the local coordinates are barycentric.
+	t := &m.l.tris[m.i]
+	return m.l.emission.At(t.uv(h.Local[0], h.Local[1]))
+}
+
+// Describe implements describe.Describer.
+func (l *meshLight) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "mesh", "emission": e.Describe(l.emission), "object": e.Describe(l.mesh)}
+}
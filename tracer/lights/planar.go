@@ -1,6 +1,9 @@
 package lights
 
 import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/tracer/materials"
 	"github.com/barnex/bruteray/tracer/objects"
@@ -49,14 +52,41 @@ func SunLight(brightnessAtEarth Color, angularDiam float64, yaw, pitch float64)
 		geom.Rotate(O, Ex, pitch),
 		geom.Rotate(O, Ey, yaw),
 	)
-	return Transformed(disk, transf)
+	return &sun{
+		transformedPDF:    Transformed(disk, transf).(*transformedPDF),
+		brightnessAtEarth: brightnessAtEarth,
+		angularDiam:       angularDiam,
+		yaw:               yaw,
+		pitch:             pitch,
+	}
+}
+
+// sun is a transformed disk light, which remembers the parameters
+// of SunLight so that it can describe itself as such.
+type sun struct {
+	*transformedPDF
+	brightnessAtEarth       Color
+	angularDiam, yaw, pitch float64
+}
+
+// Describe implements describe.Describer.
+func (l *sun) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{
+		"type":  "sun",
+		"color": describe.Color(l.brightnessAtEarth),
+		"diam":  describe.Degrees(l.angularDiam),
+		"yaw":   describe.Degrees(l.yaw),
+		"pitch": describe.Degrees(l.pitch),
+	}
 }
 
 // planar is a rectangle or disk light.
 type planar struct {
+	brightness   Color
 	w, h         float64
 	center       Vec
-	totalPower   Color // W/m2 (pi?)
+	area         float64 // surface area
+	totalPower   Color   // W/m2 (pi?)
 	object       objects.Interface
 	restrict     objects.Interface
 	transfSample func(u, v float64) (x, y float64)
@@ -71,9 +101,11 @@ func planarLight(brightness Color, w, h float64, center Vec, relSurf float64, re
 		restrict = allSpace{}
 	}
 	return &planar{
+		brightness:   brightness,
 		w:            w,
 		h:            h,
 		center:       center,
+		area:         w * h * relSurf,
 		totalPower:   brightness.Mul(w * h * relSurf),
 		restrict:     restrict,
 		object:       objects.Restrict(objects.Rectangle(mat, w, h, center), restrict),
@@ -94,6 +126,32 @@ func (l *planar) Sample(ctx *Ctx, target Vec) (Vec, Color) {
 	return p, l.totalPower.Mul(I)
 }
 
+// PDF implements tracer.PDFLight.
+func (l *planar) PDF(target, dir Vec) float64 {
+	n := Vec{0, -1, 0}
+	cosTheta := -n.Dot(dir)
+	if cosTheta <= 0 {
+		return 0 // light only emits in the -y direction
+	}
+	t := l.object.Intersect(&Ray{Start: target, Dir: dir}).T
+	if !(t > 0) {
+		return 0
+	}
+	// Sample draws positions uniformly over the surface,
+	// convert probability density per area to per solid angle.
+	return (t * t) / (l.area * cosTheta)
+}
+
+// LightBounds implements tracer.ImportanceLight.
+func (l *planar) LightBounds() (LightBounds, bool) {
+	return LightBounds{
+		Power:  l.totalPower.Mul(4), // peak intensity totalPower/π, vs. power/4π for a point light
+		Center: l.center,
+		Radius: 0.5 * math.Sqrt(l.w*l.w+l.h*l.h),
+		Normal: Vec{0, -1, 0},
+	}, true
+}
+
 func (l *planar) samplePos(ctx *Ctx) Vec {
 	x, y := l.transfSample(ctx.Generate2())
 	return Vec{(0.5 * x) * l.w, Tiny, (0.5 * y) * l.h}.Add(l.center)
@@ -121,6 +179,14 @@ func (l *planar) Object() Object {
 	return l.object
 }
 
+// Describe implements describe.Describer.
+func (l *planar) Describe(e *describe.Encoder) interface{} {
+	if _, ok := l.restrict.(allSpace); ok {
+		return describe.Node{"type": "rectangle", "color": describe.Color(l.brightness), "size": []float64{l.w, l.h}, "center": l.center}
+	}
+	return describe.Node{"type": "disk", "color": describe.Color(l.brightness), "diam": l.w, "center": l.center}
+}
+
 type allSpace struct{}
 
 func (allSpace) Inside(Vec) bool {
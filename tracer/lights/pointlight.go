@@ -1,6 +1,7 @@
 package lights
 
 import (
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
@@ -24,3 +25,13 @@ func (l *point) Object() Object {
 func (*point) Intersect(*Ray) HitRecord {
 	return HitRecord{}
 }
+
+// LightBounds implements tracer.ImportanceLight.
+func (l *point) LightBounds() (LightBounds, bool) {
+	return LightBounds{Power: l.power, Center: l.pos}, true
+}
+
+// Describe implements describe.Describer.
+func (l *point) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "point", "color": describe.Color(l.power), "position": l.pos}
+}
@@ -0,0 +1,188 @@
+package lights
+
+import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// Daylight returns a physically based sky and sun, for outdoor scenes. E.g.:
+// 	lights := Daylight(3, -30*Deg, 40*Deg) // clear afternoon
+//
+// The sun's position is given by yaw and pitch, like SunLight.
+// The sky is as returned by Sky, with the corresponding sun.
+// The sun's color is the sunlight transmitted through the atmosphere
+// (according to the turbidity), which is white at noon and turns red
+// towards sunset.
+//
+// Brightness is normalized so that a white matte surface facing
+// an unobstructed sun in the zenith, without atmosphere, would have brightness 1.
+// With the sun high in a clear sky, a white matte floor then has a brightness of about 0.7,
+// the sky contributing about a third. Towards sunset, or with increasing turbidity,
+// the sun dims much faster than the sky.
+func Daylight(turbidity, yaw, pitch float64) []Light {
+	const sunAngularDiam = 0.53 * Deg
+	sun := SunLight(sunColor(turbidity, pitch), sunAngularDiam, yaw, pitch)
+	return []Light{Sky(turbidity, yaw, pitch), sun}
+}
+
+// Sky returns a procedural daylight sky according to the Preetham model:
+// the sky's brightness and color depend on the sun's position (given by yaw and pitch, like SunLight)
+// and the atmospheric turbidity, i.e. the amount of haze:
+// 	2: very clear sky
+// 	3: clear sky
+// 	6: hazy
+// 	10: very hazy, nearly overcast
+// Sensible values range from 2 to 10. The pitch must be positive (sun above the horizon).
+//
+// The sky itself does not include the sun, see Daylight for a sky with sun.
+//
+// Like EnvironmentLight, the sky is seen by all rays that do not hit any object
+// (without the need for a Backdrop), and it illuminates the scene, importance-sampled by brightness.
+// Below the horizon, the sky continues the horizon's color
+// (scenes typically have a ground that hides it).
+//
+// See A. J. Preetham, P. Shirley, B. Smits, "A Practical Analytic Model for Daylight" (1999).
+func Sky(turbidity, yaw, pitch float64) Light {
+	if pitch <= 0 || pitch > 90*Deg {
+		panic("lights: Sky: sun must be above the horizon, need 0 < pitch <= 90 degrees")
+	}
+	m := newPreetham(turbidity, sunDir(yaw, pitch))
+	// Resolution of the importance sampling table.
+	// The radiance itself is evaluated exactly, so this only affects noise.
+	const w, h = 256, 128
+	return &sky{newEnvironment(w, h, m.radiance), turbidity, yaw, pitch}
+}
+
+// sky is the environment returned by Sky,
+// which remembers its parameters so that it can describe itself.
+type sky struct {
+	*environment
+	turbidity, yaw, pitch float64
+}
+
+// Describe implements describe.Describer.
+func (l *sky) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "sky", "turbidity": l.turbidity, "yaw": describe.Degrees(l.yaw), "pitch": describe.Degrees(l.pitch)}
+}
+
+// sunDir returns the direction towards a sun at the given yaw and pitch,
+// consistent with SunLight.
+func sunDir(yaw, pitch float64) Vec {
+	return geom.ComposeLR(
+		geom.Rotate(O, Ex, pitch),
+		geom.Rotate(O, Ey, yaw),
+	).TransformDir(Vec{0, 0, -1})
+}
+
+// preetham evaluates the Preetham sky model
+// for given turbidity and sun direction.
+type preetham struct {
+	sun       Vec           // unit vector towards the sun
+	perez     [3][5]float64 // Perez distribution coefficients A..E for Y, x, y
+	zenith    [3]float64    // Y, x, y in the zenith
+	normalize [3]float64    // zenith value divided by the Perez function at the zenith
+}
+
+func newPreetham(T float64, sun Vec) *preetham {
+	θs := math.Acos(math.Min(1, sun[geom.Y])) // zenith angle of the sun
+	m := &preetham{sun: sun}
+
+	m.perez = [3][5]float64{
+		{0.1787*T - 1.4630, -0.3554*T + 0.4275, -0.0227*T + 5.3251, 0.1206*T - 2.5771, -0.0670*T + 0.3703},
+		{-0.0193*T - 0.2592, -0.0665*T + 0.0008, -0.0004*T + 0.2125, -0.0641*T - 0.8989, -0.0033*T + 0.0452},
+		{-0.0167*T - 0.2608, -0.0950*T + 0.0092, -0.0079*T + 0.2102, -0.0441*T - 1.6537, -0.0109*T + 0.0529},
+	}
+
+	// zenith luminance (kcd/m2) and chromaticity
+	χ := (4.0/9.0 - T/120) * (Pi - 2*θs)
+	m.zenith[0] = (4.0453*T-4.9710)*math.Tan(χ) - 0.2155*T + 2.4192
+	θ2, θ3 := θs*θs, θs*θs*θs
+	m.zenith[1] = T*T*(0.00166*θ3-0.00375*θ2+0.00209*θs) +
+		T*(-0.02903*θ3+0.06377*θ2-0.03202*θs+0.00394) +
+		(0.11693*θ3 - 0.21196*θ2 + 0.06052*θs + 0.25886)
+	m.zenith[2] = T*T*(0.00275*θ3-0.00610*θ2+0.00317*θs) +
+		T*(-0.04214*θ3+0.08970*θ2-0.04153*θs+0.00516) +
+		(0.15346*θ3 - 0.26756*θ2 + 0.06670*θs + 0.26688)
+
+	for i := range m.normalize {
+		m.normalize[i] = m.zenith[i] / perez(&m.perez[i], 1, math.Cos(θs), θs)
+	}
+	return m
+}
+
+// radiance returns the brightness of the sky seen in direction dir (unit vector).
+func (m *preetham) radiance(dir Vec) Color {
+	// Below the horizon, continue the horizon. Also avoids the singularity of the Perez function.
+	const minCos = 0.01
+	dir[geom.Y] = math.Max(dir[geom.Y], minCos)
+	dir = dir.Normalized()
+
+	cosθ := dir[geom.Y]
+	cosγ := math.Max(-1, math.Min(1, dir.Dot(m.sun)))
+	γ := math.Acos(cosγ)
+
+	var Yxy [3]float64
+	for i := range Yxy {
+		Yxy[i] = m.normalize[i] * perez(&m.perez[i], cosθ, cosγ, γ)
+	}
+	return skyColor(Yxy[0], Yxy[1], Yxy[2])
+}
+
+// perez is the Perez sky distribution function with coefficients c = A..E,
+// for given cosine of the zenith angle, and angle γ with the sun.
+func perez(c *[5]float64, cosθ, cosγ, γ float64) float64 {
+	A, B, C, D, E := c[0], c[1], c[2], c[3], c[4]
+	return (1 + A*math.Exp(B/cosθ)) * (1 + C*math.Exp(D*γ) + E*cosγ*cosγ)
+}
+
+// sunIlluminance is the illuminance (lux) of the sun in the zenith, without atmosphere,
+// which is normalized to brightness 1.
+const sunIlluminance = 128000
+
+// skyColor converts luminance Y (kcd/m2) and CIE chromaticity x, y to a linear sRGB Color,
+// normalized to sunIlluminance.
+//
+// A white matte surface under a uniform sky of luminance L has a luminance L (since its
+// illuminance is πL and its luminance is illuminance/π). So sky luminance is normalized
+// like the luminance of a white surface lit by the sun: sunIlluminance/π.
+func skyColor(Y, x, y float64) Color {
+	Y *= 1000 * Pi / sunIlluminance
+	if y <= 0 {
+		return Color{}
+	}
+	// CIE xyY to XYZ to linear sRGB (D65)
+	X := x / y * Y
+	Z := (1 - x - y) / y * Y
+	return Color{
+		R: math.Max(0, 3.2406*X-1.5372*Y-0.4986*Z),
+		G: math.Max(0, -0.9689*X+1.8758*Y+0.0415*Z),
+		B: math.Max(0, 0.0557*X-0.2040*Y+1.0570*Z),
+	}
+}
+
+// sunColor returns the fraction of sunlight transmitted through the atmosphere,
+// at wavelengths representative for red, green and blue,
+// accounting for Rayleigh scattering by molecules and Mie scattering by aerosols
+// (but not for absorption by ozone and water vapor).
+// See Preetham et al., Appendix A.
+func sunColor(turbidity, pitch float64) Color {
+	θs := 90 - pitch/Deg // zenith angle in degrees
+	// relative optical mass (air mass) according to Kasten
+	m := 1 / (math.Cos(θs*Deg) + 0.15*math.Pow(93.885-θs, -1.253))
+
+	const α = 1.3                              // ratio of small to large particle sizes
+	β := 0.04608*turbidity - 0.04586           // Ångström turbidity coefficient
+	transmittance := func(λ float64) float64 { // λ in µm
+		rayleigh := math.Exp(-0.008735 * math.Pow(λ, -4.08) * m)
+		aerosol := math.Exp(-β * math.Pow(λ, -α) * m)
+		return rayleigh * aerosol
+	}
+	return Color{
+		R: transmittance(0.680),
+		G: transmittance(0.550),
+		B: transmittance(0.440),
+	}
+}
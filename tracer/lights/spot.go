@@ -0,0 +1,151 @@
+package lights
+
+import (
+	"io"
+	"math"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/tracer/lights/ies"
+	"github.com/barnex/bruteray/tracer/objects"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// SpotLight constructs a point-like light source at position pos,
+// that only emits light in a cone pointing down (along -Y), like a ceiling spot.
+// Use Transformed to point it in another direction. E.g.:
+// 	spot := SpotLight(White.EV(4), 20*Deg, 30*Deg, Vec{0, 3, 0})
+//
+// Inside the inner cone (angle with the -Y axis up to innerAngle), the spot is as bright
+// as a PointLight with the given power. Between the inner and outer angle, the intensity
+// falls off smoothly to zero, which gives a soft edge.
+// Angles may range from 0 to 180 degrees, and the inner angle must not exceed the outer angle.
+func SpotLight(power Color, innerAngle, outerAngle float64, pos Vec) Light {
+	if innerAngle > outerAngle {
+		panic("lights: SpotLight: inner angle larger than outer angle")
+	}
+	cosIn, cosOut := math.Cos(innerAngle), math.Cos(outerAngle)
+	return &goniometric{
+		power:      power,
+		pos:        pos,
+		innerAngle: innerAngle,
+		outerAngle: outerAngle,
+		halfSpace:  outerAngle <= 90*Deg,
+		profile: func(dir Vec) float64 {
+			cos := -dir[geom.Y]
+			switch {
+			case cos >= cosIn:
+				return 1
+			case cos <= cosOut:
+				return 0
+			default:
+				return smoothstep((cos - cosOut) / (cosIn - cosOut))
+			}
+		},
+	}
+}
+
+// IESLight constructs a point-like light source at position pos,
+// whose angular distribution of emitted light is given by a photometric profile,
+// typically provided by a fixture's manufacturer. E.g.:
+// 	profile, err := ies.ParseFile("downlight.ies")
+// 	...
+// 	light := IESLight(White.EV(4), profile, Vec{0, 3, 0})
+//
+// The profile's vertical angle 0 (nadir) points along -Y, and horizontal angle 90
+// along -Z (i.e., counterclockwise from +X as seen from above).
+// Use Transformed to orient the light differently.
+//
+// Only the shape of the profile is used, not its absolute intensity:
+// in the direction of its maximum intensity, the light is as bright as a PointLight of the given power.
+func IESLight(power Color, profile *ies.Profile, pos Vec) Light {
+	max := profile.Max()
+	if max <= 0 {
+		panic("lights: IESLight: profile does not emit any light")
+	}
+	return &goniometric{
+		power:     power,
+		pos:       pos,
+		ies:       profile,
+		halfSpace: profile.Vertical[len(profile.Vertical)-1] <= 90,
+		profile: func(dir Vec) float64 {
+			vertical := math.Acos(math.Max(-1, math.Min(1, -dir[geom.Y]))) / Deg
+			horizontal := math.Atan2(-dir[geom.Z], dir[geom.X]) / Deg
+			return profile.At(vertical, horizontal) / max
+		},
+	}
+}
+
+// goniometric is a point light whose intensity depends on the direction.
+type goniometric struct {
+	power     Color
+	pos       Vec
+	profile   func(dir Vec) float64 // relative intensity (0..1) emitted in direction dir (unit vector)
+	halfSpace bool                  // only emits downwards
+
+	// construction parameters, for Describe
+	innerAngle, outerAngle float64      // SpotLight
+	ies                    *ies.Profile // IESLight, nil for SpotLight
+}
+
+// Sample implements tracer.Light.
+func (l *goniometric) Sample(ctx *Ctx, target Vec) (Vec, Color) {
+	delta := target.Sub(l.pos)
+	d2 := delta.Len2()
+	p := l.profile(delta.Mul(1 / math.Sqrt(d2)))
+	if p == 0 {
+		return l.pos, Color{}
+	}
+	return l.pos, l.power.Mul(p * (1 / (4 * Pi)) / d2)
+}
+
+// Object implements tracer.Light.
+// The light itself is invisible, like a PointLight.
+// Unlike a PointLight, the object can be transformed (see Transformed).
+func (l *goniometric) Object() Object {
+	return l
+}
+
+// Intersect implements tracer.Object.
+func (*goniometric) Intersect(*Ray) HitRecord {
+	return HitRecord{}
+}
+
+// Bounds implements objects.Interface.
+func (l *goniometric) Bounds() objects.BoundingBox {
+	return objects.BoundingBox{Min: l.pos, Max: l.pos}
+}
+
+// Inside implements objects.Interface.
+func (*goniometric) Inside(Vec) bool {
+	return false
+}
+
+// LightBounds implements tracer.ImportanceLight.
+func (l *goniometric) LightBounds() (LightBounds, bool) {
+	b := LightBounds{Power: l.power, Center: l.pos}
+	if l.halfSpace {
+		b.Normal = Vec{0, -1, 0}
+	}
+	return b, true
+}
+
+// Describe implements describe.Describer.
+func (l *goniometric) Describe(e *describe.Encoder) interface{} {
+	if l.ies != nil {
+		file := e.File(l.ies, "profile.ies", func(w io.Writer) error { return ies.Write(w, l.ies) })
+		return describe.Node{"type": "ies", "color": describe.Color(l.power), "file": file, "position": l.pos}
+	}
+	return describe.Node{
+		"type":       "spot",
+		"color":      describe.Color(l.power),
+		"innerAngle": describe.Degrees(l.innerAngle),
+		"outerAngle": describe.Degrees(l.outerAngle),
+		"position":   l.pos,
+	}
+}
+
+// smoothstep maps 0..1 to 0..1 with zero slope at both ends.
+func smoothstep(x float64) float64 {
+	return x * x * (3 - 2*x)
+}
@@ -1,6 +1,7 @@
 package lights
 
 import (
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/tracer/objects"
 	. "github.com/barnex/bruteray/tracer/types"
@@ -21,13 +22,17 @@ import (
 //
 // TODO: arguments: first transform, then object
 func Transformed(l Light, t *geom.AffineTransform) Light {
-	return &transformed{
+	tl := &transformed{
 		forward: *t,
 		inverse: *t.Inverse(),
 		orig:    l,
 		// here be dragons
 		object: objects.Transformed(l.Object().(objects.Interface), t),
 	}
+	if _, ok := l.(PDFLight); ok {
+		return &transformedPDF{tl}
+	}
+	return tl
 }
 
 type transformed struct {
@@ -47,3 +52,43 @@ func (l *transformed) Sample(ctx *Ctx, target Vec) (Vec, Color) {
 	pos := l.forward.TransformPoint(tpos)
 	return pos, bright
 }
+
+// LightBounds implements tracer.ImportanceLight,
+// if the original light does.
+func (l *transformed) LightBounds() (LightBounds, bool) {
+	orig, ok := l.orig.(ImportanceLight)
+	if !ok {
+		return LightBounds{}, false
+	}
+	b, ok := orig.LightBounds()
+	if !ok {
+		return LightBounds{}, false
+	}
+	// Sample returns the original intensity at the transformed distance,
+	// so the apparent power scales with the distance squared.
+	scale := l.forward.TransformDir(Ex).Len()
+	b.Power = b.Power.Mul(scale * scale)
+	b.Center = l.forward.TransformPoint(b.Center)
+	b.Radius *= scale
+	if b.Normal != (Vec{}) {
+		b.Normal = l.forward.TransformDir(b.Normal).Normalized()
+	}
+	return b, true
+}
+
+// Describe implements describe.Describer.
+func (l *transformed) Describe(e *describe.Encoder) interface{} {
+	return describe.WithTransform(e.Describe(l.orig), &l.forward)
+}
+
+// transformedPDF is a transformed PDFLight.
+type transformedPDF struct {
+	*transformed
+}
+
+// PDF implements tracer.PDFLight.
+// Rotations and uniform scaling preserve angles, hence solid angle densities.
+func (l *transformedPDF) PDF(target, dir Vec) float64 {
+	tdir := l.inverse.TransformDir(dir).Normalized()
+	return l.orig.(PDFLight).PDF(l.inverse.TransformPoint(target), tdir)
+}
@@ -0,0 +1,252 @@
+package tracer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	. "github.com/barnex/bruteray/geom"
+	. "github.com/barnex/bruteray/imagef/colorf"
+)
+
+// LightSelection determines how DirectLight chooses which light sources to sample.
+// See Scene.SetLightSelection.
+type LightSelection int
+
+const (
+	// SampleAllLights samples every light source for every shading point (the default).
+	// The cost is proportional to the number of lights, but each sample is as accurate as possible.
+	SampleAllLights LightSelection = iota
+
+	// SampleLightsByPower samples one light source per shading point,
+	// chosen with probability proportional to its power.
+	// Suited for many lights of similar importance everywhere.
+	SampleLightsByPower
+
+	// SampleLightTree samples one light source per shading point,
+	// chosen by traversing a bounding volume hierarchy (BVH) of lights.
+	// At each level, the choice is weighted by an estimate of the contribution
+	// of each branch, based on its power, distance and orientation.
+	// Suited for many lights spread out over a large scene (e.g., candles).
+	SampleLightTree
+)
+
+// An ImportanceLight is a Light that reports its power and extent,
+// allowing the Scene to select the most important lights (see SetLightSelection).
+// Lights that do not implement ImportanceLight are always sampled.
+type ImportanceLight interface {
+	Light
+
+	// LightBounds returns the light's power and extent.
+	// ok is false if they are unknown, the light is then always sampled.
+	LightBounds() (b LightBounds, ok bool)
+}
+
+// LightBounds describes the power and extent of a light source.
+type LightBounds struct {
+	Power  Color   // power of a point light with the same peak intensity (only relative values between lights matter)
+	Center Vec     // center of a sphere enclosing the light's surface
+	Radius float64 // radius of the enclosing sphere
+	Normal Vec     // unit vector in which a one-sided light emits (into the half-space), zero if light is emitted in all directions
+}
+
+// SetLightSelection determines how light sources are sampled. See LightSelection.
+// It should be called before rendering, it is not safe for concurrent use.
+func (s *Scene) SetLightSelection(sel LightSelection) {
+	switch sel {
+	default:
+		panic(fmt.Sprintf("tracer: bad LightSelection: %v", sel))
+	case SampleAllLights:
+		s.lightTree = nil
+	case SampleLightsByPower, SampleLightTree:
+		s.lightTree = buildLightTree(s.lights, sel == SampleLightTree)
+	}
+}
+
+// lightTree is a binary tree of lights, used to pick one light at random, by importance.
+// With SampleLightsByPower, importance is just power, and the tree is only used for logarithmic look-up.
+type lightTree struct {
+	nodes   []lightNode // root is nodes[0], if any
+	leaf    []int       // leaf[i] is the node index of Scene.lights[i], -1 if not in the tree
+	spatial bool        // weigh by distance and orientation, not only power
+}
+
+type lightNode struct {
+	LightBounds
+	power    float64 // LightBounds.Power as gray value
+	children [2]int  // indices of child nodes, -1 for a leaf
+	parent   int     // index of parent node, -1 for the root
+	light    int     // index in Scene.lights, for a leaf
+}
+
+func buildLightTree(lights []Light, spatial bool) *lightTree {
+	t := &lightTree{leaf: make([]int, len(lights)), spatial: spatial}
+	var idx []int
+	for i, l := range lights {
+		t.leaf[i] = -1
+		if l, ok := l.(ImportanceLight); ok {
+			if b, ok := l.LightBounds(); ok && b.Power.Gray() > 0 {
+				idx = append(idx, i)
+			}
+		}
+	}
+	if len(idx) > 0 {
+		t.build(lights, idx, -1)
+	}
+	return t
+}
+
+// build adds the subtree for lights[idx] with given parent, returns the index of its root.
+func (t *lightTree) build(lights []Light, idx []int, parent int) int {
+	n := len(t.nodes)
+	t.nodes = append(t.nodes, lightNode{children: [2]int{-1, -1}, parent: parent, light: -1})
+
+	if len(idx) == 1 {
+		i := idx[0]
+		b, _ := lights[i].(ImportanceLight).LightBounds()
+		t.nodes[n].LightBounds = b
+		t.nodes[n].power = b.Power.Gray()
+		t.nodes[n].light = i
+		t.leaf[i] = n
+		return n
+	}
+
+	// split at the median along the axis where the light centers are most spread out
+	var min, max Vec
+	for j, i := range idx {
+		b, _ := lights[i].(ImportanceLight).LightBounds()
+		for c := range b.Center {
+			if j == 0 || b.Center[c] < min[c] {
+				min[c] = b.Center[c]
+			}
+			if j == 0 || b.Center[c] > max[c] {
+				max[c] = b.Center[c]
+			}
+		}
+	}
+	axis := argMax(max.Sub(min))
+	sort.SliceStable(idx, func(a, b int) bool {
+		ba, _ := lights[idx[a]].(ImportanceLight).LightBounds()
+		bb, _ := lights[idx[b]].(ImportanceLight).LightBounds()
+		return ba.Center[axis] < bb.Center[axis]
+	})
+	half := len(idx) / 2
+	left := t.build(lights, idx[:half], n)
+	right := t.build(lights, idx[half:], n)
+	t.nodes[n].children = [2]int{left, right}
+	t.nodes[n].LightBounds = t.nodes[left].union(&t.nodes[right].LightBounds)
+	t.nodes[n].power = t.nodes[left].power + t.nodes[right].power
+	return n
+}
+
+// union returns bounds that enclose both a and b.
+func (a *LightBounds) union(b *LightBounds) LightBounds {
+	u := LightBounds{Power: a.Power.Add(b.Power)}
+
+	// smallest sphere enclosing both spheres
+	d := b.Center.Sub(a.Center).Len()
+	switch {
+	case d+b.Radius <= a.Radius:
+		u.Center, u.Radius = a.Center, a.Radius
+	case d+a.Radius <= b.Radius:
+		u.Center, u.Radius = b.Center, b.Radius
+	default:
+		u.Radius = (d + a.Radius + b.Radius) / 2
+		u.Center = a.Center.MAdd((u.Radius-a.Radius)/d, b.Center.Sub(a.Center))
+	}
+
+	// only keep the orientation if both agree
+	if a.Normal == b.Normal {
+		u.Normal = a.Normal
+	}
+	return u
+}
+
+// importance estimates the contribution of the lights in node n to point p.
+// It is only zero if the lights certainly do not illuminate p.
+func (t *lightTree) importance(n *lightNode, p Vec) float64 {
+	if !t.spatial {
+		return n.power
+	}
+	delta := p.Sub(n.Center)
+	d2 := delta.Len2()
+	r2 := n.Radius * n.Radius
+
+	orient := 1.0
+	if n.Normal != (Vec{}) && d2 > r2 {
+		// cosine of the angle between the normal and the direction towards p,
+		// reduced by the half-angle subtended by the bounding sphere.
+		d := math.Sqrt(d2)
+		θ := math.Acos(math.Max(-1, math.Min(1, n.Normal.Dot(delta)/d)))
+		θs := math.Asin(n.Radius / d)
+		orient = math.Cos(math.Max(0, θ-θs))
+		if orient <= 0 {
+			return 0 // p is behind all lights in the node
+		}
+	}
+	return n.power * orient / math.Max(d2, r2)
+}
+
+// sample chooses a light for point p, using random number u.
+// It returns the light's index in Scene.lights and the probability of choosing it,
+// or -1 if no light illuminates p.
+func (t *lightTree) sample(u float64, p Vec) (light int, prob float64) {
+	if len(t.nodes) == 0 {
+		return -1, 0
+	}
+	prob = 1
+	n := &t.nodes[0]
+	for n.light < 0 {
+		c0, c1 := &t.nodes[n.children[0]], &t.nodes[n.children[1]]
+		w0, w1 := t.importance(c0, p), t.importance(c1, p)
+		if w0+w1 == 0 {
+			return -1, 0
+		}
+		p0 := w0 / (w0 + w1)
+		if u < p0 {
+			u /= p0
+			prob *= p0
+			n = c0
+		} else {
+			u = (u - p0) / (1 - p0)
+			prob *= 1 - p0
+			n = c1
+		}
+	}
+	return n.light, prob
+}
+
+// probability returns the probability that sample chooses light i for point p.
+// It returns 1 for lights that are not in the tree (which are always sampled).
+func (t *lightTree) probability(i int, p Vec) float64 {
+	n := t.leaf[i]
+	if n < 0 {
+		return 1
+	}
+	prob := 1.0
+	for t.nodes[n].parent >= 0 {
+		parent := &t.nodes[t.nodes[n].parent]
+		c0, c1 := &t.nodes[parent.children[0]], &t.nodes[parent.children[1]]
+		w0, w1 := t.importance(c0, p), t.importance(c1, p)
+		if w0+w1 == 0 {
+			return 0
+		}
+		if n == parent.children[0] {
+			prob *= w0 / (w0 + w1)
+		} else {
+			prob *= w1 / (w0 + w1)
+		}
+		n = t.nodes[n].parent
+	}
+	return prob
+}
+
+func argMax(v Vec) int {
+	a := 0
+	for i := range v {
+		if v[i] > v[a] {
+			a = i
+		}
+	}
+	return a
+}
@@ -1,6 +1,7 @@
 package materials
 
 import (
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/imagef/colorf"
 	"github.com/barnex/bruteray/texture"
 	. "github.com/barnex/bruteray/tracer"
@@ -11,12 +12,16 @@ func BlendMap(t texture.Texture, a, b Material) Func {
 		key1 := t.At(h.Local).R
 		key2 := 1 - key1
 		var ca, cb Color
+		w := ctx.DirectWeight()
 		if key1 > 0 {
+			ctx.SetDirectWeight(w * key1)
 			ca = a.Shade(ctx, s, r, h)
 		}
 		if key2 > 0 {
+			ctx.SetDirectWeight(w * key2)
 			cb = b.Shade(ctx, s, r, h)
 		}
+		ctx.SetDirectWeight(w)
 		return ca.Mul(key1).MAdd(key2, cb)
 	}
 }
@@ -46,8 +51,26 @@ type blend struct {
 	matB Material
 }
 
+// Albedo implements tracer.AlbedoMaterial.
+func (m *blend) Albedo(h HitCoords) Color {
+	return AlbedoOf(m.matA, h).Mul(m.a).MAdd(m.b, AlbedoOf(m.matB, h))
+}
+
 func (m *blend) Shade(ctx *Ctx, s *Scene, r *Ray, h HitCoords) Color {
+	w := ctx.DirectWeight()
+	ctx.SetDirectWeight(w * m.a)
 	ca := m.matA.Shade(ctx, s, r, h)
+	ctx.SetDirectWeight(w * m.b)
 	cb := m.matB.Shade(ctx, s, r, h)
+	ctx.SetDirectWeight(w)
 	return ca.Mul(m.a).MAdd(m.b, cb)
 }
+
+// Describe implements describe.Describer.
+func (m *blend) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{
+		"type":      "blend",
+		"weights":   []float64{m.a, m.b},
+		"materials": []interface{}{e.Describe(m.matA), e.Describe(m.matB)},
+	}
+}
@@ -1,6 +1,7 @@
 package materials
 
 import (
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/texture"
 	. "github.com/barnex/bruteray/tracer/types"
 )
@@ -15,6 +16,16 @@ type flat struct {
 // dimly luminous surfaces like computer screens, the sky, etc.
 func Flat(t texture.Texture) Material { return &flat{t} }
 
+// Albedo implements tracer.AlbedoMaterial.
+func (m *flat) Albedo(h HitCoords) Color {
+	return m.texture.At(h.Local)
+}
+
 func (m *flat) Shade(_ *Ctx, _ *Scene, r *Ray, h HitCoords) Color {
 	return m.texture.At(h.Local)
 }
+
+// Describe implements describe.Describer.
+func (m *flat) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "flat", "color": e.Describe(m.texture)}
+}
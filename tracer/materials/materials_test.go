@@ -96,6 +96,96 @@ func TestTransparent(t *testing.T) {
 	)
 }
 
+func TestMicrofacet(t *testing.T) {
+	test.QuadViewN(t,
+		NewScene(
+			3,
+			[]Light{
+				lights.PointLight(colorf.White.EV(2), Vec{1, 2, 1}),
+			},
+			test.Sheet(test.Checkers4, -0.5),
+			test.Sphere(Microfacet(colorf.Color{1, 0.2, 0.2}, colorf.Gray(0.3), colorf.Black), 1, Vec{-1, 0, 0}),
+			test.Sphere(Microfacet(colorf.Color{1, 0.8, 0.4}, colorf.Gray(0.2), colorf.White), 1, Vec{0, 0, 0}),
+			test.Sphere(Microfacet(colorf.White, colorf.Gray(0.6), colorf.White), 1, Vec{1, 0, 0}),
+		),
+		cameras.Projective(90*Deg).Translate(Vec{0, 0.5, 2}).YawPitchRoll(0, -10*Deg, 0),
+		8,   // isometric fov
+		4,   // nPass
+		0.2, // noisy rough reflections
+	)
+}
+
+// Under uniform illumination, white materials should not reflect more light than they receive
+// (energy conservation), and should not lose more light than expected
+// from neglecting multiple scattering on the microsurface.
+func TestMicrofacet_WhiteFurnace(t *testing.T) {
+	const tol = 0.01 // Monte Carlo noise and slight energy gain of the dielectric diffuse term
+	for _, c := range []struct {
+		rough, metal float64
+		min          float64
+	}{
+		{0, 0, 0.99},
+		{0.5, 0, 0.98},
+		{1, 0, 0.95},
+		{0, 1, 0.99},
+		{0.3, 1, 0.97},
+		{0.5, 1, 0.88},
+		{1, 1, 0.3},
+	} {
+		m := Microfacet(colorf.White, colorf.Gray(c.rough), colorf.Gray(c.metal))
+		got := test.WhiteFurnace(m, 64)
+		for _, x := range []float64{got.R, got.G, got.B} {
+			if x > 1+tol || x < c.min {
+				t.Errorf("roughness %v, metalness %v: got %v, want %v..%v", c.rough, c.metal, x, c.min, 1)
+			}
+		}
+	}
+
+	if got := test.WhiteFurnace(Matte(colorf.White), 64); got != colorf.White {
+		t.Errorf("matte: got %v, want %v", got, colorf.White)
+	}
+}
+
+func TestRoughRefractive(t *testing.T) {
+	test.QuadViewN(t,
+		NewScene(
+			6,
+			[]Light{
+				lights.PointLight(colorf.White.EV(2), Vec{1, 2, 1}),
+			},
+			test.Sheet(test.Checkers4, -0.5),
+			test.Sphere(RoughRefractive(1, 1.5, colorf.Gray(0.1), colorf.White), 1, Vec{-1, 0, 0}),
+			test.Sphere(RoughRefractive(1, 1.5, colorf.Gray(0.4), colorf.White), 1, Vec{0, 0, 0}),
+			test.Sphere(RoughRefractive(1, 1.5, colorf.Gray(0.4), colorf.Color{1, 0.8, 0.4}), 1, Vec{1, 0, 0}),
+		),
+		cameras.Projective(90*Deg).Translate(Vec{0, 0.5, 2}).YawPitchRoll(0, -10*Deg, 0),
+		8,   // isometric fov
+		4,   // nPass
+		0.2, // noisy rough reflections
+	)
+}
+
+// A clear, rough dielectric should not create energy,
+// and only lose energy through masking on the microsurface.
+func TestRoughRefractive_WhiteFurnace(t *testing.T) {
+	const tol = 0.01 // Monte Carlo noise
+	for _, c := range []struct {
+		rough float64
+		min   float64
+	}{
+		{0, 0.99},
+		{0.1, 0.98},
+		{0.3, 0.93},
+		{1, 0.3},
+	} {
+		m := RoughRefractive(1, 1.5, colorf.Gray(c.rough), colorf.White)
+		got := test.WhiteFurnace(m, 256)
+		if x := got.R; x > 1+tol || x < c.min {
+			t.Errorf("roughness %v: got %v, want %v..%v", c.rough, x, c.min, 1)
+		}
+	}
+}
+
 // TODO: Test texturing
 //func TestFlat(t *testing.T) {
 //	test.QuadView(t,
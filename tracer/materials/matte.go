@@ -3,6 +3,7 @@ package materials
 import (
 	"math/rand"
 
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/texture"
 	"github.com/barnex/bruteray/tracer/sequence"
 	. "github.com/barnex/bruteray/tracer/types"
@@ -22,11 +23,12 @@ type matte struct {
 //
 // The ray tracing algorithm implemented here is a flavour of bidirectional path tracing:
 // A ray is shot forward from the camera onto the scene.
-// When it hits a matte surface, we gather the light from all light sources
-// to give the direct illumination. To that we add the (appropriately weighted)
+// When it hits a matte surface, we gather the light from the light sources
+// to give the direct illumination (see tracer.Scene.DirectLight: all light sources by default,
+// or one chosen by importance, see tracer.LightSelection). To that we add the (appropriately weighted)
 // contribution of one random ray. This gives the indirect illumination.
 // The random ray's color is determined recurively, thus again
-// taking into account all light sources, etc. (up to a maximum depth).
+// taking into account the light sources, etc. (up to a maximum depth).
 //
 // E.g. in the sketch below, Ray a goes from the camera to a matte surface.
 // At the intersection point we take into account the intensity of the light
@@ -46,54 +48,49 @@ type matte struct {
 //
 // This separation of direct and indirect illumination causes significantly
 // faster convergence for the common case of relatively small light sources.
+// Large light sources (see tracer.PDFLight) can also be hit by the random ray,
+// both contributions are then combined by multiple importance sampling (see Scene.DirectLight).
 func Matte(t texture.Texture) Material {
 	return &matte{t}
 }
 
+// Albedo implements tracer.AlbedoMaterial.
+func (m *matte) Albedo(h HitCoords) Color {
+	return m.texture.At(h.Local)
+}
+
 // Eval implements tracer.Material.
 func (m *matte) Shade(ctx *Ctx, s *Scene, r *Ray, h HitCoords) Color {
-	var acc Color
-
 	normal := flipTowards(h.Normal, r.Dir)
-	sec := ctx.Ray()
 	p := r.At(h.T).MAdd(Tiny, normal)
-	sec.Start = p
-
-	for _, l := range s.Lights() {
-
-		lpos, intens := l.Sample(ctx, p)
-		if intens == (Color{}) {
-			continue
-		}
-
-		lDelta := lpos.Sub(p)
-		lDir := lDelta.Normalized()
-		cosTheta := lDir.Dot(normal)
-		if cosTheta <= 0 {
-			continue
-		}
-
-		lDist := lDelta.Len()
-		sec.Dir = lDir
-
-		//if s.IsOccluded(sec, lDist) {
-		//	continue
-		//}
+	refl := m.texture.At(h.Local)
 
-		intens = s.Occlude(sec, lDist, intens)
-
-		acc = acc.Add(intens.Mul(cosTheta))
-	}
+	acc := s.DirectLight(ctx, p, &matteBSDF{normal, refl})
 
+	sec := ctx.Ray()
 	sec.Start = p.MAdd(Tiny, normal)
 	//sec.Dir = randVecCos(ctx.Rng, normal)
 	u, v := ctx.Generate2()
 	sec.Dir = sequence.CosineSphere(u, v, normal)
-	acc = acc.Add(s.LightFieldIndirect(ctx, sec)) // does not include explicit lights
+	pdf := sec.Dir.Dot(normal) / Pi
+	acc = acc.Add(s.LightFieldMIS(ctx, sec, pdf, refl)) // cosine-weighted sampling cancels the BSDF
 	ctx.PutRay(sec)
 
-	refl := m.texture.At(h.Local)
-	return acc.Mul3(refl)
+	return acc
+}
+
+// matteBSDF implements tracer.BSDF for Lambertian reflection.
+type matteBSDF struct {
+	normal Vec
+	refl   Color
+}
+
+func (b *matteBSDF) Eval(dir Vec) (Color, float64) {
+	cosTheta := dir.Dot(b.normal)
+	if cosTheta <= 0 {
+		return Color{}, 0
+	}
+	return b.refl.Mul(cosTheta), cosTheta / Pi
 }
 
 // flipTowards flips normal vector n to point towards (i.e., against) direction d,
@@ -133,3 +130,8 @@ func randVecCos(rng *rand.Rand, dir Vec) Vec {
 	}
 	return v
 }
+
+// Describe implements describe.Describer.
+func (m *matte) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "matte", "color": e.Describe(m.texture)}
+}
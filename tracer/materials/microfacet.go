@@ -0,0 +1,255 @@
+package materials
+
+import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer/sequence"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// Microfacet constructs a physically based material that models the surface
+// as a collection of tiny, perfectly smooth mirrors ("microfacets"),
+// as used in the common "metallic-roughness" workflow. E.g.:
+// 	Microfacet(colorf.Red, colorf.Gray(0.3), colorf.Black) // red plastic
+// 	Microfacet(gold, colorf.Gray(0.2), colorf.White)       // polished gold
+//
+// The color texture determines the base color: the diffuse reflectivity
+// of dielectrics, or the specular reflectivity (at normal incidence) of metals.
+//
+// The roughness texture determines how much the microfacet orientations vary,
+// from 0 (perfect mirror) to 1 (very rough). Following Burley,
+// the GGX width parameter α is roughness squared, which makes roughness
+// perceptually more linear.
+//
+// The metalness texture blends between a dielectric (0), which has a diffuse
+// base layer and a weak specular reflection (4% at normal incidence),
+// and a metal (1), which only reflects specularly, with the base color.
+// Only the gray value (average over color channels) of roughness and metalness is used.
+//
+// The microfacet orientations follow the GGX (Trowbridge-Reitz) distribution,
+// with Smith's masking-shadowing function and Schlick's approximation of the Fresnel factor.
+// See Walter et al., "Microfacet Models for Refraction through Rough Surfaces" (2007),
+// https://www.cs.cornell.edu/~srm/publications/EGSR07-btdf.pdf.
+//
+// Like Matte, direct illumination is gathered from the light sources
+// selected by tracer.Scene.DirectLight (see tracer.LightSelection), and indirect illumination is added by one random ray. This ray is importance-sampled
+// from either the specular or diffuse lobe, and combined with the direct illumination
+// by multiple importance sampling (see tracer.Scene.DirectLight).
+//
+// Note that this model only accounts for a single reflection on the microsurface,
+// so rough materials lose some energy, especially under grazing incidence.
+func Microfacet(color, roughness, metalness texture.Texture) Material {
+	return &microfacet{color, roughness, metalness}
+}
+
+type microfacet struct {
+	color     texture.Texture
+	roughness texture.Texture
+	metalness texture.Texture
+}
+
+// Albedo implements tracer.AlbedoMaterial.
+func (m *microfacet) Albedo(h HitCoords) Color {
+	return m.color.At(h.Local)
+}
+
+// Shade implements tracer.Material.
+func (m *microfacet) Shade(ctx *Ctx, s *Scene, r *Ray, h HitCoords) Color {
+	normal := flipTowards(h.Normal, r.Dir)
+	b := m.brdf(h, normal, r.Dir.Mul(-1))
+	p := r.At(h.T).MAdd(Tiny, normal)
+
+	acc := s.DirectLight(ctx, p, &b)
+
+	sec := ctx.Ray()
+	sec.Start = p.MAdd(Tiny, normal)
+	u, v := ctx.Generate2()
+	if dir, weight, ok := b.sample(u, v); ok {
+		sec.Dir = dir
+		acc = acc.Add(s.LightFieldMIS(ctx, sec, b.pdf(dir), weight))
+	}
+	ctx.PutRay(sec)
+
+	return acc
+}
+
+// minAlpha is the smallest GGX width used.
+// Avoids division by zero for perfectly smooth surfaces,
+// which are then rendered as nearly perfect mirrors.
+const minAlpha = 1e-3
+
+// ggx holds the microfacet parameters evaluated at one point of the surface,
+// for given normal vector and direction towards the viewer.
+type ggx struct {
+	base  Color   // base color
+	alpha float64 // GGX width parameter
+	metal float64 // metalness
+	f0    Color   // specular reflectivity at normal incidence
+	n, v  Vec     // unit normal, unit vector towards the viewer
+}
+
+func (m *microfacet) brdf(h HitCoords, normal, view Vec) ggx {
+	base := m.color.At(h.Local)
+	rough := clamp01(m.roughness.At(h.Local).Gray())
+	metal := clamp01(m.metalness.At(h.Local).Gray())
+	const dielectricF0 = 0.04 // typical for an index of refraction of 1.5
+	return ggx{
+		base:  base,
+		alpha: math.Max(rough*rough, minAlpha),
+		metal: metal,
+		f0:    Color{dielectricF0, dielectricF0, dielectricF0}.Mul(1-metal).MAdd(metal, base),
+		n:     normal,
+		v:     view,
+	}
+}
+
+// Eval implements tracer.BSDF.
+func (b *ggx) Eval(l Vec) (Color, float64) {
+	return b.eval(l), b.pdf(l)
+}
+
+// eval returns the BRDF for light coming from direction l towards the viewer,
+// times the cosine of the angle of incidence.
+// Like Matte, this is normalized so that a white Lambertian reflector yields cosθ
+// (i.e., it is π times the usual BRDF).
+func (b *ggx) eval(l Vec) Color {
+	cosL := b.n.Dot(l)
+	if cosL <= 0 {
+		return Color{}
+	}
+	cosV := math.Max(b.n.Dot(b.v), minCos)
+	half := b.v.Add(l).Normalized()
+	F := b.fresnel(b.v.Dot(half))
+	spec := F.Mul(Pi * b.d(b.n.Dot(half)) * b.g1(cosV) * b.g1(cosL) / (4 * cosV))
+	return spec.Add(b.diffuse(F).Mul(cosL))
+}
+
+// specularProbability returns the probability that sample chooses the specular lobe.
+// ok is false if no light can be reflected at all.
+func (b *ggx) specularProbability() (p float64, ok bool) {
+	cosV := math.Max(b.n.Dot(b.v), minCos)
+	specW := b.fresnel(cosV).Gray()
+	diffW := (1 - specW) * (1 - b.metal) * b.base.Gray()
+	if specW+diffW <= 0 {
+		return 0, false
+	}
+	return specW / (specW + diffW), true
+}
+
+// sample importance-samples a direction of incidence.
+// It returns the direction and its weight: BRDF times cosθ divided by the probability density
+// (with the same normalization as eval). ok is false if no light can be reflected.
+//
+// With a probability proportional to the estimated specular reflectivity, the direction is
+// sampled from the GGX distribution of normals. Otherwise, it is sampled from a cosine distribution
+// for the diffuse component.
+func (b *ggx) sample(u, v float64) (dir Vec, weight Color, ok bool) {
+	pSpec, ok := b.specularProbability()
+	if !ok {
+		return Vec{}, Color{}, false
+	}
+	n, view := b.n, b.v
+	cosV := math.Max(n.Dot(view), minCos)
+
+	if u < pSpec {
+		// Specular: reflect around a microfacet normal distributed as D(h)cosθh,
+		// the probability density of direction l is then D(h)cosθh / (4 v·h).
+		half := sampleGGX(u/pSpec, v, b.alpha, n)
+		dir = reflect(view.Mul(-1), half)
+		cosL := n.Dot(dir)
+		vh := view.Dot(half)
+		if cosL <= 0 || vh <= 0 {
+			return Vec{}, Color{}, false
+		}
+		w := b.g1(cosV) * b.g1(cosL) * vh / (cosV * n.Dot(half) * pSpec)
+		return dir, b.fresnel(vh).Mul(w), true
+	}
+
+	// Diffuse: cosine-weighted, the probability density cancels the cosθ/π factor.
+	dir = sequence.CosineSphere((u-pSpec)/(1-pSpec), v, n)
+	half := view.Add(dir).Normalized()
+	F := b.fresnel(view.Dot(half))
+	return dir, b.diffuse(F).Mul(1 / (1 - pSpec)), true
+}
+
+// pdf returns the probability density (per solid angle) with which sample returns direction l.
+// Note that sample's weights are those of the chosen lobe, rather than the total BRDF divided by pdf,
+// but both are unbiased.
+func (b *ggx) pdf(l Vec) float64 {
+	pSpec, ok := b.specularProbability()
+	cosL := b.n.Dot(l)
+	if !ok || cosL <= 0 {
+		return 0
+	}
+	half := b.v.Add(l).Normalized()
+	vh := b.v.Dot(half)
+	spec := 0.0
+	if vh > 0 {
+		spec = b.d(b.n.Dot(half)) * b.n.Dot(half) / (4 * vh)
+	}
+	return pSpec*spec + (1-pSpec)*cosL/Pi
+}
+
+// diffuse returns the diffuse reflectivity, given the Fresnel factor F:
+// light that is not reflected specularly enters a dielectric and is scattered diffusely.
+// Metals have no diffuse reflection.
+func (b *ggx) diffuse(F Color) Color {
+	return Color{1 - F.R, 1 - F.G, 1 - F.B}.Mul3(b.base).Mul(1 - b.metal)
+}
+
+// d is the GGX (Trowbridge-Reitz) distribution of microfacet normals,
+// as a function of the cosine of their angle with the surface normal.
+func (b *ggx) d(cosH float64) float64 {
+	if cosH <= 0 {
+		return 0
+	}
+	a2 := b.alpha * b.alpha
+	t := cosH*cosH*(a2-1) + 1
+	return a2 / (Pi * t * t)
+}
+
+// g1 is Smith's masking function for GGX,
+// as a function of the cosine of the angle between the direction and the surface normal.
+func (b *ggx) g1(cos float64) float64 {
+	a2 := b.alpha * b.alpha
+	return 2 * cos / (cos + math.Sqrt(a2+(1-a2)*cos*cos))
+}
+
+// fresnel returns Schlick's approximation of the Fresnel reflectivity,
+// as a function of the cosine of the angle of incidence on the microfacet.
+func (b *ggx) fresnel(cos float64) Color {
+	w := math.Pow(1-clamp01(cos), 5)
+	return b.f0.Mul(1 - w).Add(Color{w, w, w})
+}
+
+// sampleGGX maps u, v (uniformly distributed between 0 and 1)
+// to a unit vector around normal n, with probability density D(h)cosθh,
+// D being the GGX distribution with width alpha.
+func sampleGGX(u, v, alpha float64, n Vec) Vec {
+	tan2θ := alpha * alpha * u / (1 - u)
+	cosθ := 1 / math.Sqrt(1+tan2θ)
+	sinθ := math.Sqrt(math.Max(0, 1-cosθ*cosθ))
+	φ := 2 * Pi * v
+	ex, ey := geom.MakeBasis(n)
+	return n.Mul(cosθ).MAdd(sinθ*math.Cos(φ), ex).MAdd(sinθ*math.Sin(φ), ey)
+}
+
+// minCos avoids division by zero for surfaces seen under perfectly grazing incidence.
+const minCos = 1e-6
+
+func clamp01(x float64) float64 {
+	return math.Max(0, math.Min(1, x))
+}
+
+// Describe implements describe.Describer.
+func (m *microfacet) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{
+		"type":      "microfacet",
+		"color":     e.Describe(m.color),
+		"roughness": e.Describe(m.roughness),
+		"metalness": e.Describe(m.metalness),
+	}
+}
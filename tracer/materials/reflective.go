@@ -3,6 +3,7 @@ package materials
 import (
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	. "github.com/barnex/bruteray/imagef/colorf"
 	. "github.com/barnex/bruteray/tracer"
@@ -21,6 +22,11 @@ type reflective struct {
 	c Color
 }
 
+// Albedo implements tracer.AlbedoMaterial.
+func (m *reflective) Albedo(h HitCoords) Color {
+	return m.c
+}
+
 func (m *reflective) Shade(ctx *Ctx, s *Scene, r *Ray, h HitCoords) Color {
 	pos := r.At(h.T - Tiny)
 	r2 := ctx.Ray()
@@ -47,6 +53,11 @@ type reflectFresnel struct {
 	trans Material
 }
 
+// Albedo implements tracer.AlbedoMaterial.
+func (s *reflectFresnel) Albedo(h HitCoords) Color {
+	return AlbedoOf(s.trans, h)
+}
+
 func (s *reflectFresnel) Shade(ctx *Ctx, e *Scene, r *Ray, h HitCoords) Color {
 	pos, norm := r.At(h.T-Tiny), h.Normal
 	r2 := ctx.Ray()
@@ -54,7 +65,10 @@ func (s *reflectFresnel) Shade(ctx *Ctx, e *Scene, r *Ray, h HitCoords) Color {
 	r2.Dir = reflect(r.Dir, norm)
 	R := fresnelReflection(1, s.n, math.Abs(norm.Dot(r.Dir)))
 	T := 1 - R
+	w := ctx.DirectWeight()
+	ctx.SetDirectWeight(w * T)
 	trans := s.trans.Shade(ctx, e, r, h)
+	ctx.SetDirectWeight(w)
 	refl := e.LightField(ctx, r2)
 	ctx.PutRay(r2)
 	return refl.Mul(R).MAdd(T, trans)
@@ -81,3 +95,13 @@ func fresnelReflection(n1, n2, cosθi float64) float64 {
 func reflect(v, n geom.Vec) geom.Vec {
 	return v.MAdd(-2*v.Dot(n), n)
 }
+
+// Describe implements describe.Describer.
+func (m *reflective) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "reflective", "color": describe.Color(m.c)}
+}
+
+// Describe implements describe.Describer.
+func (s *reflectFresnel) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "reflectFresnel", "ior": s.n, "transmitted": e.Describe(s.trans)}
+}
@@ -3,6 +3,7 @@ package materials
 import (
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/imagef/colorf"
 	. "github.com/barnex/bruteray/tracer"
 	. "github.com/barnex/bruteray/util"
@@ -77,3 +78,8 @@ func (s *refractive) Shade(ctx *Ctx, e *Scene, r *Ray, h HitCoords) Color {
 
 	return cR.Add(cT)
 }
+
+// Describe implements describe.Describer.
+func (s *refractive) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "refractive", "ior": s.n2, "iorOutside": s.n1}
+}
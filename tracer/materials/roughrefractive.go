@@ -0,0 +1,116 @@
+package materials
+
+import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/texture"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// RoughRefractive is like Refractive2, but with a rough interface:
+// reflection and transmission are spread out, rendering a frosted appearance.
+// E.g.:
+// 	RoughRefractive(1, 1.5, colorf.Gray(0.3), colorf.White)               // frosted glass
+// 	RoughRefractive(1, 1.31, colorf.Gray(0.1), colorf.White)              // ice
+// 	RoughRefractive(1, 1.49, colorf.Gray(0.5), colorf.Color{0.8, 0.9, 1}) // sand-blasted, blue acrylic
+//
+// Like Refractive2, n1 and n2 are the indices of refraction outside and inside.
+// Roughness (0..1) is interpreted like in Microfacet: the interface is a
+// collection of microfacets with GGX distributed normals, α = roughness².
+// Only the gray value (average over color channels) of the roughness texture is used.
+//
+// Transmitted light is multiplied by color each time it crosses the interface,
+// like Transparent. This gives a colored appearance to the material.
+//
+// For each sample, one microfacet normal is importance-sampled.
+// Reflection or transmission on that microfacet is then chosen randomly,
+// with probabilities given by the Fresnel equations (including total internal reflection).
+// See Walter et al., "Microfacet Models for Refraction through Rough Surfaces" (2007),
+// https://www.cs.cornell.edu/~srm/publications/EGSR07-btdf.pdf.
+func RoughRefractive(n1, n2 float64, roughness, color texture.Texture) Material {
+	return &roughRefractive{n1, n2, roughness, color}
+}
+
+type roughRefractive struct {
+	n1, n2    float64 // index of refraction outside and inside
+	roughness texture.Texture
+	color     texture.Texture
+}
+
+// Albedo implements tracer.AlbedoMaterial.
+func (m *roughRefractive) Albedo(h HitCoords) Color {
+	return m.color.At(h.Local)
+}
+
+// Shade implements tracer.Material.
+func (m *roughRefractive) Shade(ctx *Ctx, e *Scene, r *Ray, h HitCoords) Color {
+	n := h.Normal.Normalized()
+	i := r.Dir.Normalized() // incident direction
+
+	// if we are exiting rather than entering the refractive material,
+	// swap refractive indices and flip normal
+	n1, n2 := m.n1, m.n2
+	if i.Dot(n) > 0 {
+		n = n.Mul(-1)
+		n1, n2 = n2, n1
+	}
+	n12 := n1 / n2
+
+	rough := clamp01(m.roughness.At(h.Local).Gray())
+	b := ggx{alpha: math.Max(rough*rough, minAlpha)}
+
+	// sample microfacet normal with probability density D(m)cosθm.
+	u, v := ctx.Generate2()
+	mf := sampleGGX(u, v, b.alpha, n)
+	cosθi := -i.Dot(mf) // cos of incident angle on the microfacet.
+	cosN := -i.Dot(n)   // cos of incident angle on the macro surface.
+	if cosθi <= 0 || cosN <= 0 {
+		return Color{} // microfacet facing away from the ray
+	}
+
+	// Fresnel equations for reflected intensity
+	R := 1.0
+	sin2θt := n12 * n12 * (1 - cosθi*cosθi) // sin² of transmission angle, using Snell's law.
+	if sin2θt < 1 {
+		R = fresnelReflection(n1, n2, cosθi)
+	}
+
+	// The probability of choosing reflection or transmission cancels the Fresnel factor,
+	// leaving the sampling weight |i·m| G / (|i·n| |m·n|) (Walter et al., eq. 41).
+	weight := cosθi * b.g1(cosN) / (cosN * mf.Dot(n))
+
+	r2 := ctx.Ray()
+	defer ctx.PutRay(r2)
+
+	if ctx.Generate1() < R {
+		// reflected ray
+		r2.Dir = reflect(i, mf)
+		cosO := r2.Dir.Dot(n)
+		if cosO <= 0 {
+			return Color{} // reflected into the surface
+		}
+		r2.Start = r.At(h.T - Tiny) // same side of surface
+		return e.LightField(ctx, r2).Mul(weight * b.g1(cosO))
+	}
+
+	// transmitted ray
+	r2.Dir = i.Mul(n12).MAdd(n12*cosθi-math.Sqrt(1-sin2θt), mf)
+	cosO := -r2.Dir.Dot(n)
+	if cosO <= 0 {
+		return Color{} // transmitted back out of the surface
+	}
+	r2.Start = r.At(h.T + Tiny) // start at other side of surface
+	return e.LightField(ctx, r2).Mul(weight * b.g1(cosO)).Mul3(m.color.At(h.Local))
+}
+
+// Describe implements describe.Describer.
+func (m *roughRefractive) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{
+		"type":       "roughRefractive",
+		"ior":        m.n2,
+		"iorOutside": m.n1,
+		"roughness":  e.Describe(m.roughness),
+		"color":      e.Describe(m.color),
+	}
+}
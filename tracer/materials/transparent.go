@@ -1,6 +1,7 @@
 package materials
 
 import (
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/imagef/colorf"
 	"github.com/barnex/bruteray/texture"
 	. "github.com/barnex/bruteray/tracer"
@@ -29,6 +30,16 @@ func (m *transparent) Shade(ctx *Ctx, s *Scene, r *Ray, h HitCoords) Color {
 	//return s.Eval(ctx, r2).Mul3(m.t.At(h.Local))
 }
 
+// Albedo implements tracer.AlbedoMaterial.
+func (m *transparent) Albedo(h HitCoords) Color {
+	return m.t.At(h.Local)
+}
+
 func (m *transparent) Filter(r *Ray, h HitRecord, background Color) Color {
 	return background.Mul3(m.t.At(h.Local))
 }
+
+// Describe implements describe.Describer.
+func (m *transparent) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "transparent", "color": e.Describe(m.t), "consumeRecursion": m.useRec}
+}
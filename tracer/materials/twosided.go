@@ -1,6 +1,9 @@
 package materials
 
-import . "github.com/barnex/bruteray/tracer/types"
+import (
+	"github.com/barnex/bruteray/describe"
+	. "github.com/barnex/bruteray/tracer/types"
+)
 
 // A TwoSided material consists of a front-facing material
 // (seen when looking towards the surface normal) and a
@@ -21,3 +24,8 @@ func (m *twoSided) Shade(ctx *Ctx, s *Scene, r *Ray, h HitCoords) Color {
 		return m.back.Shade(ctx, s, r, h)
 	}
 }
+
+// Describe implements describe.Describer.
+func (m *twoSided) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "twoSided", "front": e.Describe(m.front), "back": e.Describe(m.back)}
+}
@@ -3,6 +3,7 @@ package media
 import (
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/tracer/types"
 	"github.com/barnex/bruteray/util"
 )
@@ -21,6 +22,11 @@ type expFog struct {
 	height  float64
 }
 
+// Describe implements describe.Describer.
+func (m *expFog) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "expFog", "density": m.density, "ambient": describe.Color(m.ambient), "height": m.height}
+}
+
 // TODO: not correct when camera is in fog
 func (m *expFog) Filter(ctx *Ctx, s *Scene, r *Ray, tMax float64, orig Color) Color {
 	// We only apply fog to the primary ray (coming directly from the camera).
@@ -3,21 +3,31 @@ package media
 import (
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
+// Fog returns a medium that fills the half-space below height,
+// and scatters the light sources towards the camera.
+// Light sources are sampled like for surfaces, see Scene.DirectLight and Scene.SetLightSelection.
+//
+// Deprecated: numLight is ignored. It used to limit the number of light sources that were sampled,
+// use Scene.SetLightSelection instead.
 func Fog(density float64, height float64, numLight int) Medium {
 	return &fog{
-		density:  density,
-		height:   height,
-		numLight: numLight,
+		density: density,
+		height:  height,
 	}
 }
 
 type fog struct {
-	density  float64
-	height   float64
-	numLight int
+	density float64
+	height  float64
+}
+
+// Describe implements describe.Describer.
+func (m *fog) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "fog", "density": m.density, "height": m.height}
 }
 
 // TODO: not correct when camera is in fog?
@@ -32,33 +42,25 @@ func (m *fog) Filter(ctx *Ctx, s *Scene, r *Ray, tMax float64, orig Color) Color
 	u, _ := ctx.Generate2()
 	tSampl, weight := randExpInterval(u, m.density, len)
 	t := start + tSampl
-	var acc Color
 	p := r.At(t - Tiny)
-	sec := ctx.Ray()
-	//defer ctx.PutRay(sec)
 
-	for i, l := range s.Lights() {
-		if i == m.numLight {
-			break
-		}
-		lpos, intens := l.Sample(ctx, p)
-		if intens == (Color{}) {
-			continue
-		}
+	// light from behind the fog is attenuated, including the direct light recorded so far.
+	trans := math.Exp(-len * m.density)
+	ctx.ScaleDirect(trans)
 
-		lDelta := lpos.Sub(p)
-		lDir := lDelta.Normalized()
-		lDist := lDelta.Len()
-		sec.Start = p
-		sec.Dir = lDir
+	acc := s.DirectLight(ctx, p, uniformPhase(weight))
+	return orig.Mul(trans).Add(acc)
+}
 
-		intens = s.Occlude(sec, lDist, intens)
-		acc = acc.MAdd(weight, intens)
-	}
+// uniformPhase is a BSDF (see Scene.DirectLight) that scatters
+// a fixed fraction of the incident light, regardless of direction.
+type uniformPhase float64
 
-	trans := math.Exp(-len * m.density)
-	ctx.PutRay(sec)
-	return orig.Mul(trans).Add(acc)
+// Eval implements tracer.BSDF.
+// The pdf is zero: the medium does not sample rays towards the light sources
+// (i.e., does not use LightFieldMIS), so they must account for all direct light.
+func (w uniformPhase) Eval(Vec) (Color, float64) {
+	return Color{float64(w), float64(w), float64(w)}, 0
 }
 
 // randExpInterval draws a random number t from the probability distribution
@@ -0,0 +1,109 @@
+package media
+
+import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/tracer/objects"
+	"github.com/barnex/bruteray/tracer/sequence"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// Interior returns a Medium that fills the inside of a solid shape.
+// Light traveling through the inside is attenuated according to the Beer-Lambert law,
+// i.e. exponentially with the distance traveled. E.g.:
+// 	glass := objects.Sphere(materials.Refractive(1.5), 1, O)
+// 	tint := media.Interior(glass, media.Absorption(Color{0.5, 0.8, 0.6}, 1), 0)
+// 	scene := NewSceneWithMedia(8, []Medium{tint}, lights, glass)
+// renders a sphere of green glass that transmits only half of the red light
+// (in a straight line, through the center).
+//
+// The absorption coefficient determines the fraction of light absorbed per unit length,
+// for each color channel. See Absorption.
+//
+// The scattering coefficient determines the fraction of light scattered per unit length,
+// isotropically (in all directions equally). This gives translucent materials like jade, milk or wax.
+// Scattered light is path traced: it is not explicitly sampled from light sources
+// (which are typically hidden behind the shape's surface). Hence scattering media
+// converge well under extended illumination (like a sky), but poorly for small light sources.
+//
+// The shape determines where the medium is via its Inside method,
+// so it must be a solid (not hollow) object. It is typically also added to the Scene,
+// with a material that lets light enter, like Refractive or Transparent.
+// The shape's material only determines what happens at the surface.
+func Interior(shape objects.Interface, absorption Color, scattering float64) Medium {
+	return &interior{
+		shape:      shape,
+		absorption: absorption,
+		scattering: scattering,
+	}
+}
+
+// Absorption returns the absorption coefficient for which light
+// is attenuated to color transmitted after traveling the given distance.
+// E.g.:
+// 	Absorption(Color{0.5, 0.8, 0.6}, 1)
+// transmits 50% red, 80% green and 60% blue light after traveling 1 unit of length.
+func Absorption(transmitted Color, distance float64) Color {
+	return Color{
+		-math.Log(transmitted.R) / distance,
+		-math.Log(transmitted.G) / distance,
+		-math.Log(transmitted.B) / distance,
+	}
+}
+
+type interior struct {
+	shape      objects.Interface
+	absorption Color
+	scattering float64
+}
+
+// Describe implements describe.Describer.
+func (m *interior) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{
+		"type":       "interior",
+		"object":     e.Describe(m.shape),
+		"absorption": describe.Color(m.absorption),
+		"scattering": m.scattering,
+	}
+}
+
+func (m *interior) Filter(ctx *Ctx, s *Scene, r *Ray, tMax float64, orig Color) Color {
+	if !m.shape.Inside(r.Start) {
+		return orig
+	}
+
+	// The ray leaves the medium either where it hits the shape's surface
+	// or another object, whichever comes first.
+	len := tMax
+	if exit := m.shape.Intersect(r).T; exit > 0 && exit < len {
+		len = exit
+	}
+	if math.IsInf(len, 0) || math.IsNaN(len) {
+		return orig // not really inside, e.g. due to round-off
+	}
+
+	c := orig.Mul3(m.transmission(len)).Mul(math.Exp(-m.scattering * len))
+
+	if m.scattering > 0 {
+		// Add the light scattered towards the ray from one random point along the ray.
+		t, weight := randExpInterval(ctx.Generate1(), m.scattering, len)
+		sec := ctx.Ray()
+		sec.Start = r.At(t)
+		sec.Dir = sequence.UniformSphere(ctx.Generate1(), ctx.Generate1())
+		scattered := s.LightField(ctx, sec)
+		ctx.PutRay(sec)
+		c = c.Add(scattered.Mul3(m.transmission(t)).Mul(weight))
+	}
+	return c
+}
+
+// transmission returns the fraction of light that is not absorbed
+// after traveling distance len.
+func (m *interior) transmission(len float64) Color {
+	return Color{
+		math.Exp(-m.absorption.R * len),
+		math.Exp(-m.absorption.G * len),
+		math.Exp(-m.absorption.B * len),
+	}
+}
@@ -2,14 +2,19 @@ package media
 
 import (
 	"math"
+	"math/rand"
 	"testing"
 
 	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer"
 	"github.com/barnex/bruteray/tracer/cameras"
 	"github.com/barnex/bruteray/tracer/lights"
 	"github.com/barnex/bruteray/tracer/materials"
+	"github.com/barnex/bruteray/tracer/objects"
 	. "github.com/barnex/bruteray/tracer/test"
 	. "github.com/barnex/bruteray/tracer/types"
+	"github.com/barnex/bruteray/util"
 )
 
 // Infinite exponential fog
@@ -161,3 +166,170 @@ func TestFog_Height2(t *testing.T) {
 		0.5,  // tolerance (noisy)
 	)
 }
+
+// A ray passing straight through the center of an absorbing sphere
+// should be attenuated according to the Beer-Lambert law.
+func TestInterior_Absorption(t *testing.T) {
+	shape := objects.Sphere(materials.Transparent(colorf.White, true), 2, Vec{0, 0, 0})
+	scene := NewSceneWithMedia(
+		4,
+		[]Medium{
+			Interior(shape, Color{0.5, 1, 2}, 0),
+		},
+		[]Light{},
+		shape,
+		Sphere(Flat(colorf.White), 100, Vec{0, 0, 0}),
+	)
+	s := tracer.NewSampler(scene.ImageFunc(cameras.Projective(1*Deg).Translate(Vec{0, 0, 3})), 1, 1, false)
+	s.Sample(1)
+
+	got := s.Image()[0][0]
+	want := Color{math.Exp(-0.5 * 2), math.Exp(-1 * 2), math.Exp(-2 * 2)}
+	for _, c := range [][2]float64{{got.R, want.R}, {got.G, want.G}, {got.B, want.B}} {
+		if math.Abs(c[0]-c[1]) > 1e-6 {
+			t.Errorf("got %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestAbsorption(t *testing.T) {
+	a := Absorption(Color{0.5, 0.8, 1}, 2)
+	if got := math.Exp(-2 * a.R); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("got %v, want 0.5", got)
+	}
+	if a.B != 0 {
+		t.Errorf("got %v, want 0", a.B)
+	}
+}
+
+// Tinted glass (left), and a translucent, jade-like material (right).
+func TestInterior(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Slow")
+	}
+	glass := objects.Sphere(materials.Refractive(1.5), 1, Vec{-0.6, 0.5, 0})
+	jade := objects.Sphere(materials.Refractive(1.6), 1, Vec{0.6, 0.5, 0})
+	NPassSize(t,
+		NewSceneWithMedia(
+			8,
+			[]Medium{
+				Interior(glass, Absorption(Color{0.3, 0.7, 0.9}, 1), 0),
+				Interior(jade, Absorption(Color{0.5, 0.9, 0.6}, 1), 10),
+			},
+			[]Light{},
+			glass,
+			jade,
+			Sheet(Checkers4, 0),
+			Sphere(Flat(colorf.White), 100, Vec{0, 0, 0}), // sky
+		),
+		cameras.Projective(60*Deg).Translate(Vec{0, 1, 2.5}).YawPitchRoll(0, -15*Deg, 0),
+		16,  // numPass
+		150, // width
+		100, // height
+		0.5, // tolerance (noisy)
+	)
+}
+
+func TestVolume_Transmittance(t *testing.T) {
+	shape := objects.Sphere(nil, 1, Vec{0, 0, 0})
+	m := Volume(shape, texture.ConstScalar3D(2), 4, colorf.White, 0).(OccludingMedium)
+	ctx := tracer.NewCtx(1)
+	for _, c := range []struct {
+		start Vec
+		len   float64
+		want  float64
+	}{
+		{Vec{0, 0, -3}, 10, math.Exp(-2)},      // through the sphere
+		{Vec{0, 0, -3}, 3, math.Exp(-2 * 0.5)}, // stop at the center
+		{Vec{0, 0, 0}, 10, math.Exp(-2 * 0.5)}, // start at the center
+		{Vec{0, 0, -3}, 2, 1},                  // stop before the sphere
+		{Vec{0, 0.6, -3}, 10, 1},               // miss the sphere
+	} {
+		const N = 10000
+		r := &Ray{Start: c.start, Dir: Vec{0, 0, 1}}
+		avg := 0.0
+		for i := 0; i < N; i++ {
+			ctx.Init(0, i)
+			avg += m.Transmittance(ctx, r, c.len)
+		}
+		avg /= N
+		if math.Abs(avg-c.want) > 0.01 {
+			t.Errorf("start %v, len %v: got %v, want %v", c.start, c.len, avg, c.want)
+		}
+	}
+}
+
+func TestHenyeyGreenstein(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	dir := Vec{1, 2, 3}.Normalized()
+	for _, g := range []float64{-0.5, 0, 0.3, 0.9} {
+		// normalization
+		const N = 100000
+		norm := 0.0
+		for i := 0; i < N; i++ {
+			cosθ := 2*(float64(i)+0.5)/N - 1
+			norm += 2 * Pi * henyeyGreenstein(g, cosθ) * 2 / N
+		}
+		if math.Abs(norm-1) > 1e-3 {
+			t.Errorf("g=%v: normalization: got %v, want 1", g, norm)
+		}
+
+		// sampling: the mean cosine equals g
+		mean := 0.0
+		for i := 0; i < N; i++ {
+			mean += sampleHenyeyGreenstein(g, dir, rng.Float64(), rng.Float64()).Dot(dir)
+		}
+		mean /= N
+		if math.Abs(mean-g) > 0.01 {
+			t.Errorf("g=%v: mean cosine: got %v, want %v", g, mean, g)
+		}
+	}
+}
+
+// A non-absorbing volume in a uniformly white environment
+// is exactly as bright as its environment (energy conservation).
+func TestVolume_WhiteFurnace(t *testing.T) {
+	cloud := Volume(objects.Sphere(nil, 1, Vec{0, 0, 0}), texture.ConstScalar3D(2), 2, colorf.White, 0.6)
+	scene := NewSceneWithMedia(
+		16,
+		[]Medium{cloud},
+		[]Light{},
+		Sphere(Flat(colorf.White), 100, Vec{0, 0, 0}),
+	)
+	s := tracer.NewSampler(scene.ImageFunc(cameras.Projective(13*Deg).Translate(Vec{0, 0, 3})), 8, 8, true)
+	s.Sample(16)
+	for _, row := range s.Image() {
+		for _, c := range row {
+			if math.Abs(c.R-1) > 1e-3 {
+				t.Fatalf("got %v, want 1", c.R)
+			}
+		}
+	}
+}
+
+// A cloud with non-uniform density, casting a shadow.
+func TestVolume(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Slow")
+	}
+	density := texture.ScalarFunc3D(func(p Vec) float64 {
+		return 4 * util.Max(0, 1-2*p.Len()) * (1 + 0.5*math.Sin(8*p[X])*math.Sin(8*p[Y]))
+	})
+	cloud := Volume(objects.Sphere(nil, 1, Vec{0, 0, 0}), density, 6, colorf.Gray(0.9), 0.6)
+	NPassSize(t,
+		NewSceneWithMedia(
+			8,
+			[]Medium{cloud},
+			[]Light{
+				lights.PointLight(colorf.White.EV(3), Vec{1, 2, 0}),
+			},
+			Sheet(materials.Matte(colorf.White), -0.7),
+		),
+		cameras.Projective(60*Deg).Translate(Vec{0, 0.5, 2.5}).YawPitchRoll(0, -15*Deg, 0),
+		64,  // numPass
+		150, // width
+		100, // height
+		0.5, // tolerance (noisy)
+	)
+}
@@ -0,0 +1,226 @@
+package media
+
+import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
+	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer/objects"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// Volume returns a heterogeneous, scattering Medium, like clouds or smoke.
+// E.g.:
+// 	cloud := media.Volume(
+// 		objects.Sphere(nil, 2, Vec{0, 3, 0}),              // bounds
+// 		texture.ScalarFunc3D(func(p Vec) float64 {...}),   // density between 0 and 5
+// 		5,                                                 // maximum density
+// 		Color{0.9, 0.9, 0.9},                              // albedo
+// 		0.6,                                               // forward scattering
+// 	)
+// 	scene := NewSceneWithMedia(8, []Medium{cloud}, lights, objs...)
+//
+// The medium fills the inside of shape, which must be a solid (not hollow) object.
+// The shape only serves as a bounding volume, it is not rendered
+// (and need not be added to the Scene, its material is not used).
+//
+// The density (extinction coefficient, i.e. the probability of interaction per unit length)
+// at each point in space (world coordinates) is given by a 3D scalar field,
+// e.g. procedural noise or a voxel grid. It must not exceed maxDensity.
+// Tight bounds (shape and maxDensity) speed up rendering.
+//
+// Each interaction scatters a fraction albedo of the light, and absorbs the remainder.
+// The scattering direction is distributed according to the Henyey-Greenstein phase function
+// with asymmetry parameter g: 0 scatters isotropically (in all directions equally),
+// g > 0 scatters mainly forward (e.g. clouds: 0.6 - 0.9), g < 0 mainly backward.
+//
+// Interactions along a ray are sampled with delta (Woodcock) tracking.
+// At each interaction, light sources are sampled explicitly (which renders god rays)
+// and one random scattered ray accounts for multiple scattering, up to the Scene's recursion depth.
+// The medium also attenuates light reaching other objects (it casts shadows),
+// which is estimated with ratio tracking.
+// See Novák et al., "Monte Carlo Methods for Volumetric Light Transport Simulation" (2018).
+func Volume(shape objects.Interface, density texture.Texturef, maxDensity float64, albedo Color, g float64) Medium {
+	return &volume{
+		shape:      shape,
+		density:    density,
+		maxDensity: maxDensity,
+		albedo:     albedo,
+		g:          g,
+	}
+}
+
+type volume struct {
+	shape      objects.Interface
+	density    texture.Texturef
+	maxDensity float64
+	albedo     Color
+	g          float64
+}
+
+var _ OccludingMedium = (*volume)(nil)
+
+// Describe implements describe.Describer.
+// Only uniform densities (texture.ConstScalar3D) can be described.
+func (m *volume) Describe(e *describe.Encoder) interface{} {
+	density, ok := m.density.(texture.ConstScalar3D)
+	if !ok {
+		e.Errorf("cannot describe volume with density %T", m.density)
+		return nil
+	}
+	return describe.Node{
+		"type":    "volume",
+		"object":  e.Describe(m.shape),
+		"density": float64(density),
+		"albedo":  describe.Color(m.albedo),
+		"g":       m.g,
+	}
+}
+
+// Filter implements tracer.Medium.
+func (m *volume) Filter(ctx *Ctx, s *Scene, r *Ray, tMax float64, orig Color) Color {
+	t, ok := m.collide(ctx, r, tMax)
+	if !ok {
+		return orig // the ray reached the surface behind the medium
+	}
+	// The ray interacted with the medium before reaching the surface behind it,
+	// which is therefore not seen (including the direct light recorded for it).
+	ctx.ScaleDirect(0)
+	return m.scatter(ctx, s, r, r.At(t))
+}
+
+// Transmittance implements tracer.OccludingMedium.
+func (m *volume) Transmittance(ctx *Ctx, r *Ray, len float64) float64 {
+	// ratio tracking
+	trans := 1.0
+	m.segments(ctx, r, len, func(start, end float64) bool {
+		for t := start; ; {
+			t -= math.Log(1-ctx.Generate1()) / m.maxDensity
+			if t >= end {
+				return true
+			}
+			trans *= 1 - m.probability(r.At(t))
+			if trans == 0 {
+				return false
+			}
+		}
+	})
+	return trans
+}
+
+// collide returns the distance along r to the first interaction with the medium,
+// if it happens before tMax. Sampled with delta tracking.
+func (m *volume) collide(ctx *Ctx, r *Ray, tMax float64) (float64, bool) {
+	hit := -1.0
+	m.segments(ctx, r, tMax, func(start, end float64) bool {
+		for t := start; ; {
+			t -= math.Log(1-ctx.Generate1()) / m.maxDensity
+			if t >= end {
+				return true
+			}
+			if ctx.Generate1() < m.probability(r.At(t)) {
+				hit = t
+				return false
+			}
+		}
+	})
+	return hit, hit >= 0
+}
+
+// probability returns the probability that a tentative collision at p,
+// sampled with density maxDensity, is a real collision.
+func (m *volume) probability(p Vec) float64 {
+	return math.Max(0, math.Min(1, m.density.At(p)/m.maxDensity))
+}
+
+// scatter returns the light scattered by the medium at point p towards the origin of r.
+func (m *volume) scatter(ctx *Ctx, s *Scene, r *Ray, p Vec) Color {
+	dir := r.Dir.Normalized()
+
+	// single scattering, shadows include the transmittance of this medium (see Scene.Occlude).
+	acc := s.DirectLight(ctx, p, &hgPhase{g: m.g, dir: dir, albedo: m.albedo})
+
+	// multiple scattering: the phase function is importance sampled, so its weight is 1.
+	sec := ctx.Ray()
+	sec.Start = p
+	sec.Dir = sampleHenyeyGreenstein(m.g, dir, ctx.Generate1(), ctx.Generate1())
+	acc = acc.Add(s.LightFieldIndirect(ctx, sec).Mul3(m.albedo)) // does not include explicit lights
+	ctx.PutRay(sec)
+
+	return acc
+}
+
+// hgPhase is a BSDF (see Scene.DirectLight) for scattering by the Henyey-Greenstein phase function,
+// towards the origin of a ray with direction dir.
+type hgPhase struct {
+	g      float64
+	dir    Vec
+	albedo Color
+}
+
+// Eval implements tracer.BSDF.
+// Like materials.Matte, light intensities are normalized so that a white
+// Lambertian reflector yields intens*cosθ. I.e., the BRDF 1/π corresponds to a factor 1,
+// so the phase function gets a factor π.
+//
+// The pdf is zero: the multiple scattering ray does not use LightFieldMIS,
+// so the light sources must account for all direct light.
+func (b *hgPhase) Eval(lDir Vec) (Color, float64) {
+	return b.albedo.Mul(Pi * henyeyGreenstein(b.g, lDir.Dot(b.dir))), 0
+}
+
+// maxSegments limits the number of times a ray may enter and exit a (non-convex) shape.
+const maxSegments = 64
+
+// segments calls f with the start and end of each interval where ray r is inside the shape,
+// up to distance tMax, in order of increasing distance. Stops early when f returns false.
+func (m *volume) segments(ctx *Ctx, r *Ray, tMax float64, f func(start, end float64) bool) {
+	probe := ctx.Ray()
+	defer ctx.PutRay(probe)
+	probe.Dir = r.Dir
+
+	t := 0.0
+	for i := 0; i < maxSegments && t < tMax; i++ {
+		probe.Start = r.At(t)
+		next := math.Inf(1) // next intersection with the shape's surface
+		if h := m.shape.Intersect(probe).T; h > 0 {
+			next = t + h
+		}
+		end := math.Min(next, tMax)
+		mid := t + Tiny
+		if !math.IsInf(end, 0) {
+			mid = (t + end) / 2
+		}
+		if m.shape.Inside(r.At(mid)) {
+			if !f(t, end) {
+				return
+			}
+		}
+		t = next + Tiny
+	}
+}
+
+// henyeyGreenstein returns the Henyey-Greenstein phase function with asymmetry parameter g,
+// for the cosine of the angle between the directions of propagation before and after scattering.
+// It is normalized to 1 when integrated over all directions.
+func henyeyGreenstein(g, cosθ float64) float64 {
+	d := 1 + g*g - 2*g*cosθ
+	return (1 - g*g) / (4 * Pi * d * math.Sqrt(d))
+}
+
+// sampleHenyeyGreenstein maps u, v (uniformly distributed between 0 and 1) to a unit vector
+// distributed around dir according to the Henyey-Greenstein phase function with asymmetry parameter g.
+func sampleHenyeyGreenstein(g float64, dir Vec, u, v float64) Vec {
+	var cosθ float64
+	if math.Abs(g) < 1e-3 {
+		cosθ = 1 - 2*u
+	} else {
+		sq := (1 - g*g) / (1 + g - 2*g*u)
+		cosθ = (1 + g*g - sq*sq) / (2 * g)
+	}
+	sinθ := math.Sqrt(math.Max(0, 1-cosθ*cosθ))
+	φ := 2 * Pi * v
+	ex, ey := geom.MakeBasis(dir)
+	return dir.Mul(cosθ).MAdd(sinθ*math.Cos(φ), ex).MAdd(sinθ*math.Sin(φ), ey)
+}
@@ -0,0 +1,160 @@
+package tracer
+
+import (
+	"math"
+
+	. "github.com/barnex/bruteray/geom"
+	. "github.com/barnex/bruteray/imagef/colorf"
+)
+
+// A PDFLight is a Light that can report the probability density
+// of the directions generated by Sample. This allows the light to be combined
+// with the material's own sampling by multiple importance sampling (MIS),
+// which strongly reduces noise for large lights and glossy materials.
+// See DirectLight, LightFieldMIS.
+//
+// Lights that cannot be hit by a ray (e.g. point lights) should not implement PDFLight.
+type PDFLight interface {
+	Light
+
+	// PDF returns the probability density, per unit solid angle,
+	// that Sample(ctx, target) returns a position in direction dir (unit vector) as seen from target.
+	// It returns 0 if the light is not visible in that direction.
+	PDF(target, dir Vec) float64
+}
+
+// A BSDF describes how a surface fragment scatters light towards the viewer,
+// for use with DirectLight.
+type BSDF interface {
+	// Eval returns the fraction of light incident from direction dir (unit vector)
+	// that is scattered towards the viewer, including the cosine of the angle of incidence.
+	// It is normalized like materials.Matte: a white Lambertian surface yields cosθ
+	// (i.e., it is π times the usual BSDF times cosθ).
+	//
+	// pdf is the probability density (per unit solid angle) with which the material
+	// samples direction dir for its indirect ray (which is then passed to LightFieldMIS).
+	Eval(dir Vec) (f Color, pdf float64)
+}
+
+// DirectLight returns the light that reaches the viewer directly from the light sources,
+// via a surface fragment at point p that scatters light according to bsdf.
+// Shadows are taken into account (see Occlude), and each light's contribution is recorded
+// with Ctx.AddDirect.
+//
+// For lights that implement PDFLight, the contribution is weighted by multiple importance sampling.
+// The remainder of their light must then be gathered by the material's own sampled ray,
+// via LightFieldMIS (rather than LightFieldIndirect).
+//
+// By default, all light sources are sampled. See SetLightSelection
+// for sampling only one light, chosen by importance, in scenes with many lights.
+func (s *Scene) DirectLight(ctx *Ctx, p Vec, bsdf BSDF) Color {
+	var acc Color
+	sec := ctx.Ray()
+	sec.Start = p
+
+	// At maximum recursion depth, LightFieldMIS returns black,
+	// so then the light sources must account for all direct light.
+	mis := ctx.CurrentRecursionDepth < s.RecursionDepth
+
+	for i := range s.lights {
+		if s.lightTree != nil && s.lightTree.leaf[i] >= 0 {
+			continue // sampled below
+		}
+		acc = acc.Add(s.directLight(ctx, sec, bsdf, i, 1, mis))
+	}
+
+	if s.lightTree != nil {
+		if i, prob := s.lightTree.sample(ctx.Generate1(), p); i >= 0 {
+			acc = acc.Add(s.directLight(ctx, sec, bsdf, i, prob, mis))
+		}
+	}
+
+	ctx.PutRay(sec)
+	return acc
+}
+
+// directLight returns the contribution of light i to DirectLight,
+// given the probability prob that the light was selected for sampling.
+// sec is a scratch ray, starting at the shading point.
+func (s *Scene) directLight(ctx *Ctx, sec *Ray, bsdf BSDF, i int, prob float64, mis bool) Color {
+	l := s.lights[i]
+	p := sec.Start
+
+	lpos, intens := l.Sample(ctx, p)
+	if intens == (Color{}) {
+		return Color{}
+	}
+
+	lDelta := lpos.Sub(p)
+	lDir := lDelta.Normalized()
+	f, pdf := bsdf.Eval(lDir)
+	if f == (Color{}) {
+		return Color{}
+	}
+
+	if l, ok := l.(PDFLight); ok && mis {
+		f = f.Mul(powerHeuristic(prob*l.PDF(p, lDir), pdf))
+	}
+
+	sec.Dir = lDir
+	intens = s.Occlude(ctx, sec, lDelta.Len(), intens)
+
+	c := intens.Mul3(f).Mul(1 / prob)
+	ctx.AddDirect(i, c)
+	return c
+}
+
+// LightFieldMIS is like LightFieldIndirect, but intended for a ray r
+// sampled by a material with probability density pdf (per unit solid angle),
+// when the material uses DirectLight for the light sources.
+// It returns weight times the light field seen by r, where the light sources
+// that implement PDFLight contribute as weighted by multiple importance sampling.
+// Weight is typically the material's BSDF (as in BSDF.Eval), divided by pdf.
+func (s *Scene) LightFieldMIS(ctx *Ctx, r *Ray, pdf float64, weight Color) Color {
+	if s.RecursionDepth == ctx.CurrentRecursionDepth {
+		return Color{} // reached maximum recursion depth, consistent with lightField
+	}
+	acc := s.LightFieldIndirect(ctx, r).Mul3(weight)
+
+	for i, l := range s.lights {
+		l, ok := l.(PDFLight)
+		if !ok {
+			continue
+		}
+		front := l.Object().Intersect(r)
+		if !(front.T > 0) || math.IsInf(front.T, 0) || front.Material == nil {
+			continue
+		}
+		lPDF := l.PDF(r.Start, r.Dir)
+		if lPDF == 0 {
+			continue
+		}
+		if s.lightTree != nil {
+			// DirectLight only samples the light with this probability.
+			// If zero, this ray is the only way to reach the light, so gets full weight.
+			lPDF *= s.lightTree.probability(i, r.Start)
+		}
+		h := HitCoords{T: front.T, Normal: front.Normal.Normalized(), Local: front.Local}
+		emission := front.Material.Shade(ctx, s, r, h)
+		if emission == (Color{}) {
+			continue
+		}
+		emission = s.Occlude(ctx, r, front.T, emission)
+		c := emission.Mul3(weight).Mul(powerHeuristic(pdf, lPDF))
+		acc = acc.Add(c)
+		ctx.AddDirect(i, c)
+	}
+	return acc
+}
+
+// powerHeuristic returns the multiple importance sampling weight
+// for a sample drawn with probability density pdf,
+// when another strategy would have drawn it with density other.
+// See Veach, "Robust Monte Carlo Methods for Light Transport Simulation" (1997), section 9.2.
+func powerHeuristic(pdf, other float64) float64 {
+	p2, o2 := pdf*pdf, other*other
+	if p2+o2 == 0 || math.IsInf(p2, 0) {
+		return 1
+	}
+	return p2 / (p2 + o2)
+}
@@ -1,6 +1,7 @@
 package objects
 
 import (
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
@@ -35,3 +36,13 @@ func (o *backdrop) Bounds() BoundingBox {
 // hack. allows spec to idendify and remove backdrop
 // when showing debugNormals
 func (o *backdrop) IsBackdrop() {}
+
+// Materials implements tracer.MaterialObject.
+func (o *backdrop) Materials() []Material {
+	return []Material{o.mat}
+}
+
+// Describe implements describe.Describer.
+func (o *backdrop) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "backdrop", "material": describeMaterial(e, o.mat)}
+}
@@ -1,6 +1,7 @@
 package objects
 
 import (
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
@@ -34,3 +35,14 @@ func (b *bounded) Intersect(r *Ray) HitRecord {
 	}
 	return b.orig.Intersect(r)
 }
+
+// Materials implements tracer.MaterialObject.
+func (b *bounded) Materials() []Material {
+	return MaterialsOf(b.orig)
+}
+
+// Describe implements describe.Describer.
+// The bounding box is only an optimization, so the original object is described.
+func (b *bounded) Describe(e *describe.Encoder) interface{} {
+	return e.Describe(b.orig)
+}
@@ -50,6 +50,25 @@ func (b BoundingBox) withMargin(delta float64) BoundingBox {
 	}
 }
 
+// union returns the smallest bounding box that contains both b and c.
+func (b BoundingBox) union(c BoundingBox) BoundingBox {
+	for i := range b.Min {
+		b.Min[i] = math.Min(b.Min[i], c.Min[i])
+		b.Max[i] = math.Max(b.Max[i], c.Max[i])
+	}
+	return b
+}
+
+// surfaceArea returns the total area of b's six faces.
+// Empty boxes (see emptyBox) have zero area.
+func (b BoundingBox) surfaceArea() float64 {
+	d := b.Size()
+	if d[X] < 0 || d[Y] < 0 || d[Z] < 0 {
+		return 0
+	}
+	return 2 * (d[X]*d[Y] + d[Y]*d[Z] + d[Z]*d[X])
+}
+
 func (b BoundingBox) Size() Vec   { return b.Max.Sub(b.Min) }
 func (b BoundingBox) Dx() float64 { return b.Size()[X] }
 func (b BoundingBox) Dy() float64 { return b.Size()[Y] }
@@ -166,4 +185,7 @@ func min3(x, y, z float64) float64 {
 var (
 	infBox = BoundingBox{Min: Vec{-inf, -inf, -inf}, Max: Vec{inf, inf, inf}}
 	inf    = math.Inf(1)
+
+	// emptyBox contains no points. It is the neutral element for union.
+	emptyBox = BoundingBox{Min: Vec{inf, inf, inf}, Max: Vec{-inf, -inf, -inf}}
 )
@@ -106,6 +106,33 @@ func TestIntersectAABB2(t *testing.T) {
 	}
 }
 
+// rayInv.intersect must agree with intersectAABB2.
+func TestRayInv_Intersect(t *testing.T) {
+	b := BoundingBox{Min: Vec{-1, -1, -1}, Max: Vec{1, 1, 1}}
+	bf := boundingBoxToF(b)
+
+	cases := []*Ray{
+		ray(Vec{0, 0, 0}, Vec{1, 0, 0}),
+		ray(Vec{1, 0, 0}, Vec{1, 0, 0}),
+		ray(Vec{-1, 0, 0}, Vec{-1, 0, 0}),
+		ray(Vec{2, 0, 0}, Vec{1, 0, 0}),
+		ray(Vec{2, 0, 0}, Vec{-1, 0, 0}),
+		ray(Vec{0, 4, 0}, Vec{0, -1, 0}),
+		ray(Vec{0, 4, 0}, Vec{1, 0, 0}),
+		ray(Vec{-3, -2, -1}, Vec{3, 2, 1.5}.Normalized()),
+	}
+
+	for i, r := range cases {
+		const tol = 1e-8
+		want1, want2 := intersectAABB2(&b, r)
+		ri := makeRayInv(r)
+		got1, got2 := ri.intersect(&bf)
+		if math.Abs(got1-want1) > tol || math.Abs(got2-want2) > tol {
+			t.Errorf("case %v: %v, got: %v,%v want: %v,%v", i, r, got1, got2, want1, want2)
+		}
+	}
+}
+
 func BenchmarkBoundingboxMiss(b *testing.B) {
 	box := &BoundingBox{Min: Vec{-1, -2, -3}, Max: Vec{1, 2, 3}}
 
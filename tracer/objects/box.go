@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
@@ -70,3 +71,18 @@ func approx(a, b float64) bool {
 }
 
 var unit = [3]Vec{Ex, Ey, Ez}
+
+// Materials implements tracer.MaterialObject.
+func (b *box) Materials() []Material {
+	return []Material{b.mat}
+}
+
+// Describe implements describe.Describer.
+func (b *box) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{
+		"type":     "boxWithBounds",
+		"material": describeMaterial(e, b.mat),
+		"min":      b.bounds.Min,
+		"max":      b.bounds.Max,
+	}
+}
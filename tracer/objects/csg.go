@@ -1,6 +1,7 @@
 package objects
 
 import (
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/tracer"
 	. "github.com/barnex/bruteray/tracer/types"
 	"github.com/barnex/bruteray/util"
@@ -80,6 +81,16 @@ func (o *and) Inside(p Vec) bool {
 	return o.a.Inside(p) && o.b.Inside(p)
 }
 
+// Materials implements tracer.MaterialObject.
+func (o *and) Materials() []Material {
+	return materialsOf(o.a, o.b)
+}
+
+// Describe implements describe.Describer.
+func (o *and) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "and", "objects": describeAll(e, o.a, o.b)}
+}
+
 func Or(a, b Interface) Interface {
 	return &or{a, b}
 }
@@ -119,6 +130,16 @@ func (o *or) Bounds() BoundingBox {
 	}
 }
 
+// Materials implements tracer.MaterialObject.
+func (o *or) Materials() []Material {
+	return materialsOf(o.a, o.b)
+}
+
+// Describe implements describe.Describer.
+func (o *or) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "or", "objects": describeAll(e, o.a, o.b)}
+}
+
 // March along the ray until we find an intersection with a that is not inside b.
 // Do not march further than maxT. (maxT is the position of an earlier solution.
 // It would occlude, so there is no point in searching beyond it.)
@@ -165,6 +186,16 @@ func (o *restrict) Inside(p Vec) bool {
 	return o.orig.Inside(p) && o.inside.Inside(p)
 }
 
+// Materials implements tracer.MaterialObject.
+func (o *restrict) Materials() []Material {
+	return MaterialsOf(o.orig)
+}
+
+// Describe implements describe.Describer.
+func (o *restrict) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "restrict", "objects": describeAll(e, o.orig, o.inside)}
+}
+
 type not struct {
 	orig Interface
 }
@@ -193,6 +224,16 @@ func (b *not) Inside(p Vec) bool {
 	return !b.orig.Inside(p)
 }
 
+// Materials implements tracer.MaterialObject.
+func (b *not) Materials() []Material {
+	return MaterialsOf(b.orig)
+}
+
+// Describe implements describe.Describer.
+func (b *not) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "not", "object": e.Describe(b.orig)}
+}
+
 func Difference(a, b Interface) Interface {
 	return And(a, Not(b))
 }
@@ -218,3 +259,22 @@ func (o *hollow) Intersect(r *Ray) HitRecord {
 func (o *hollow) Bounds() BoundingBox {
 	return o.orig.Bounds()
 }
+
+// Materials implements tracer.MaterialObject.
+func (o *hollow) Materials() []Material {
+	return MaterialsOf(o.orig)
+}
+
+// Describe implements describe.Describer.
+func (o *hollow) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "hollow", "object": e.Describe(o.orig)}
+}
+
+// describeAll describes a list of objects.
+func describeAll(e *describe.Encoder, objects ...Interface) []interface{} {
+	desc := make([]interface{}, len(objects))
+	for i, o := range objects {
+		desc[i] = e.Describe(o)
+	}
+	return desc
+}
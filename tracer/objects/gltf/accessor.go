@@ -0,0 +1,212 @@
+package gltf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/barnex/bruteray/geom"
+)
+
+// numComponents per element, by accessor type
+var numComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+// componentSize in bytes, by component type
+var componentSize = map[int]int{
+	Byte:          1,
+	UnsignedByte:  1,
+	Short:         2,
+	UnsignedShort: 2,
+	UnsignedInt:   4,
+	Float:         4,
+}
+
+// Read returns the elements of an accessor, with the given number of components per element
+// (e.g. 3 for a VEC3 accessor). Components are converted to float64,
+// normalized integers are mapped to 0..1 (unsigned) or -1..1 (signed).
+func (d *Document) Read(accessor int, components int) ([][]float64, error) {
+	if accessor < 0 || accessor >= len(d.Accessors) {
+		return nil, fmt.Errorf("accessor index out of range: %v", accessor)
+	}
+	a := &d.Accessors[accessor]
+	values, err := d.read(a)
+	if err != nil {
+		return nil, fmt.Errorf("accessor %v: %v", accessor, err)
+	}
+	if nc := numComponents[a.Type]; nc != components {
+		return nil, fmt.Errorf("accessor %v: need %v components, have %v (%v)", accessor, components, nc, a.Type)
+	}
+	return values, nil
+}
+
+// Vec3s returns the elements of a VEC3 accessor, e.g. vertex positions or normals.
+func (d *Document) Vec3s(accessor int) ([]geom.Vec, error) {
+	values, err := d.Read(accessor, 3)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]geom.Vec, len(values))
+	for i, x := range values {
+		v[i] = geom.Vec{x[0], x[1], x[2]}
+	}
+	return v, nil
+}
+
+// Vec2s returns the elements of a VEC2 accessor, e.g. texture coordinates.
+func (d *Document) Vec2s(accessor int) ([]geom.Vec2, error) {
+	values, err := d.Read(accessor, 2)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]geom.Vec2, len(values))
+	for i, x := range values {
+		v[i] = geom.Vec2{x[0], x[1]}
+	}
+	return v, nil
+}
+
+// Indices returns the elements of a SCALAR integer accessor, e.g. vertex indices.
+func (d *Document) Indices(accessor int) ([]int, error) {
+	values, err := d.Read(accessor, 1)
+	if err != nil {
+		return nil, err
+	}
+	if d.Accessors[accessor].ComponentType == Float {
+		return nil, fmt.Errorf("accessor %v: need integer indices", accessor)
+	}
+	idx := make([]int, len(values))
+	for i, x := range values {
+		idx[i] = int(x[0])
+	}
+	return idx, nil
+}
+
+func (d *Document) read(a *Accessor) ([][]float64, error) {
+	if len(a.Sparse) != 0 {
+		return nil, fmt.Errorf("sparse accessors are not supported")
+	}
+	nc, ok := numComponents[a.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type: %q", a.Type)
+	}
+	size, ok := componentSize[a.ComponentType]
+	if !ok {
+		return nil, fmt.Errorf("unknown component type: %v", a.ComponentType)
+	}
+	if a.Count < 0 {
+		return nil, fmt.Errorf("negative count")
+	}
+
+	values := make([][]float64, a.Count)
+	for i := range values {
+		values[i] = make([]float64, nc)
+	}
+	if a.BufferView == nil {
+		return values, nil // all zeros
+	}
+
+	view := d.BufferViews[*a.BufferView]
+	data := d.data[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength]
+	stride := view.ByteStride
+	if stride == 0 {
+		stride = nc * size
+	}
+	if a.Count > 0 && (a.ByteOffset < 0 || a.ByteOffset+(a.Count-1)*stride+nc*size > len(data)) {
+		return nil, fmt.Errorf("out of bounds of buffer view")
+	}
+
+	for i := range values {
+		elem := data[a.ByteOffset+i*stride:]
+		for c := range values[i] {
+			values[i][c] = readComponent(elem[c*size:], a.ComponentType, a.Normalized)
+		}
+	}
+	return values, nil
+}
+
+// readComponent reads a little-endian number of type typ.
+func readComponent(b []byte, typ int, normalized bool) float64 {
+	le := binary.LittleEndian
+	switch typ {
+	case Byte:
+		if normalized {
+			return math.Max(float64(int8(b[0]))/math.MaxInt8, -1)
+		}
+		return float64(int8(b[0]))
+	case UnsignedByte:
+		if normalized {
+			return float64(b[0]) / math.MaxUint8
+		}
+		return float64(b[0])
+	case Short:
+		if normalized {
+			return math.Max(float64(int16(le.Uint16(b)))/math.MaxInt16, -1)
+		}
+		return float64(int16(le.Uint16(b)))
+	case UnsignedShort:
+		if normalized {
+			return float64(le.Uint16(b)) / math.MaxUint16
+		}
+		return float64(le.Uint16(b))
+	case UnsignedInt:
+		return float64(le.Uint32(b))
+	case Float:
+		return float64(math.Float32frombits(le.Uint32(b)))
+	default:
+		panic(fmt.Sprintf("gltf: unknown component type: %v", typ))
+	}
+}
+
+// ImageData returns the encoded (PNG or JPEG) contents of an image,
+// stored in a buffer view, or a file or data URI.
+func (d *Document) ImageData(image int) ([]byte, error) {
+	if image < 0 || image >= len(d.Images) {
+		return nil, fmt.Errorf("image index out of range: %v", image)
+	}
+	im := &d.Images[image]
+	if im.BufferView != nil {
+		view := d.BufferViews[*im.BufferView]
+		return d.data[view.Buffer][view.ByteOffset : view.ByteOffset+view.ByteLength], nil
+	}
+	if im.URI == "" {
+		return nil, fmt.Errorf("image %v: no URI or buffer view", image)
+	}
+	data, err := d.readURI(im.URI)
+	if err != nil {
+		return nil, fmt.Errorf("image %v: %v", image, err)
+	}
+	return data, nil
+}
+
+// SceneNodes returns the root nodes of the default scene.
+// If no default scene is specified, the first scene is used.
+// If there are no scenes, all nodes without a parent are returned.
+func (d *Document) SceneNodes() []int {
+	if d.Scene != nil {
+		return d.Scenes[*d.Scene].Nodes
+	}
+	if len(d.Scenes) > 0 {
+		return d.Scenes[0].Nodes
+	}
+	hasParent := make([]bool, len(d.Nodes))
+	for _, n := range d.Nodes {
+		for _, c := range n.Children {
+			hasParent[c] = true
+		}
+	}
+	var roots []int
+	for i := range d.Nodes {
+		if !hasParent[i] {
+			roots = append(roots, i)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,513 @@
+// Package gltf reads glTF 2.0 files: JSON (.gltf) with external or embedded (data URI) buffers,
+// and binary (.glb).
+//
+// The JSON structure is decoded into a Document, whose fields follow the glTF specification
+// (https://www.khronos.org/registry/glTF/specs/2.0/glTF-2.0.html).
+// Properties not used by bruteray (animations, skins, morph targets, ...) are not decoded.
+// Missing properties get the default values defined by the specification.
+//
+// Besides the core specification, the following extensions are decoded:
+// KHR_lights_punctual, KHR_materials_transmission, KHR_materials_ior and KHR_materials_emissive_strength.
+//
+// See api.GLTFFile for how a Document is turned into a scene.
+package gltf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/barnex/bruteray/geom"
+)
+
+// A Document holds the contents of a glTF file.
+// Indices refer to the Document's arrays (e.g. Node.Mesh is an index into Meshes).
+// Optional indices are pointers, nil if absent.
+type Document struct {
+	Asset       Asset
+	Scene       *int // default scene
+	Scenes      []Scene
+	Nodes       []Node
+	Meshes      []Mesh
+	Materials   []Material
+	Textures    []Texture
+	Images      []Image
+	Cameras     []Camera
+	Accessors   []Accessor
+	BufferViews []BufferView
+	Buffers     []Buffer
+
+	ExtensionsRequired []string
+
+	Extensions struct {
+		LightsPunctual struct {
+			Lights []Light
+		} `json:"KHR_lights_punctual"`
+	}
+
+	dir  string   // directory for resolving relative URIs
+	data [][]byte // contents of each buffer
+}
+
+type Asset struct {
+	Version   string
+	Generator string
+}
+
+type Scene struct {
+	Name  string
+	Nodes []int // root nodes
+}
+
+// A Node is an element of the scene hierarchy.
+// Its transform is either a Matrix, or a Translation, Rotation (quaternion) and Scale.
+// See Transform.
+type Node struct {
+	Name        string
+	Children    []int
+	Mesh        *int
+	Camera      *int
+	Matrix      *[16]float64 // column-major
+	Translation [3]float64
+	Rotation    [4]float64 // unit quaternion x, y, z, w
+	Scale       [3]float64
+
+	Extensions struct {
+		LightsPunctual *struct {
+			Light int
+		} `json:"KHR_lights_punctual"`
+	}
+}
+
+type Mesh struct {
+	Name       string
+	Primitives []Primitive
+}
+
+// Primitive modes
+const (
+	Points        = 0
+	Lines         = 1
+	LineLoop      = 2
+	LineStrip     = 3
+	Triangles     = 4
+	TriangleStrip = 5
+	TriangleFan   = 6
+)
+
+// A Primitive is a part of a mesh with a single material.
+// Attributes maps attribute names (e.g. "POSITION", "NORMAL", "TEXCOORD_0") to accessors.
+type Primitive struct {
+	Attributes map[string]int
+	Indices    *int
+	Material   *int
+	Mode       int // default: Triangles
+}
+
+// A Material uses the metallic-roughness model.
+// Extensions that are absent have their default values
+// (e.g. no transmission, index of refraction 1.5).
+type Material struct {
+	Name                 string
+	PBRMetallicRoughness PBRMetallicRoughness `json:"pbrMetallicRoughness"`
+	EmissiveFactor       [3]float64
+	EmissiveTexture      *TextureInfo
+	AlphaMode            string // "OPAQUE" (default), "MASK" or "BLEND"
+	AlphaCutoff          float64
+	DoubleSided          bool
+
+	Extensions struct {
+		Transmission struct {
+			TransmissionFactor float64 // fraction of light transmitted through the surface
+		} `json:"KHR_materials_transmission"`
+		IOR struct {
+			IOR float64 `json:"ior"` // index of refraction, default 1.5
+		} `json:"KHR_materials_ior"`
+		EmissiveStrength struct {
+			EmissiveStrength float64 // multiplies EmissiveFactor, default 1
+		} `json:"KHR_materials_emissive_strength"`
+	}
+}
+
+type PBRMetallicRoughness struct {
+	BaseColorFactor          [4]float64 // linear RGBA
+	BaseColorTexture         *TextureInfo
+	MetallicFactor           float64
+	RoughnessFactor          float64
+	MetallicRoughnessTexture *TextureInfo // metalness in the blue channel, roughness in green
+}
+
+// A TextureInfo refers to a texture, and the TEXCOORD_n attribute used to look it up.
+type TextureInfo struct {
+	Index    int
+	TexCoord int
+}
+
+type Texture struct {
+	Source *int // image
+}
+
+// An Image is stored in a buffer view (with a MIME type),
+// or in a file or data URI.
+type Image struct {
+	Name       string
+	URI        string
+	MimeType   string
+	BufferView *int
+}
+
+// A Camera is either "perspective" or "orthographic".
+type Camera struct {
+	Name        string
+	Type        string
+	Perspective *struct {
+		AspectRatio float64 // width / height, 0 if not specified
+		Yfov        float64 // vertical field of view, in radians
+		Znear, Zfar float64
+	}
+	Orthographic *struct {
+		Xmag, Ymag  float64
+		Znear, Zfar float64
+	}
+}
+
+// A Light (KHR_lights_punctual) is a "point", "spot" or "directional" light,
+// emitting along its node's -Z axis (if directional).
+// Intensity is in candela (point, spot) or lux (directional).
+type Light struct {
+	Name      string
+	Type      string
+	Color     [3]float64 // linear RGB
+	Intensity float64
+	Range     float64 // 0 means infinite
+	Spot      struct {
+		InnerConeAngle float64
+		OuterConeAngle float64
+	}
+}
+
+// Accessor component types
+const (
+	Byte          = 5120
+	UnsignedByte  = 5121
+	Short         = 5122
+	UnsignedShort = 5123
+	UnsignedInt   = 5125
+	Float         = 5126
+)
+
+// An Accessor describes how to read typed elements from a buffer view.
+type Accessor struct {
+	BufferView    *int // nil: all zeros
+	ByteOffset    int
+	ComponentType int
+	Normalized    bool
+	Count         int
+	Type          string // "SCALAR", "VEC2", "VEC3", "VEC4", "MAT2", "MAT3" or "MAT4"
+	Sparse        json.RawMessage
+}
+
+type BufferView struct {
+	Buffer     int
+	ByteOffset int
+	ByteLength int
+	ByteStride int // 0 means tightly packed
+}
+
+// A Buffer is stored in a file or data URI,
+// or in the binary chunk of a .glb file (if URI is empty).
+type Buffer struct {
+	URI        string
+	ByteLength int
+}
+
+// UnmarshalJSON sets the defaults for absent properties.
+func (n *Node) UnmarshalJSON(b []byte) error {
+	type plain Node
+	p := plain{Rotation: [4]float64{0, 0, 0, 1}, Scale: [3]float64{1, 1, 1}}
+	err := json.Unmarshal(b, &p)
+	*n = Node(p)
+	return err
+}
+
+// UnmarshalJSON sets the defaults for absent properties.
+func (pr *Primitive) UnmarshalJSON(b []byte) error {
+	type plain Primitive
+	p := plain{Mode: Triangles}
+	err := json.Unmarshal(b, &p)
+	*pr = Primitive(p)
+	return err
+}
+
+// UnmarshalJSON sets the defaults for absent properties.
+func (m *Material) UnmarshalJSON(b []byte) error {
+	type plain Material
+	p := plain{
+		PBRMetallicRoughness: PBRMetallicRoughness{
+			BaseColorFactor: [4]float64{1, 1, 1, 1},
+			MetallicFactor:  1,
+			RoughnessFactor: 1,
+		},
+		AlphaMode:   "OPAQUE",
+		AlphaCutoff: 0.5,
+	}
+	p.Extensions.IOR.IOR = 1.5
+	p.Extensions.EmissiveStrength.EmissiveStrength = 1
+	err := json.Unmarshal(b, &p)
+	*m = Material(p)
+	return err
+}
+
+// UnmarshalJSON sets the defaults for absent properties.
+func (l *Light) UnmarshalJSON(b []byte) error {
+	type plain Light
+	p := plain{Color: [3]float64{1, 1, 1}, Intensity: 1}
+	p.Spot.OuterConeAngle = math.Pi / 4
+	err := json.Unmarshal(b, &p)
+	*l = Light(p)
+	return err
+}
+
+// Transform returns the node's transform, relative to its parent.
+func (n *Node) Transform() *geom.AffineTransform {
+	if m := n.Matrix; m != nil {
+		return &geom.AffineTransform{
+			A: geom.Matrix{
+				{m[0], m[1], m[2]},
+				{m[4], m[5], m[6]},
+				{m[8], m[9], m[10]},
+			},
+			B: geom.Vec{m[12], m[13], m[14]},
+		}
+	}
+
+	x, y, z, w := n.Rotation[0], n.Rotation[1], n.Rotation[2], n.Rotation[3]
+	rot := geom.Matrix{
+		{1 - 2*(y*y+z*z), 2 * (x*y + z*w), 2 * (x*z - y*w)},
+		{2 * (x*y - z*w), 1 - 2*(x*x+z*z), 2 * (y*z + x*w)},
+		{2 * (x*z + y*w), 2 * (y*z - x*w), 1 - 2*(x*x+y*y)},
+	}
+	s := n.Scale
+	scale := geom.Matrix{{s[0], 0, 0}, {0, s[1], 0}, {0, 0, s[2]}}
+	return &geom.AffineTransform{
+		A: rot.Mul(&scale),
+		B: n.Translation,
+	}
+}
+
+// ParseFile reads a .gltf or .glb file, and the external buffers it refers to.
+// The file type is detected from its contents.
+func ParseFile(fname string) (*Document, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Parse(data, filepath.Dir(fname))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", fname, err)
+	}
+	return d, nil
+}
+
+// Parse reads the contents of a .gltf or .glb file.
+// External buffers and images are resolved relative to directory dir.
+func Parse(data []byte, dir string) (*Document, error) {
+	var bin []byte
+	if bytes.HasPrefix(data, []byte(glbMagic)) {
+		var err error
+		data, bin, err = parseGLB(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d := &Document{dir: dir}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(d.Asset.Version, "2.") {
+		return nil, fmt.Errorf("unsupported glTF version: %q", d.Asset.Version)
+	}
+	for _, ext := range d.ExtensionsRequired {
+		if !supported[ext] {
+			return nil, fmt.Errorf("unsupported extension: %v", ext)
+		}
+	}
+	if err := d.loadBuffers(bin); err != nil {
+		return nil, err
+	}
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// supported lists the extensions that are decoded.
+var supported = map[string]bool{
+	"KHR_lights_punctual":             true,
+	"KHR_materials_transmission":      true,
+	"KHR_materials_ior":               true,
+	"KHR_materials_emissive_strength": true,
+}
+
+// GLB container format: a 12 byte header followed by chunks,
+// each with a length, type and data.
+const (
+	glbMagic     = "glTF"
+	glbChunkJSON = 0x4E4F534A
+	glbChunkBIN  = 0x004E4942
+)
+
+// parseGLB returns the JSON and binary (if any) chunks of a .glb file.
+func parseGLB(data []byte) (jsonChunk, bin []byte, err error) {
+	le := binary.LittleEndian
+	if len(data) < 12 {
+		return nil, nil, fmt.Errorf("glb: truncated header")
+	}
+	if v := le.Uint32(data[4:]); v != 2 {
+		return nil, nil, fmt.Errorf("glb: unsupported version: %v", v)
+	}
+	if l := int(le.Uint32(data[8:])); l <= len(data) {
+		data = data[:l]
+	}
+	data = data[12:]
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, nil, fmt.Errorf("glb: truncated chunk")
+		}
+		l, typ := int(le.Uint32(data)), le.Uint32(data[4:])
+		data = data[8:]
+		if l > len(data) {
+			return nil, nil, fmt.Errorf("glb: truncated chunk")
+		}
+		switch typ {
+		case glbChunkJSON:
+			jsonChunk = data[:l]
+		case glbChunkBIN:
+			bin = data[:l]
+		}
+		data = data[l:]
+	}
+	if jsonChunk == nil {
+		return nil, nil, fmt.Errorf("glb: missing JSON chunk")
+	}
+	return jsonChunk, bin, nil
+}
+
+// loadBuffers reads the contents of all buffers.
+// bin is the binary chunk of a .glb file, if any.
+func (d *Document) loadBuffers(bin []byte) error {
+	d.data = make([][]byte, len(d.Buffers))
+	for i, b := range d.Buffers {
+		var data []byte
+		if b.URI == "" {
+			if bin == nil {
+				return fmt.Errorf("buffer %v: missing URI", i)
+			}
+			data = bin
+		} else {
+			var err error
+			data, err = d.readURI(b.URI)
+			if err != nil {
+				return fmt.Errorf("buffer %v: %v", i, err)
+			}
+		}
+		if len(data) < b.ByteLength {
+			return fmt.Errorf("buffer %v: have %v bytes, need %v", i, len(data), b.ByteLength)
+		}
+		d.data[i] = data[:b.ByteLength]
+	}
+	return nil
+}
+
+// readURI returns the contents of a data URI, or a file relative to the document.
+func (d *Document) readURI(uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		i := strings.Index(uri, ";base64,")
+		if i < 0 {
+			return nil, fmt.Errorf("unsupported data URI: %.40q", uri)
+		}
+		return base64.StdEncoding.DecodeString(uri[i+len(";base64,"):])
+	}
+	path, err := url.PathUnescape(uri) // e.g. "%20" for a space
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filepath.Join(d.dir, filepath.FromSlash(path)))
+}
+
+// check verifies that all indices are within range,
+// so that they can be used without further checks.
+func (d *Document) check() error {
+	var err error
+	check := func(what string, i, n int) {
+		if err == nil && (i < 0 || i >= n) {
+			err = fmt.Errorf("%v index out of range: %v, have %v", what, i, n)
+		}
+	}
+	checkOpt := func(what string, i *int, n int) {
+		if i != nil {
+			check(what, *i, n)
+		}
+	}
+
+	checkOpt("scene", d.Scene, len(d.Scenes))
+	for _, s := range d.Scenes {
+		for _, n := range s.Nodes {
+			check("node", n, len(d.Nodes))
+		}
+	}
+	for _, n := range d.Nodes {
+		for _, c := range n.Children {
+			check("node", c, len(d.Nodes))
+		}
+		checkOpt("mesh", n.Mesh, len(d.Meshes))
+		checkOpt("camera", n.Camera, len(d.Cameras))
+		if l := n.Extensions.LightsPunctual; l != nil {
+			check("light", l.Light, len(d.Extensions.LightsPunctual.Lights))
+		}
+	}
+	for _, m := range d.Meshes {
+		for _, p := range m.Primitives {
+			for _, a := range p.Attributes {
+				check("accessor", a, len(d.Accessors))
+			}
+			checkOpt("accessor", p.Indices, len(d.Accessors))
+			checkOpt("material", p.Material, len(d.Materials))
+		}
+	}
+	checkTex := func(t *TextureInfo) {
+		if t != nil {
+			check("texture", t.Index, len(d.Textures))
+		}
+	}
+	for _, m := range d.Materials {
+		checkTex(m.PBRMetallicRoughness.BaseColorTexture)
+		checkTex(m.PBRMetallicRoughness.MetallicRoughnessTexture)
+		checkTex(m.EmissiveTexture)
+	}
+	for _, t := range d.Textures {
+		checkOpt("image", t.Source, len(d.Images))
+	}
+	for _, im := range d.Images {
+		checkOpt("buffer view", im.BufferView, len(d.BufferViews))
+	}
+	for _, a := range d.Accessors {
+		checkOpt("buffer view", a.BufferView, len(d.BufferViews))
+	}
+	for _, v := range d.BufferViews {
+		check("buffer", v.Buffer, len(d.Buffers))
+		if err == nil && (v.ByteOffset < 0 || v.ByteLength < 0 || v.ByteOffset+v.ByteLength > d.Buffers[v.Buffer].ByteLength) {
+			err = fmt.Errorf("buffer view out of range")
+		}
+	}
+	return err
+}
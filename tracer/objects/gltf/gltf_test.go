@@ -0,0 +1,219 @@
+package gltf
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/barnex/bruteray/geom"
+)
+
+// The .gltf (with external .bin) and .glb test files contain the same scene.
+func TestParseFile(t *testing.T) {
+	for _, file := range []string{"testdata/scene.gltf", "testdata/scene.glb"} {
+		d, err := ParseFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := d.SceneNodes(), []int{0, 1, 4, 5, 6, 7}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: scene nodes: got %v, want %v", file, got, want)
+		}
+
+		prim := d.Meshes[0].Primitives[0]
+		pos, err := d.Vec3s(prim.Attributes["POSITION"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(pos), 24; got != want {
+			t.Errorf("%v: positions: got %v, want %v", file, got, want)
+		}
+		if got, want := pos[0], (geom.Vec{0.5, -0.5, 0.5}); got != want {
+			t.Errorf("%v: position: got %v, want %v", file, got, want)
+		}
+		uv, err := d.Vec2s(prim.Attributes["TEXCOORD_0"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := uv[2], (geom.Vec2{1, 0}); got != want {
+			t.Errorf("%v: texture coordinate: got %v, want %v", file, got, want)
+		}
+		idx, err := d.Indices(*prim.Indices)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := idx[6:12], []int{4, 5, 6, 4, 6, 7}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%v: indices: got %v, want %v", file, got, want)
+		}
+		if got, want := d.Meshes[1].Primitives[0].Mode, TriangleStrip; got != want {
+			t.Errorf("%v: mode: got %v, want %v", file, got, want)
+		}
+
+		img, err := d.ImageData(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(img), "\x89PNG") {
+			t.Errorf("%v: image: not a PNG", file)
+		}
+
+		lights := d.Extensions.LightsPunctual.Lights
+		if got, want := len(lights), 3; got != want {
+			t.Fatalf("%v: lights: got %v, want %v", file, got, want)
+		}
+		if got, want := lights[2].Type, "spot"; got != want {
+			t.Errorf("%v: light type: got %v, want %v", file, got, want)
+		}
+		if got, want := d.Nodes[7].Extensions.LightsPunctual.Light, 2; got != want {
+			t.Errorf("%v: node light: got %v, want %v", file, got, want)
+		}
+	}
+}
+
+// Absent properties get the default values of the specification.
+func TestDefaults(t *testing.T) {
+	d, err := Parse([]byte(`{
+		"asset": {"version": "2.0"},
+		"nodes": [{"name": "n"}],
+		"meshes": [{"primitives": [{"attributes": {}}]}],
+		"materials": [{"name": "m", "pbrMetallicRoughness": {"roughnessFactor": 0.5}}],
+		"extensions": {"KHR_lights_punctual": {"lights": [{"type": "spot"}]}}
+	}`), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := d.Nodes[0]
+	if got, want := n.Rotation, [4]float64{0, 0, 0, 1}; got != want {
+		t.Errorf("rotation: got %v, want %v", got, want)
+	}
+	if got, want := n.Scale, [3]float64{1, 1, 1}; got != want {
+		t.Errorf("scale: got %v, want %v", got, want)
+	}
+	if got, want := *n.Transform(), *geom.UnitTransform(); got != want {
+		t.Errorf("transform: got %v, want %v", got, want)
+	}
+	if got, want := d.Meshes[0].Primitives[0].Mode, Triangles; got != want {
+		t.Errorf("mode: got %v, want %v", got, want)
+	}
+
+	m := d.Materials[0]
+	pbr := m.PBRMetallicRoughness
+	if pbr.BaseColorFactor != [4]float64{1, 1, 1, 1} || pbr.MetallicFactor != 1 || pbr.RoughnessFactor != 0.5 {
+		t.Errorf("pbrMetallicRoughness: got %+v", pbr)
+	}
+	if m.AlphaMode != "OPAQUE" || m.AlphaCutoff != 0.5 {
+		t.Errorf("alpha: got %v %v", m.AlphaMode, m.AlphaCutoff)
+	}
+	if got, want := m.Extensions.IOR.IOR, 1.5; got != want {
+		t.Errorf("ior: got %v, want %v", got, want)
+	}
+	if got, want := m.Extensions.EmissiveStrength.EmissiveStrength, 1.0; got != want {
+		t.Errorf("emissive strength: got %v, want %v", got, want)
+	}
+
+	l := d.Extensions.LightsPunctual.Lights[0]
+	if l.Color != [3]float64{1, 1, 1} || l.Intensity != 1 || l.Spot.OuterConeAngle != math.Pi/4 {
+		t.Errorf("light: got %+v", l)
+	}
+
+	if got, want := d.SceneNodes(), []int{0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("scene nodes: got %v, want %v", got, want)
+	}
+}
+
+// A node's matrix and the equivalent translation, rotation and scale
+// give the same transform.
+func TestNode_Transform(t *testing.T) {
+	c, s := math.Cos(math.Pi/6), math.Sin(math.Pi/6)
+	trs := Node{
+		Translation: [3]float64{1, 2, 3},
+		Rotation:    [4]float64{0, math.Sin(math.Pi / 12), 0, math.Cos(math.Pi / 12)}, // 30 deg around Y
+		Scale:       [3]float64{2, 3, 4},
+	}
+	mat := Node{
+		Matrix: &[16]float64{
+			2 * c, 0, -2 * s, 0,
+			0, 3, 0, 0,
+			4 * s, 0, 4 * c, 0,
+			1, 2, 3, 1,
+		},
+	}
+	want := geom.ComposeLR(
+		&geom.AffineTransform{A: geom.Matrix{{2, 0, 0}, {0, 3, 0}, {0, 0, 4}}},
+		geom.Rotate(geom.O, geom.Ey, math.Pi/6),
+		geom.Translate(geom.Vec{1, 2, 3}),
+	)
+	for _, x := range []geom.Vec{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {1, -2, 3}} {
+		w := want.TransformPoint(x)
+		for _, n := range []*Node{&trs, &mat} {
+			if got := n.Transform().TransformPoint(x); got.Sub(w).Len() > 1e-9 {
+				t.Errorf("%v: got %v, want %v", x, got, w)
+			}
+		}
+	}
+}
+
+// Buffers may be embedded as base64 data URIs.
+// Normalized integers are mapped to 0..1 or -1..1.
+func TestRead_DataURI(t *testing.T) {
+	// bytes: 0, 128, 255, 127 (unsigned) and -127 (signed)
+	d, err := Parse([]byte(`{
+		"asset": {"version": "2.0"},
+		"buffers": [{"byteLength": 5, "uri": "data:application/octet-stream;base64,AID/f4E="}],
+		"bufferViews": [{"buffer": 0, "byteLength": 5}],
+		"accessors": [
+			{"bufferView": 0, "componentType": 5121, "normalized": true, "count": 4, "type": "SCALAR"},
+			{"bufferView": 0, "byteOffset": 3, "componentType": 5120, "normalized": true, "count": 1, "type": "VEC2"},
+			{"componentType": 5126, "count": 2, "type": "VEC3"}
+		]
+	}`), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := d.Read(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v, [][]float64{{0}, {128. / 255}, {1}, {127. / 255}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unsigned: got %v, want %v", got, want)
+	}
+	v2, err := d.Vec2s(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v2[0], (geom.Vec2{1, -1}); got != want {
+		t.Errorf("signed: got %v, want %v", got, want)
+	}
+	v3, err := d.Vec3s(2) // no buffer view: zeros
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := v3, []geom.Vec{{}, {}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("zeros: got %v, want %v", got, want)
+	}
+	if _, err := d.Vec3s(0); err == nil {
+		t.Errorf("expected error for wrong type")
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, doc := range []string{
+		``,
+		`{"asset": {"version": "1.0"}}`,
+		`{"asset": {"version": "2.0"}, "extensionsRequired": ["KHR_draco_mesh_compression"]}`,
+		`{"asset": {"version": "2.0"}, "scenes": [{"nodes": [1]}], "nodes": [{}]}`,
+		`{"asset": {"version": "2.0"}, "buffers": [{"byteLength": 4}]}`,
+		`{"asset": {"version": "2.0"}, "buffers": [{"byteLength": 4, "uri": "data:,abc"}]}`,
+		`{"asset": {"version": "2.0"}, "buffers": [{"byteLength": 4, "uri": "data:;base64,AAAAAA=="}], "bufferViews": [{"buffer": 0, "byteOffset": 2, "byteLength": 4}]}`,
+		"glTF\x02\x00\x00\x00\x14\x00\x00\x00\x04\x00\x00\x00JSON{}",
+		"glTF\x01\x00\x00\x00\x0c\x00\x00\x00",
+	} {
+		if _, err := Parse([]byte(doc), "."); err == nil {
+			t.Errorf("expected error: %q", doc)
+		} else {
+			t.Log(err)
+		}
+	}
+}
@@ -9,6 +9,7 @@ about this.
 package objects
 
 import (
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
@@ -39,3 +40,22 @@ type hollowSurface struct{}
 func (hollowSurface) Inside(Vec) bool {
 	return false
 }
+
+// describeMaterial describes an object's material.
+// Objects that only serve as a shape (e.g. the cylinder restricting a Disk) may have a nil material,
+// which is described as black.
+func describeMaterial(e *describe.Encoder, m Material) interface{} {
+	if m == nil {
+		return 0.0
+	}
+	return e.Describe(m)
+}
+
+// materialsOf returns the materials of all objects, in order (see tracer.MaterialObject).
+func materialsOf(objs ...Interface) []Material {
+	var m []Material
+	for _, o := range objs {
+		m = append(m, MaterialsOf(o)...)
+	}
+	return m
+}
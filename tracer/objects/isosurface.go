@@ -195,3 +195,8 @@ func (f *isoSurface) bisect(r *Ray, min, max float64) float64 {
 //
 //	return t2, t1
 //}
+
+// Materials implements tracer.MaterialObject.
+func (s *isoSurface) Materials() []Material {
+	return []Material{s.mat}
+}
@@ -2,9 +2,16 @@ package objects
 
 import (
 	"fmt"
+	"io"
 	"log"
+	"path/filepath"
+	"sort"
 
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer/materials"
 	"github.com/barnex/bruteray/tracer/objects/obj"
 	"github.com/barnex/bruteray/tracer/objects/ply"
 	. "github.com/barnex/bruteray/tracer/types"
@@ -28,6 +35,56 @@ func Mesh(m Material, vertices []Vec, faceIdx [][3]int) Interface {
 //
 // len(UV) must be equal to len(vertices) (exactly one UV coordinate per vertex).
 func MeshWithUV(m Material, vertices []Vec, faceIdx [][3]int, UV []Vec2) Interface {
+	return mesh(m, makeFaces(vertices, faceIdx, UV))
+}
+
+// VertexAttributes holds optional per-vertex attributes for MeshWithAttributes.
+// Each slice must be nil (absent), or hold exactly one element per vertex.
+type VertexAttributes struct {
+	Normals []Vec   // normal vectors, interpolated over the faces. Calculated like Mesh if absent.
+	UV      []Vec2  // texture coordinates, like MeshWithUV
+	Colors  []Color // vertex colors, used as local coordinates if there are no UV coordinates
+}
+
+// MeshWithAttributes is like Mesh, but with optional per-vertex normals, UV coordinates and colors,
+// as read from a file by PlyFile.
+//
+// Vertex colors are interpolated over the faces, and take the place of the local coordinates
+// (R, G, B instead of U, V, 0), so that they can be rendered by a material with texture.VertexColor. E.g.:
+// 	MeshWithAttributes(Matte(texture.VertexColor), vertices, faces, VertexAttributes{Colors: colors})
+// Colors are ignored if UV coordinates are present.
+func MeshWithAttributes(m Material, vertices []Vec, faceIdx [][3]int, attr VertexAttributes) Interface {
+	check := func(what string, n int) {
+		if n != 0 && n != len(vertices) {
+			panic(fmt.Sprintf("MeshWithAttributes: have %v vertices but %v %v", len(vertices), n, what))
+		}
+	}
+	check("normals", len(attr.Normals))
+	check("UV coordinates", len(attr.UV))
+	check("colors", len(attr.Colors))
+
+	faces := makeFaces(vertices, faceIdx, attr.UV)
+	calcNormals(faces)
+	for i, idx := range faceIdx {
+		for c, vi := range idx {
+			v := faces[i][c]
+			if attr.Normals != nil {
+				v.Normal = attr.Normals[vi]
+			}
+			if attr.UV == nil && attr.Colors != nil {
+				col := attr.Colors[vi]
+				v.U, v.V, v.W = col.R, col.G, col.B
+			}
+		}
+	}
+	mesh := meshTree(m, faces, SplitSAH)
+	mesh.vertexColors = attr.UV == nil && attr.Colors != nil
+	return mesh
+}
+
+// makeFaces converts vertex positions, UV coordinates (optional)
+// and face indices into faces.
+func makeFaces(vertices []Vec, faceIdx [][3]int, UV []Vec2) []face {
 	// TODO: check slice lengths.
 
 	// Convert positions to vertices
@@ -47,14 +104,26 @@ func MeshWithUV(m Material, vertices []Vec, faceIdx [][3]int, UV []Vec2) Interfa
 			faces[i][c] = &Vertices[idxs[c]]
 		}
 	}
-	return mesh(m, faces)
+	return faces
 }
 
 // mesh calculates normal vectors and constructs a BHV tree containing the faces.
+// The tree is built with the Surface Area Heuristic, which pays off for
+// all but the smallest meshes.
 func mesh(m Material, faces []face) Interface {
+	return meshWithSplit(m, faces, SplitSAH)
+}
+
+// meshWithSplit is like mesh, but allows to choose how the tree is built.
+func meshWithSplit(m Material, faces []face, split SplitMethod) Interface {
 	// Set each vertex's normal to the average normal of the faces sharing it.
 	calcNormals(faces)
+	return meshTree(m, faces, split)
+}
 
+// meshTree constructs a BHV tree containing the faces,
+// whose normals must have been calculated already.
+func meshTree(m Material, faces []face, split SplitMethod) *withMaterial {
 	// Convert faces to interface type so they can be use in a Tree.
 	faceIf := make([]Interface, len(faces))
 	for i := range faceIf {
@@ -63,7 +132,7 @@ func mesh(m Material, faces []face) Interface {
 
 	// Return Tree containing the faces, wrapped with the desired material.
 	return &withMaterial{
-		orig: Tree(faceIf...),
+		orig: TreeWithSplit(split, DefaultLeafSize, faceIf...),
 		mat:  m,
 	}
 }
@@ -171,54 +240,214 @@ func Parametric(m Material, numU, numV int, f func(u, v float64) Vec) Interface
 	return mesh(m, faces)
 }
 
-// PlyFile reads a mesh from a file in Standord PLY format.
+// PlyFile reads a mesh from a file in Standord PLY format (ASCII or binary).
 // Optional affine transformations are applied to the vertices (left-to-right).
+//
+// Normals, UV coordinates and vertex colors are used if present in the file,
+// see MeshWithAttributes. If m is nil, vertex-colored meshes
+// get a Matte material with their vertex colors (e.g. for 3D scans),
+// other meshes a white Matte material.
 // TODO: .gz
 func PlyFile(m Material, file string, transf ...*geom.AffineTransform) Interface {
-	v, f, err := ply.ParseFile(file)
+	o, err := LoadPlyFile(m, file, transf...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return o
+}
+
+// LoadPlyFile is like PlyFile, but returns an error if the file cannot be read,
+// rather than exiting.
+func LoadPlyFile(m Material, file string, transf ...*geom.AffineTransform) (Interface, error) {
+	mesh, err := ply.ParseMeshFile(file)
+	if err != nil {
+		return nil, err
+	}
 	if len(transf) != 0 {
-		applyTransform(geom.ComposeLR(transf...), v)
+		t := geom.ComposeLR(transf...)
+		applyTransform(t, mesh.Vertices)
+		transformNormals(t, mesh.Normals)
 	}
-	return Mesh(m, v, f)
+	if m == nil {
+		m = defaultObjMaterial
+		if mesh.Colors != nil && mesh.UV == nil {
+			m = materials.Matte(texture.VertexColor)
+		}
+	}
+	return MeshWithAttributes(m, mesh.Vertices, mesh.Faces, VertexAttributes{
+		Normals: mesh.Normals,
+		UV:      mesh.UV,
+		Colors:  mesh.Colors,
+	}), nil
 }
 
+// ObjFile reads a mesh from a file in Wavefront OBJ format.
+// Optional affine transformations are applied to the vertices (left-to-right).
+//
+// Texture coordinates and normals are used if present in the file,
+// else the mesh is smooth, like Mesh. Polygons are split into triangles.
+//
+// Each face gets the material named by the file's usemtl statement:
+// from the map m if present (m may be nil), else translated from the file's material library (mtllib),
+// see MtlMaterial. Faces with an unknown material (or none) are white Matte.
 func ObjFile(m map[string]Material, file string, transf ...*geom.AffineTransform) Interface {
-	o, err := obj.ParseFile(file)
+	o, err := LoadObjFile(m, file, transf...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return o
+}
+
+// LoadObjFile is like ObjFile, but returns an error if the file cannot be read,
+// rather than exiting. Missing material libraries are not an error, as for ObjFile.
+func LoadObjFile(m map[string]Material, file string, transf ...*geom.AffineTransform) (Interface, error) {
+	o, err := obj.ParseFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var t *geom.AffineTransform
 	if len(transf) != 0 {
-		applyTransform(geom.ComposeLR(transf...), o.Vertices)
+		t = geom.ComposeLR(transf...)
+		applyTransform(t, o.Vertices)
+		transformNormals(t, o.Normals)
 	}
 
-	objects := make([]Interface, 0, len(m))
-	for mat, faces := range o.Faces {
-		m, ok := m[mat]
+	dir := filepath.Dir(file)
+	lib := make(map[string]*obj.Material)
+	for _, fname := range o.MtlLibs {
+		mtl, err := obj.ParseMtlFile(filepath.Join(dir, fname))
+		if err != nil {
+			log.Println(err) // not fatal: materials may be provided by m
+			continue
+		}
+		for name, mat := range mtl {
+			lib[name] = mat
+		}
+	}
+
+	// sort by material name, so that the result does not depend on map order
+	names := make([]string, 0, len(o.Faces))
+	for name := range o.Faces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	objects := make([]Interface, 0, len(names))
+	for _, name := range names {
+		mat, ok := m[name]
 		if !ok {
-			log.Fatalf("material not defined: %q", mat)
+			if l, ok := lib[name]; ok {
+				mat = MtlMaterial(l, dir)
+			} else {
+				if name != "" {
+					log.Printf("%v: material not defined: %q", file, name)
+				}
+				mat = defaultObjMaterial
+			}
 		}
-		objects = append(objects, plyObj(m, o.Vertices, faces))
+		objects = append(objects, objMesh(mat, &o, o.Faces[name]))
 	}
-	return Tree(objects...)
+	return Tree(objects...), nil
 }
 
-func plyObj(m Material, v []Vec, f [][]int32) Interface {
-	var f2 [][3]int
-	for _, f := range f {
-		switch len(f) {
-		default:
-			panic(fmt.Sprintf("want 3 or 4 vertices, got %v", len(f)))
-		case 3:
-			f2 = append(f2, [3]int{int(f[0]), int(f[1]), int(f[2])})
-		case 4:
-			f2 = append(f2, [3]int{int(f[0]), int(f[1]), int(f[2])})
-			f2 = append(f2, [3]int{int(f[2]), int(f[3]), int(f[0])})
+// defaultObjMaterial is used for OBJ and PLY files without a material.
+var defaultObjMaterial = materials.Matte(colorf.White.EV(-0.3))
+
+// objMesh constructs a mesh with given material from faces of an OBJ file.
+// A vertex is made for each distinct combination of position, texture coordinate
+// and normal index.
+func objMesh(m Material, o *obj.Obj, objFaces []obj.Face) Interface {
+	type key struct{ v, vt, vn int32 }
+	index := make(map[key]int)
+	var vertices []vertex
+	fileNormal := make(map[int]int32) // vertex index -> normal index, for normals given by the file
+	vertexIdx := func(f *obj.Face, c int) int {
+		k := key{f.V[c], -1, -1}
+		if f.VT != nil {
+			k.vt = f.VT[c]
+		}
+		if f.VN != nil {
+			k.vn = f.VN[c]
+		}
+		if i, ok := index[k]; ok {
+			return i
+		}
+		v := vertex{Pos: o.Vertices[k.v]}
+		if k.vt >= 0 {
+			v.U, v.V = o.TexCoords[k.vt][0], o.TexCoords[k.vt][1]
 		}
+		if k.vn >= 0 {
+			fileNormal[len(vertices)] = k.vn
+		}
+		index[k] = len(vertices)
+		vertices = append(vertices, v)
+		return index[k]
+	}
+
+	var faceIdx [][3]int
+	for i := range objFaces {
+		f := &objFaces[i]
+		for _, t := range f.Triangles() {
+			faceIdx = append(faceIdx, [3]int{vertexIdx(f, t[0]), vertexIdx(f, t[1]), vertexIdx(f, t[2])})
+		}
+	}
+
+	faces := make([]face, len(faceIdx))
+	for i, idx := range faceIdx {
+		for c := range idx {
+			faces[i][c] = &vertices[idx[c]]
+		}
+	}
+
+	// calculate smooth normals, then override those given by the file.
+	calcNormals(faces)
+	for i, n := range fileNormal {
+		vertices[i].Normal = o.Normals[n]
+	}
+	return meshTree(m, faces, SplitSAH)
+}
+
+// A MeshTriangle is one face of a mesh, see Triangles.
+type MeshTriangle struct {
+	Pos [3]Vec  // vertex positions
+	UV  [3]Vec2 // vertex UV coordinates
+}
+
+// Triangles returns the faces of a mesh (as constructed by Mesh, MeshWithUV, PlyFile, ObjFile, Rectangle, ...),
+// e.g. to turn the mesh into a light source.
+// The mesh may be part of a Tree, or Transformed, as long as it consists only of triangles.
+// ok is false for other objects (e.g. spheres, or a Disk, which is restricted by a cylinder).
+func Triangles(o Interface) (t []MeshTriangle, ok bool) {
+	switch o := o.(type) {
+	default:
+		return nil, false
+	case *face:
+		var m MeshTriangle
+		for i, v := range o {
+			m.Pos[i] = v.Pos
+			m.UV[i] = Vec2{v.U, v.V}
+		}
+		return []MeshTriangle{m}, true
+	case *withMaterial:
+		return Triangles(o.orig)
+	case *tree:
+		for _, o := range o.leafs {
+			ch, ok := Triangles(o)
+			if !ok {
+				return nil, false
+			}
+			t = append(t, ch...)
+		}
+		return t, true
+	case *transformed:
+		t, ok := Triangles(o.orig)
+		for i := range t {
+			for c := range t[i].Pos {
+				t[i].Pos[c] = o.forward.TransformPoint(t[i].Pos[c])
+			}
+		}
+		return t, ok
 	}
-	return Mesh(m, v, f2)
 }
 
 func applyTransform(t *geom.AffineTransform, v []Vec) {
@@ -227,16 +456,27 @@ func applyTransform(t *geom.AffineTransform, v []Vec) {
 	}
 }
 
+// transformNormals transforms normal vectors n to unit normals of a surface transformed by t.
+// Normals transform with the inverse transpose of t's linear part,
+// so that they remain perpendicular to the surface also under non-uniform scaling or shear.
+func transformNormals(t *geom.AffineTransform, n []Vec) {
+	inv := t.A.Inverse() // column-major, so row i of the transpose is inv[i]
+	for i, v := range n {
+		n[i] = Vec{inv[0].Dot(v), inv[1].Dot(v), inv[2].Dot(v)}.Normalized()
+	}
+}
+
 func WithMaterial(m Material, obj Interface) Interface {
-	return &withMaterial{m, obj}
+	return &withMaterial{mat: m, orig: obj}
 }
 
 // withMaterial wraps an object with an other material.
 // In case of a mesh, the faces do not individually store their material,
 // we wrap it around the mesh in its entirety afterwards.
 type withMaterial struct {
-	mat  Material
-	orig Interface
+	mat          Material
+	orig         Interface
+	vertexColors bool // the mesh's local coordinates hold vertex colors, see MeshWithAttributes
 }
 
 func (o *withMaterial) Intersect(r *Ray) HitRecord {
@@ -253,13 +493,114 @@ func (o *withMaterial) Inside(p Vec) bool {
 	return o.orig.Inside(p)
 }
 
+// Materials implements tracer.MaterialObject.
+func (o *withMaterial) Materials() []Material {
+	return []Material{o.mat}
+}
+
+// Describe implements describe.Describer.
+// Meshes are written to a PLY or OBJ file (see describe.Encoder.MeshFormat).
+// Other objects wrapped with a material cannot be described.
+func (o *withMaterial) Describe(e *describe.Encoder) interface{} {
+	mesh := o.orig
+	hasColor := o.vertexColors
+	for w, ok := mesh.(*withMaterial); ok; w, ok = mesh.(*withMaterial) {
+		mesh = w.orig // the outermost material wins
+		hasColor = hasColor || w.vertexColors
+	}
+	faces, ok := meshFaces(mesh)
+	if !ok {
+		e.Errorf("cannot describe %T with material", mesh)
+		return nil
+	}
+
+	// number the vertices, which may be shared between faces
+	index := make(map[*vertex]int)
+	var vertices []*vertex
+	faceIdx := make([][3]int, len(faces))
+	var hasUV bool
+	for i, f := range faces {
+		for c, v := range f {
+			if _, ok := index[v]; !ok {
+				index[v] = len(vertices)
+				vertices = append(vertices, v)
+				hasUV = hasUV || v.U != 0 || v.V != 0
+			}
+			faceIdx[i][c] = index[v]
+		}
+	}
+
+	mat := describeMaterial(e, o.mat)
+	switch {
+	default:
+		e.Errorf("unknown mesh format: %q", e.MeshFormat)
+		return nil
+	case e.MeshFormat == "" || e.MeshFormat == "ply" || hasColor:
+		m := &ply.Mesh{Faces: faceIdx}
+		for _, v := range vertices {
+			m.Vertices = append(m.Vertices, v.Pos)
+			m.Normals = append(m.Normals, v.Normal)
+			switch {
+			case hasColor: // local coordinates hold the vertex color, see MeshWithAttributes
+				m.Colors = append(m.Colors, colorf.Color{R: v.U, G: v.V, B: v.W})
+			case hasUV:
+				m.UV = append(m.UV, Vec2{v.U, v.V})
+			}
+		}
+		file := e.File(mesh, "mesh.ply", func(w io.Writer) error { return ply.Write(w, m) })
+		return describe.Node{"type": "plyFile", "file": file, "material": mat}
+	case e.MeshFormat == "obj":
+		const name = "mesh" // material name (usemtl) in the OBJ file
+		m := &obj.Obj{Faces: map[string][]obj.Face{name: make([]obj.Face, len(faceIdx))}}
+		for _, v := range vertices {
+			m.Vertices = append(m.Vertices, v.Pos)
+			m.Normals = append(m.Normals, v.Normal)
+			if hasUV {
+				m.TexCoords = append(m.TexCoords, Vec2{v.U, v.V})
+			}
+		}
+		for i, idx := range faceIdx {
+			f := &m.Faces[name][i]
+			for _, vi := range idx {
+				f.V = append(f.V, int32(vi))
+				f.VN = append(f.VN, int32(vi))
+				if hasUV {
+					f.VT = append(f.VT, int32(vi))
+				}
+			}
+		}
+		file := e.File(mesh, "mesh.obj", func(w io.Writer) error { return obj.Write(w, m) })
+		return describe.Node{"type": "objFile", "file": file, "materials": describe.Node{name: mat}}
+	}
+}
+
+// meshFaces returns the faces of a mesh's tree,
+// ok is false if the tree contains other objects.
+func meshFaces(o Interface) (faces []*face, ok bool) {
+	switch o := o.(type) {
+	default:
+		return nil, false
+	case *face:
+		return []*face{o}, true
+	case *tree:
+		for _, o := range o.leafs {
+			f, ok := meshFaces(o)
+			if !ok {
+				return nil, false
+			}
+			faces = append(faces, f...)
+		}
+		return faces, true
+	}
+}
+
 type face [3]*vertex
 
 // TODO: store all in float32 precision
 type vertex struct {
-	Pos    Vec
-	Normal Vec
-	U, V   float64
+	Pos     Vec
+	Normal  Vec
+	U, V, W float64 // local coordinates (UV coordinates, or vertex color)
 }
 
 func (f *face) Inside(Vec) bool { return false }
@@ -358,7 +699,8 @@ func (f *face) Intersect(r *Ray) HitRecord {
 
 	u := v1.U*l1 + v2.U*l2 + v3.U*l3
 	v := v1.V*l1 + v2.V*l2 + v3.V*l3
-	return HitRecord{T: t, Normal: shadingNormal, Local: Vec{u, v, 0}}
+	w := v1.W*l1 + v2.W*l2 + v3.W*l3
+	return HitRecord{T: t, Normal: shadingNormal, Local: Vec{u, v, w}}
 }
 
 func (f *face) Bounds() BoundingBox {
@@ -0,0 +1,54 @@
+package objects
+
+import (
+	"math"
+	"path/filepath"
+
+	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/texture"
+	"github.com/barnex/bruteray/tracer/materials"
+	"github.com/barnex/bruteray/tracer/objects/obj"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// MtlMaterial translates a material from a Wavefront MTL file (see ObjFile) into a Material.
+// Texture files are relative to directory dir.
+//
+// The diffuse color is Kd, or the texture map_Kd if present.
+// Without specular color Ks (or with illumination model 0 or 1), the material is Matte.
+// Else it is a dielectric Microfacet, whose roughness is derived from the specular exponent Ns
+// (0: very rough, 1000: nearly mirror-like).
+//
+// A dissolve d < 1 (or transparency Tr > 0) blends in a Refractive material
+// with index of refraction Ni, e.g. for windows or glasses.
+// If Ni is 1 or less (many exporters write 0 when it is not set), a Transparent one is used instead.
+func MtlMaterial(m *obj.Material, dir string) Material {
+	var color texture.Texture = m.Kd
+	if m.MapKd != "" {
+		color = texture.MustLoad(filepath.Join(dir, m.MapKd))
+	}
+
+	var mat Material
+	if m.Ks == (colorf.Color{}) || m.Illum == 0 || m.Illum == 1 {
+		mat = materials.Matte(color)
+	} else {
+		mat = materials.Microfacet(color, colorf.Gray(mtlRoughness(m.Ns)), colorf.Black)
+	}
+
+	if d := m.D; d < 1 {
+		var transmit Material = materials.Transparent(colorf.White, true)
+		if m.Ni > 1 {
+			transmit = materials.Refractive(m.Ni)
+		}
+		mat = materials.Blend(d, mat, 1-d, transmit)
+	}
+	return mat
+}
+
+// mtlRoughness converts a Phong specular exponent to Microfacet roughness.
+// Using Walter et al.'s equivalence between the Phong exponent and Beckmann width
+// 	α = sqrt(2 / (Ns+2)),
+// and roughness = sqrt(α) (see Microfacet).
+func mtlRoughness(Ns float64) float64 {
+	return math.Pow(2/(math.Max(Ns, 0)+2), 0.25)
+}
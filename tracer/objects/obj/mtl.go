@@ -0,0 +1,113 @@
+package obj
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/barnex/bruteray/imagef/colorf"
+)
+
+// A Material holds the properties of a material in an MTL file.
+// See objects.ObjFile for how they are translated into a tracer.Material.
+type Material struct {
+	Kd    colorf.Color // diffuse color
+	Ks    colorf.Color // specular color
+	Ns    float64      // specular exponent (0..1000)
+	D     float64      // dissolve (opacity): 1 is opaque (default), 0 fully transparent
+	Ni    float64      // index of refraction, default 1
+	Illum int          // illumination model
+	MapKd string       // diffuse texture file (map_Kd), relative to the MTL file, "" if none
+}
+
+// ParseMtlFile reads a material library file, see ParseMtl.
+func ParseMtlFile(fname string) (map[string]*Material, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMtl(f)
+}
+
+// ParseMtl reads a material library in Wavefront MTL format,
+// returning materials by name (newmtl).
+// Statements other than those stored in Material are ignored.
+func ParseMtl(r io.Reader) (m map[string]*Material, e error) {
+	p := &parser{mtl: make(map[string]*Material)}
+	defer func() {
+		if err, ok := recover().(error); ok {
+			m = nil
+			e = p.wrap(err)
+		}
+	}()
+	p.parse(r, p.parseMtlLine)
+	return p.mtl, nil
+}
+
+func (p *parser) parseMtlLine(command string, args []string) {
+	if command == "newmtl" {
+		p.needArgs(args, 1)
+		p.current = &Material{D: 1, Ni: 1}
+		p.mtl[args[0]] = p.current
+		return
+	}
+
+	m := p.current
+	if m == nil {
+		p.errorf("%v before newmtl", command)
+	}
+	switch command {
+	default:
+		// ignore unsupported statements (Ka, Ke, map_Bump, ...)
+	case "Kd":
+		m.Kd = p.parseColor(args)
+	case "Ks":
+		m.Ks = p.parseColor(args)
+	case "Ns":
+		p.needArgs(args, 1)
+		m.Ns = p.parseFloat64(args[0])
+	case "d":
+		// "d -halo factor" is not supported, use the factor
+		p.needLastArg(command, args)
+		m.D = p.parseFloat64(args[len(args)-1])
+	case "Tr":
+		p.needArgs(args, 1)
+		m.D = 1 - p.parseFloat64(args[0])
+	case "Ni":
+		p.needArgs(args, 1)
+		m.Ni = p.parseFloat64(args[0])
+	case "illum":
+		p.needArgs(args, 1)
+		m.Illum = p.parseInt(args[0])
+	case "map_Kd":
+		// options (-s, -o, ...) precede the file name, and are ignored
+		p.needLastArg(command, args)
+		m.MapKd = strings.Replace(args[len(args)-1], "\\", "/", -1)
+	}
+}
+
+// parseColor parses "r g b", or a single value for gray.
+// The "spectral" and "xyz" forms are not supported.
+func (p *parser) parseColor(l []string) colorf.Color {
+	switch len(l) {
+	default:
+		p.errorf("need 1 or 3 color components, got %q", strings.Join(l, " "))
+		panic("unreachable")
+	case 1:
+		return colorf.Gray(p.parseFloat64(l[0]))
+	case 3:
+		return colorf.Color{
+			R: p.parseFloat64(l[0]),
+			G: p.parseFloat64(l[1]),
+			B: p.parseFloat64(l[2]),
+		}
+	}
+}
+
+// needLastArg checks that a statement with optional arguments has at least one argument.
+func (p *parser) needLastArg(command string, l []string) {
+	if len(l) == 0 {
+		p.errorf("%v: missing argument", command)
+	}
+}
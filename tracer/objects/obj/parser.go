@@ -1,8 +1,10 @@
+// Package obj parses Wavefront OBJ files and their MTL material libraries.
 package obj
 
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -14,69 +16,128 @@ import (
 // one package (objects/parsers)
 // standordply.go, wavefrontobj.go
 
+// ParseFile reads an OBJ file, see Parse.
 func ParseFile(fname string) (o Obj, e error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return Obj{}, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads a mesh in Wavefront OBJ format.
+//
+// Vertex positions (v), texture coordinates (vt), normals (vn)
+// and polygonal faces (f) are read, as well as the material names (usemtl),
+// material libraries (mtllib), and object (o) and group (g) names.
+// Negative (relative) indices are resolved. Other statements
+// (e.g. smoothing groups, lines, curves) are ignored.
+func Parse(r io.Reader) (o Obj, e error) {
+	p := &parser{obj: Obj{Faces: make(map[string][]Face)}}
 	defer func() {
 		if err, ok := recover().(error); ok {
 			o = Obj{}
-			e = err
+			e = p.wrap(err)
 		}
 	}()
-	p := &parser{obj: Obj{Faces: make(map[string][][]int32)}}
-	p.parseFile(fname)
+	p.parse(r, p.parseObjLine)
+	p.checkIndices()
 	return p.obj, nil
 }
 
+// Obj holds the contents of an OBJ file.
+// Indices are 0-based (unlike in the file).
 type Obj struct {
-	Vertices []geom.Vec
-	Faces    map[string][][]int32
+	Vertices  []geom.Vec        // vertex positions (v)
+	TexCoords []geom.Vec2       // texture coordinates (vt)
+	Normals   []geom.Vec        // vertex normals (vn)
+	Faces     map[string][]Face // faces per material name (usemtl), "" if no material was set
+	MtlLibs   []string          // material libraries (mtllib), relative to the OBJ file
 }
 
-type parser struct {
-	usemtl string // current material set by usemtl
-	obj    Obj
+// A Face is a polygon with 3 or more corners.
+// Each corner has an index into Obj.Vertices, and optionally
+// into Obj.TexCoords and Obj.Normals (else VT, VN are nil).
+type Face struct {
+	V, VT, VN []int32
+	Object    string // object name (o)
+	Group     string // group name(s) (g)
 }
 
-func (p *parser) parseFile(fname string) {
-	f, err := os.Open(fname)
-	p.check(err)
-	defer f.Close()
-	scanner := bufio.NewScanner(f)
+// Triangles splits the face into triangles (as a fan around the first corner),
+// returning the corner numbers (indices into f.V, f.VT, f.VN) of each triangle.
+// This is exact for convex polygons, which covers nearly all files in practice.
+func (f *Face) Triangles() [][3]int {
+	t := make([][3]int, 0, len(f.V)-2)
+	for i := 1; i+1 < len(f.V); i++ {
+		t = append(t, [3]int{0, i, i + 1})
+	}
+	return t
+}
+
+type parser struct {
+	line    int    // current line number, for error messages
+	usemtl  string // current material set by usemtl
+	object  string // current object set by o
+	group   string // current group set by g
+	obj     Obj
+	mtl     map[string]*Material // materials parsed by ParseMtl
+	current *Material            // current material set by newmtl
+}
 
+// parse calls parseLine for each statement in r,
+// joining lines continued with a backslash.
+func (p *parser) parse(r io.Reader, parseLine func(command string, args []string)) {
+	scanner := bufio.NewScanner(r)
+	var continued string
 	for scanner.Scan() {
-		p.parseLine(scanner.Text())
+		p.line++
+		l := continued + scanner.Text()
+		if strings.HasSuffix(l, "\\") {
+			continued = l[:len(l)-1] + " "
+			continue
+		}
+		continued = ""
+		if i := strings.IndexByte(l, '#'); i >= 0 {
+			l = l[:i]
+		}
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+		parseLine(fields[0], fields[1:])
 	}
 	p.check(scanner.Err())
 }
 
-func (p *parser) parseLine(l string) {
-	fields := strings.Fields(l)
-	if len(fields) == 0 {
-		return
-	}
-
-	command, args := fields[0], fields[1:]
+func (p *parser) parseObjLine(command string, args []string) {
 	switch command {
 	default:
-		p.errorf("line has unrecognized prefix: %q", l)
+		// ignore unsupported statements (s, l, p, curves, ...)
 	case "v":
 		p.parseV(args)
+	case "vt":
+		p.parseVT(args)
+	case "vn":
+		p.parseVN(args)
 	case "f":
 		p.parseF(args)
 	case "usemtl":
 		p.parseUsemtl(args)
-	case "#":
+	case "mtllib":
+		// file names may contain spaces
+		p.obj.MtlLibs = append(p.obj.MtlLibs, strings.Join(args, " "))
 	case "o":
-	case "vn":
-	case "vt":
-	case "s":
-	case "l":
+		p.object = strings.Join(args, " ")
 	case "g":
-	case "mtllib":
+		p.group = strings.Join(args, " ")
 	}
 }
 
 func (p *parser) parseV(l []string) {
-	if !(len(l) == 3 || len(l) == 4) {
+	// x y z, optionally followed by w, or by r g b (a common extension)
+	if !(len(l) >= 3 && len(l) <= 7) {
 		p.errorf("need 3 or 4 vertex coordinates, got %v", len(l))
 	}
 	var v geom.Vec
@@ -88,30 +149,103 @@ func (p *parser) parseV(l []string) {
 	p.obj.Vertices = append(p.obj.Vertices, v)
 }
 
+func (p *parser) parseVT(l []string) {
+	// u, optionally followed by v and w
+	if !(len(l) >= 1 && len(l) <= 3) {
+		p.errorf("need 1 to 3 texture coordinates, got %v", len(l))
+	}
+	var vt geom.Vec2
+	for i := 0; i < len(vt) && i < len(l); i++ {
+		vt[i] = p.parseFloat64(l[i])
+	}
+	p.obj.TexCoords = append(p.obj.TexCoords, vt)
+}
+
+func (p *parser) parseVN(l []string) {
+	p.needArgs(l, 3)
+	var n geom.Vec
+	for i := range n {
+		n[i] = p.parseFloat64(l[i])
+	}
+	p.obj.Normals = append(p.obj.Normals, n)
+}
+
+// parseF parses a face with corners of the form
+// 	v
+// 	v/vt
+// 	v//vn
+// 	v/vt/vn
 func (p *parser) parseF(l []string) {
-	if !(len(l) == 3 || len(l) == 4) {
-		p.errorf("need 3 or 4 face indices, got %v", len(l))
+	if len(l) < 3 {
+		p.errorf("need at least 3 face indices, got %v", len(l))
 	}
-	// TODO: texture indices are ignored
-	f := make([]int32, len(l))
+	f := Face{V: make([]int32, len(l)), Object: p.object, Group: p.group}
 	for i, w := range l {
-
 		words := strings.Split(w, "/")
-		idx := int32(p.parseInt(words[0]))
-		// TODO: also parse texture and normal indices
+		if len(words) > 3 {
+			p.errorf("invalid face index: %q", w)
+		}
+		f.V[i] = p.parseIndex(words[0], len(p.obj.Vertices))
 
-		if idx < 1 {
-			p.errorf("invalid face index: %v", idx)
+		hasVT := len(words) > 1 && words[1] != ""
+		hasVN := len(words) > 2 && words[2] != ""
+		if i == 0 {
+			if hasVT {
+				f.VT = make([]int32, len(l))
+			}
+			if hasVN {
+				f.VN = make([]int32, len(l))
+			}
+		}
+		if hasVT != (f.VT != nil) || hasVN != (f.VN != nil) {
+			p.errorf("inconsistent face indices: %q", strings.Join(l, " "))
+		}
+		if hasVT {
+			f.VT[i] = p.parseIndex(words[1], len(p.obj.TexCoords))
+		}
+		if hasVN {
+			f.VN[i] = p.parseIndex(words[2], len(p.obj.Normals))
 		}
-		f[i] = idx - 1 // 1-based to 0-based indexing
 	}
 	m := p.usemtl
 	p.obj.Faces[m] = append(p.obj.Faces[m], f)
 }
 
+// parseIndex converts a 1-based or negative (relative to the n elements defined so far)
+// index to a 0-based index.
+func (p *parser) parseIndex(x string, n int) int32 {
+	idx := p.parseInt(x)
+	if idx < 0 {
+		idx += n + 1 // -1 refers to the last element
+	}
+	if idx < 1 {
+		p.errorf("invalid face index: %v", x)
+	}
+	return int32(idx - 1) // 1-based to 0-based indexing
+}
+
+// checkIndices checks that all face indices are within range.
+// This is done after parsing, as some files refer to vertices defined later.
+func (p *parser) checkIndices() {
+	p.line = 0 // error is not specific to the last line
+	check := func(idx []int32, n int, what string) {
+		for _, i := range idx {
+			if int(i) >= n {
+				p.errorf("%v index out of range: %v, have %v", what, i+1, n)
+			}
+		}
+	}
+	for _, faces := range p.obj.Faces {
+		for _, f := range faces {
+			check(f.V, len(p.obj.Vertices), "vertex")
+			check(f.VT, len(p.obj.TexCoords), "texture coordinate")
+			check(f.VN, len(p.obj.Normals), "normal")
+		}
+	}
+}
+
 func (p *parser) parseUsemtl(l []string) {
-	p.needArgs(l, 1)
-	p.usemtl = l[0]
+	p.usemtl = strings.Join(l, " ")
 }
 
 func (p *parser) parseFloat32(x string) float32 {
@@ -121,7 +255,7 @@ func (p *parser) parseFloat32(x string) float32 {
 }
 
 func (p *parser) parseFloat64(x string) float64 {
-	v, err := strconv.ParseFloat(x, 32)
+	v, err := strconv.ParseFloat(x, 64)
 	p.check(err)
 	return v
 }
@@ -147,3 +281,11 @@ func (p *parser) check(err error) {
 func (p *parser) errorf(format string, x ...interface{}) {
 	panic(fmt.Errorf(format, x...))
 }
+
+// wrap adds the current line number to a parse error.
+func (p *parser) wrap(err error) error {
+	if p.line == 0 {
+		return err
+	}
+	return fmt.Errorf("line %v: %v", p.line, err)
+}
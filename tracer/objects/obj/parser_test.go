@@ -1,6 +1,12 @@
 package obj
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func ExampleParse() {
 	obj, err := ParseFile("testdata/goph.obj")
@@ -11,5 +17,87 @@ func ExampleParse() {
 	fmt.Println(obj)
 
 	//Output:
-	//{[[0 0.10000000149011612 0.20000000298023224] [1 1.100000023841858 1.2000000476837158] [2 2.0999999046325684 2.200000047683716] [3 3.0999999046325684 3.200000047683716] [4 4.099999904632568 4.199999809265137] [5 5.099999904632568 5.199999809265137] [5 5.099999904632568 5.199999809265137]] map[Body:[[0 1 2] [1 2 3 4]] SkinColor:[[1 2 3 4] [2 3 4 5] [3 4 5]]]}
+	//{[[0 0.1 0.2] [1 1.1 1.2] [2 2.1 2.2] [3 3.1 3.2] [4 4.1 4.2] [5 5.1 5.2] [5 5.1 5.2]] [] [] map[Body:[{[0 1 2] [] [] Body_Sphere.002 } {[1 2 3 4] [] [] Body_Sphere.002 }] SkinColor:[{[1 2 3 4] [] [] Tail_Sphere.015 } {[2 3 4 5] [] [] Tail_Sphere.015 } {[3 4 5] [] [] Foot_R.001_Sphere.014 }]] [gopher.mtl]}
+}
+
+func ExampleParse_cube() {
+	obj, err := ParseFile("testdata/cube.obj")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(obj.MtlLibs, len(obj.Vertices), len(obj.TexCoords), len(obj.Normals))
+	for _, mat := range []string{"Earth", "Red"} {
+		for _, f := range obj.Faces[mat] {
+			fmt.Println(mat, f.Group, f.V, f.VT, f.VN, f.Triangles())
+		}
+	}
+
+	//Output:
+	//[cube.mtl] 8 4 6
+	//Earth sides [4 5 6 7] [0 1 2 3] [0 0 0 0] [[0 1 2] [0 2 3]]
+	//Earth sides [5 1 2 6] [0 1 2 3] [1 1 1 1] [[0 1 2] [0 2 3]]
+	//Earth sides [1 0 3 2] [0 1 2 3] [2 2 2 2] [[0 1 2] [0 2 3]]
+	//Earth sides [0 4 7 3] [0 1 2 3] [3 3 3 3] [[0 1 2] [0 2 3]]
+	//Red caps [7 6 2 3] [] [4 4 4 4] [[0 1 2] [0 2 3]]
+	//Red caps [0 1 5 4] [] [5 5 5 5] [[0 1 2] [0 2 3]]
+}
+
+func ExampleParseMtl() {
+	mtl, err := ParseMtlFile("testdata/cube.mtl")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%+v\n", *mtl["Earth"])
+	fmt.Printf("%+v\n", *mtl["Red"])
+
+	//Output:
+	//{Kd:{R:0.8 G:0.8 B:0.8} Ks:{R:0.5 G:0.5 B:0.5} Ns:250 D:1 Ni:1 Illum:2 MapKd:../../../../assets/earth.jpg}
+	//{Kd:{R:0.8 G:0.1 B:0.1} Ks:{R:0 G:0 B:0} Ns:0 D:0.75 Ni:1.5 Illum:1 MapKd:}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, c := range []struct {
+		obj, err string
+	}{
+		{"v 1 2\n", "line 1: need 3 or 4 vertex coordinates, got 2"},
+		{"v 1 2 3\nf 1 2\n", "line 2: need at least 3 face indices, got 2"},
+		{"v 1 2 3\nf 1 -2 1\n", "line 2: invalid face index: -2"},
+		{"v 1 2 3\nf 1 0 1\n", "line 2: invalid face index: 0"},
+		{"v 1 2 3\nvt 0 0\nf 1/1 1 1\n", `line 3: inconsistent face indices: "1/1 1 1"`},
+		{"v 1 2 3\nf 1 1 2\n", "vertex index out of range: 2, have 1"},
+		{"v 1 2 3\nf 1//1 1//1 1//1\n", "normal index out of range: 1, have 0"},
+	} {
+		_, err := Parse(strings.NewReader(c.obj))
+		if err == nil || err.Error() != c.err {
+			t.Errorf("%q: got error %v, want %v", c.obj, err, c.err)
+		}
+	}
+}
+
+// A written file parses back to the original, except for object and group names.
+func TestWrite(t *testing.T) {
+	want, err := ParseFile("testdata/cube.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Vertices[0][0] = 1. / 3 // needs full precision
+	for _, faces := range want.Faces {
+		for i := range faces {
+			faces[i].Object, faces[i].Group = "", ""
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, &want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
 }
@@ -0,0 +1,62 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Write writes o in Wavefront OBJ format, which Parse reads back.
+// Coordinates are written with full precision.
+// Faces are grouped by material (usemtl), in alphabetical order.
+// Object and group names are not written.
+func Write(w io.Writer, o *Obj) error {
+	b := bufio.NewWriter(w)
+	for _, lib := range o.MtlLibs {
+		fmt.Fprintln(b, "mtllib", lib)
+	}
+	for _, v := range o.Vertices {
+		fmt.Fprintln(b, "v", ftoa(v[0]), ftoa(v[1]), ftoa(v[2]))
+	}
+	for _, vt := range o.TexCoords {
+		fmt.Fprintln(b, "vt", ftoa(vt[0]), ftoa(vt[1]))
+	}
+	for _, vn := range o.Normals {
+		fmt.Fprintln(b, "vn", ftoa(vn[0]), ftoa(vn[1]), ftoa(vn[2]))
+	}
+
+	names := make([]string, 0, len(o.Faces))
+	for name := range o.Faces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name != "" {
+			fmt.Fprintln(b, "usemtl", name)
+		}
+		for _, f := range o.Faces[name] {
+			b.WriteString("f")
+			for c := range f.V {
+				// 1-based indices: v, v/vt, v//vn or v/vt/vn
+				fmt.Fprintf(b, " %v", f.V[c]+1)
+				switch {
+				case f.VT != nil && f.VN != nil:
+					fmt.Fprintf(b, "/%v/%v", f.VT[c]+1, f.VN[c]+1)
+				case f.VT != nil:
+					fmt.Fprintf(b, "/%v", f.VT[c]+1)
+				case f.VN != nil:
+					fmt.Fprintf(b, "//%v", f.VN[c]+1)
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.Flush()
+}
+
+// ftoa formats x with the minimal number of digits that parse back exactly.
+func ftoa(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
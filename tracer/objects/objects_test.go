@@ -1,13 +1,23 @@
 package objects
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/texture"
 	"github.com/barnex/bruteray/tracer/cameras"
+	"github.com/barnex/bruteray/tracer/materials"
+	"github.com/barnex/bruteray/tracer/objects/obj"
+	"github.com/barnex/bruteray/tracer/objects/ply"
 	"github.com/barnex/bruteray/tracer/test"
 	. "github.com/barnex/bruteray/tracer/types"
 	"github.com/barnex/bruteray/util"
@@ -395,6 +405,144 @@ func BenchmarkMesh_Teapot(b *testing.B) {
 	)
 }
 
+// Like BenchmarkMesh_Teapot, but with the tree built by median split
+// rather than the Surface Area Heuristic, for comparison.
+func BenchmarkMesh_Teapot_Median(b *testing.B) {
+	test.Benchmark(b,
+		NewScene(
+			1,
+			[]Light{},
+			plyFileWithSplit(SplitMedian, test.Normal, "../../assets/teapot.ply",
+				geom.Scale(O, 0.25), geom.Rotate(O, Ex, -90*Deg), geom.Rotate(O, Ey, -20*Deg)),
+		),
+		cameras.Projective(fov).Translate(Vec{0, 1.2, 3.5}),
+		test.DefaultTolerance,
+	)
+}
+
+func BenchmarkMesh_Dragon(b *testing.B) {
+	benchmarkMeshDragon(b, SplitSAH)
+}
+
+func BenchmarkMesh_Dragon_Median(b *testing.B) {
+	benchmarkMeshDragon(b, SplitMedian)
+}
+
+func benchmarkMeshDragon(b *testing.B, split SplitMethod) {
+	test.BenchmarkGolden(b, "objects.benchmarkmesh_dragon",
+		NewScene(
+			1,
+			[]Light{},
+			plyFileWithSplit(split, test.Normal, "../../assets/dragon_res4.ply",
+				geom.Scale(O, 8), geom.Translate(Vec{0, -0.5, 0})),
+		),
+		cameras.Projective(fov).Translate(Vec{0, 0.2, 1.8}),
+		test.DefaultTolerance,
+	)
+}
+
+// A binary PLY file with normals and vertex colors, rendered with its own colors.
+func TestPlyFile_VertexColors(t *testing.T) {
+	test.QuadView(t,
+		NewScene(
+			1,
+			[]Light{
+				test.PointLight(Vec{2, 3, 4}),
+			},
+			PlyFile(nil, "ply/testdata/sphere_binary.ply",
+				geom.Rotate(O, Ey, 10*Deg)),
+			test.Sheet(test.Checkers2, -0.5),
+		),
+		cameras.Projective(fov).Translate(Vec{0, 1.5, 3.5}),
+		1,
+		test.DefaultTolerance,
+	)
+}
+
+// An OBJ file with texture coordinates, normals and an MTL file:
+// the sides are textured with map_Kd, the red caps are partially transparent.
+// Face normals from the file give sharp edges.
+func TestObjFile(t *testing.T) {
+	test.QuadView(t,
+		NewScene(
+			3,
+			[]Light{
+				test.PointLight(Vec{2, 3, 4}),
+			},
+			ObjFile(nil, "obj/testdata/cube.obj",
+				geom.Rotate(O, Ey, -30*Deg), geom.Translate(Vec{0, 0.5, 0})),
+			test.Sheet(test.Checkers2, 0),
+		),
+		cameras.Projective(fov).Translate(Vec{0, 1.5, 2.5}),
+		8,
+		test.DefaultTolerance,
+	)
+}
+
+// Normals must remain perpendicular to the surface under a non-uniform scale.
+func TestTransformNormals(t *testing.T) {
+	// the plane x + y = 0, stretched along x, becomes x + 2y = 0
+	n := []Vec{Vec{1, 1, 0}.Normalized()}
+	transformNormals(&geom.AffineTransform{A: geom.Matrix{{2, 0, 0}, {0, 1, 0}, {0, 0, 1}}}, n)
+	if want := (Vec{1, 2, 0}).Normalized(); n[0].Sub(want).Len() > 1e-9 {
+		t.Errorf("got %v, want %v", n[0], want)
+	}
+}
+
+// An MTL dissolve with Ni <= 1 (e.g. 0, as written by many exporters) means no refraction.
+func TestMtlMaterial_Ni(t *testing.T) {
+	for _, ni := range []float64{0, 1} {
+		m := MtlMaterial(&obj.Material{Kd: colorf.White, D: 0.5, Ni: ni}, ".")
+		desc, err := json.Marshal(describe.NewEncoder(".", "test").Describe(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(desc); !strings.Contains(got, `"transparent"`) || strings.Contains(got, `"refractive"`) {
+			t.Errorf("Ni=%v: got %v, want a transparent material", ni, got)
+		}
+	}
+}
+
+// Vertex colors must be saved as colors, also if they have no blue component.
+func TestMeshWithAttributes_DescribeColors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bruteray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	vertices := []Vec{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}}
+	colors := []Color{colorf.Red, colorf.Green, {R: 1, G: 1, B: 0}}
+	m := MeshWithAttributes(materials.Matte(texture.VertexColor), vertices, [][3]int{{0, 1, 2}}, VertexAttributes{Colors: colors})
+	e := describe.NewEncoder(dir, "test")
+	e.Describe(m)
+	if err := e.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.ply"))
+	if len(files) != 1 {
+		t.Fatalf("got files %v, want one PLY file", files)
+	}
+	mesh, err := ply.ParseMeshFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mesh.Colors) != len(vertices) || mesh.UV != nil {
+		t.Errorf("got %v colors and %v UV coordinates, want %v colors", len(mesh.Colors), len(mesh.UV), len(vertices))
+	}
+}
+
+// plyFileWithSplit is like PlyFile, but allows to choose how the tree is built.
+func plyFileWithSplit(split SplitMethod, m Material, file string, transf ...*geom.AffineTransform) Interface {
+	v, f, err := ply.ParseFile(file)
+	if err != nil {
+		panic(err)
+	}
+	applyTransform(geom.ComposeLR(transf...), v)
+	return meshWithSplit(m, makeFaces(v, f, nil), split)
+}
+
 func TestSphere(t *testing.T) {
 	test.QuadView(t,
 		NewScene(
@@ -605,17 +753,20 @@ func BenchmarkTransformed_Optimize(b *testing.B) {
 
 // Test Tree against golden image obtained without tree
 // (slow but certain).
+// The split method must not change the image.
 func TestTree(t *testing.T) {
-	test.QuadView(t,
-		NewScene(
-			1,
-			[]Light{},
-			Tree(randomSpheres(300, 0.3)...),
-		),
-		cameras.Projective(fov).Translate(Vec{0, 0, 2.5}),
-		5,
-		2e-5,
-	)
+	for _, split := range []SplitMethod{SplitMedian, SplitSAH} {
+		test.QuadView(t,
+			NewScene(
+				1,
+				[]Light{},
+				TreeWithSplit(split, DefaultLeafSize, randomSpheres(300, 0.3)...),
+			),
+			cameras.Projective(fov).Translate(Vec{0, 0, 2.5}),
+			5,
+			2e-5,
+		)
+	}
 }
 
 func TestTree_Bounds(t *testing.T) {
@@ -665,6 +816,31 @@ func BenchmarkTree1000(b *testing.B) {
 	)
 }
 
+func BenchmarkTree1000_SAH(b *testing.B) {
+	test.BenchmarkGolden(b, "objects.benchmarktree1000",
+		NewScene(
+			1,
+			[]Light{},
+			TreeWithSplit(SplitSAH, DefaultLeafSize, randomSpheres(1000, 0.1)...),
+		),
+		cameras.Projective(fov).Translate(Vec{0, 0, 2.5}),
+		test.DefaultTolerance,
+	)
+}
+
+// Like BenchmarkTree1000_SAH, but with a single object per leaf.
+func BenchmarkTree1000_SAH_Leaf1(b *testing.B) {
+	test.BenchmarkGolden(b, "objects.benchmarktree1000",
+		NewScene(
+			1,
+			[]Light{},
+			TreeWithSplit(SplitSAH, 1, randomSpheres(1000, 0.1)...),
+		),
+		cameras.Projective(fov).Translate(Vec{0, 0, 2.5}),
+		test.DefaultTolerance,
+	)
+}
+
 func randomSpheres(N int, r float64) []Interface {
 	rng := rand.New(rand.NewSource(123))
 	rnd := func() float64 {
@@ -1,107 +1,403 @@
+// Package ply parses meshes in the Stanford PLY format (ASCII and binary).
 package ply
 
 import (
 	"bufio"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/barnex/bruteray/geom"
+	"github.com/barnex/bruteray/imagef/colorf"
 )
 
+// A Mesh holds the contents of a PLY file.
+// The optional per-vertex attributes are nil if not present in the file.
+type Mesh struct {
+	Vertices []geom.Vec     // vertex positions (x, y, z)
+	Normals  []geom.Vec     // vertex normals (nx, ny, nz)
+	UV       []geom.Vec2    // texture coordinates (u, v or s, t)
+	Colors   []colorf.Color // vertex colors (red, green, blue), converted from sRGB to linear
+	Faces    [][3]int       // vertex indices of triangles, polygons are split into triangles
+}
+
+// ParseFile reads the vertex positions and faces of a PLY file, see ParseMesh.
 func ParseFile(fname string) ([]geom.Vec, [][3]int, error) {
-	f, err := os.Open(fname)
+	m, err := ParseMeshFile(fname)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer f.Close()
-	return Parse(f)
+	return m.Vertices, m.Faces, nil
 }
 
+// Parse reads the vertex positions and faces of a PLY file, see ParseMesh.
 func Parse(r io.Reader) (vertices []geom.Vec, faces [][3]int, e error) {
+	m, err := ParseMesh(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m.Vertices, m.Faces, nil
+}
+
+// ParseMeshFile reads a PLY file, see ParseMesh.
+func ParseMeshFile(fname string) (*Mesh, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMesh(f)
+}
+
+// ParseMesh reads a mesh in PLY format: ASCII, binary little endian or binary big endian.
+// Properties may have any PLY type. Vertex positions, normals, texture coordinates and colors
+// are read from the "vertex" element, vertex indices from the "face" element.
+// Other elements and properties are skipped.
+//
+// Integer colors are scaled to 0..1 (e.g. uchar colors are divided by 255),
+// floating point colors are assumed to be in the range 0..1 already.
+func ParseMesh(r io.Reader) (m *Mesh, e error) {
 	defer func() {
 		if p := recover(); p != nil {
+			m = nil
 			e = errors.New(fmt.Sprint(p))
-			p = nil
 		}
 	}()
 
 	parser := parser{b: bufio.NewReader(r)}
-	v, f := parser.parse()
-	return v, f, nil
+	return parser.parse(), nil
+}
+
+// scalar types
+const (
+	int8T = iota
+	uint8T
+	int16T
+	uint16T
+	int32T
+	uint32T
+	float32T
+	float64T
+)
+
+var types = map[string]int{
+	"char": int8T, "int8": int8T,
+	"uchar": uint8T, "uint8": uint8T,
+	"short": int16T, "int16": int16T,
+	"ushort": uint16T, "uint16": uint16T,
+	"int": int32T, "int32": int32T,
+	"uint": uint32T, "uint32": uint32T,
+	"float": float32T, "float32": float32T,
+	"double": float64T, "float64": float64T,
 }
 
-func (p *parser) parse() ([]geom.Vec, [][3]int) {
+// maxValue is used to scale integer colors to 0..1.
+var maxValue = [...]float64{
+	int8T: math.MaxInt8, uint8T: math.MaxUint8,
+	int16T: math.MaxInt16, uint16T: math.MaxUint16,
+	int32T: math.MaxInt32, uint32T: math.MaxUint32,
+	float32T: 1, float64T: 1,
+}
+
+type element struct {
+	name  string
+	count int
+	props []property
+}
+
+type property struct {
+	name      string
+	typ       int
+	list      bool
+	countType int // type of the list length, if list
+}
+
+func (p *parser) parse() *Mesh {
 	if magic := p.readLine(); magic != "ply" {
 		p.panicf("bad header: %q", magic)
 	}
-	if format := p.readLine(); format != "format ascii 1.0" {
-		p.panicf("bad header: %q", format)
-	}
 
-	var numVertex, numFace int
+	var elements []*element
 	for l := p.readLine(); l != "end_header"; l = p.readLine() {
-		switch {
-		case strings.HasPrefix(l, "element vertex "):
-			numVertex = p.atoi(l[len("element vertex "):])
-		case strings.HasPrefix(l, "element face "):
-			numFace = p.atoi(l[len("element face "):])
-		case l == "end_header":
-			break
+		fields := strings.Fields(l)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "format":
+			p.parseFormat(fields[1:])
+		case "element":
+			if len(fields) != 3 {
+				p.panicf("bad element")
+			}
+			elements = append(elements, &element{name: fields[1], count: p.atoi(fields[2])})
+		case "property":
+			if len(elements) == 0 {
+				p.panicf("property before element")
+			}
+			e := elements[len(elements)-1]
+			e.props = append(e.props, p.parseProperty(fields[1:]))
+		case "comment", "obj_info":
+		default:
+			p.panicf("bad header")
 		}
 	}
+	if p.read == nil {
+		p.panicf("missing format")
+	}
 
-	vertex := make([]geom.Vec, numVertex)
-	for i := 0; i < numVertex; i++ {
-		fields := strings.Fields(p.readLine())
-		for c := 0; c < 3; c++ {
-			vertex[i][c] = p.atof(fields[c])
+	m := &Mesh{}
+	for _, e := range elements {
+		switch e.name {
+		case "vertex":
+			p.parseVertices(m, e)
+		case "face":
+			p.parseFaces(m, e)
+		default:
+			for i := 0; i < e.count; i++ {
+				p.skip(e)
+			}
 		}
 	}
+	for _, f := range m.Faces {
+		for _, idx := range f {
+			if idx < 0 || idx >= len(m.Vertices) {
+				p.panicf("vertex index out of range: %v, have %v vertices", idx, len(m.Vertices))
+			}
+		}
+	}
+	return m
+}
 
-	faces := make([][3]int, 0, numFace)
-	for i := 0; i < numFace; i++ {
-		fields := strings.Fields(p.readLine())
+func (p *parser) parseFormat(args []string) {
+	if len(args) != 2 || args[1] != "1.0" {
+		p.panicf("bad format")
+	}
+	switch args[0] {
+	default:
+		p.panicf("bad format")
+	case "ascii":
+		p.read = p.readASCII
+	case "binary_little_endian":
+		p.order = binary.LittleEndian
+		p.read = p.readBinary
+	case "binary_big_endian":
+		p.order = binary.BigEndian
+		p.read = p.readBinary
+	}
+}
 
-		numV := p.atoi(fields[0])
-		if !(numV == 3 || numV == 4) {
-			p.panicf("need 3 or 4 vertices, have: %v", numV)
+func (p *parser) parseProperty(args []string) property {
+	typ := func(name string) int {
+		t, ok := types[name]
+		if !ok {
+			p.panicf("unknown type: %q", name)
 		}
+		return t
+	}
+	switch {
+	case len(args) == 2:
+		return property{name: args[1], typ: typ(args[0])}
+	case len(args) == 4 && args[0] == "list":
+		return property{name: args[3], typ: typ(args[2]), list: true, countType: typ(args[1])}
+	default:
+		p.panicf("bad property")
+		panic("unreachable")
+	}
+}
 
-		var f [3]int
-		for c := 0; c < 3; c++ {
-			idx := p.atoi(fields[c+1])
-			f[c] = idx
+// vertex properties, by destination
+var (
+	posNames    = [][]string{{"x"}, {"y"}, {"z"}}
+	normalNames = [][]string{{"nx"}, {"ny"}, {"nz"}}
+	uvNames     = [][]string{{"u", "s", "texture_u", "texture_s"}, {"v", "t", "texture_v", "texture_t"}}
+	colorNames  = [][]string{{"red", "diffuse_red", "r"}, {"green", "diffuse_green", "g"}, {"blue", "diffuse_blue", "b"}}
+)
+
+func (p *parser) parseVertices(m *Mesh, e *element) {
+	// find the index of each vertex attribute's components in the element's properties,
+	// -1 if not present
+	find := func(names [][]string) []int {
+		idx := make([]int, len(names))
+		for c, names := range names {
+			idx[c] = -1
+			for i, prop := range e.props {
+				for _, n := range names {
+					if prop.name == n && !prop.list {
+						idx[c] = i
+					}
+				}
+			}
+			if idx[c] == -1 {
+				return nil
+			}
+		}
+		return idx
+	}
+	pos, normal, uv, color := find(posNames), find(normalNames), find(uvNames), find(colorNames)
+	if pos == nil {
+		p.panicf("vertex has no x, y, z")
+	}
+
+	m.Vertices = make([]geom.Vec, e.count)
+	if normal != nil {
+		m.Normals = make([]geom.Vec, e.count)
+	}
+	if uv != nil {
+		m.UV = make([]geom.Vec2, e.count)
+	}
+	if color != nil {
+		m.Colors = make([]colorf.Color, e.count)
+	}
+
+	values := make([]float64, len(e.props))
+	for i := 0; i < e.count; i++ {
+		for j, prop := range e.props {
+			if prop.list {
+				p.skipList(prop)
+				continue
+			}
+			values[j] = p.read(prop.typ)
+		}
+		for c := range pos {
+			m.Vertices[i][c] = values[pos[c]]
 		}
-		faces = append(faces, f)
-
-		if numV == 4 {
-			faces = append(faces, [3]int{
-				p.atoi(fields[3]),
-				p.atoi(fields[4]),
-				p.atoi(fields[1]),
-			})
+		for c := range normal {
+			m.Normals[i][c] = values[normal[c]]
 		}
+		for c := range uv {
+			m.UV[i][c] = values[uv[c]]
+		}
+		if color != nil {
+			col := [3]float64{}
+			for c := range col {
+				col[c] = colorf.SRGBToLinear(values[color[c]] / maxValue[e.props[color[c]].typ])
+			}
+			m.Colors[i] = colorf.Color{R: col[0], G: col[1], B: col[2]}
+		}
+	}
+}
 
+func (p *parser) parseFaces(m *Mesh, e *element) {
+	indices := -1
+	for i, prop := range e.props {
+		if prop.list && (prop.name == "vertex_indices" || prop.name == "vertex_index") {
+			indices = i
+		}
+	}
+	if indices == -1 {
+		p.panicf("face has no vertex_indices")
+	}
+
+	m.Faces = make([][3]int, 0, e.count)
+	var poly []int
+	for i := 0; i < e.count; i++ {
+		for j, prop := range e.props {
+			if j != indices {
+				p.skipProperty(prop)
+				continue
+			}
+			n := int(p.read(prop.countType))
+			if n < 3 {
+				p.panicf("need at least 3 vertices, have: %v", n)
+			}
+			poly = poly[:0]
+			for k := 0; k < n; k++ {
+				poly = append(poly, int(p.read(prop.typ)))
+			}
+			// split polygon into a fan of triangles
+			for k := 1; k+1 < n; k++ {
+				m.Faces = append(m.Faces, [3]int{poly[0], poly[k], poly[k+1]})
+			}
+		}
+	}
+}
+
+// skip skips one instance of element e.
+func (p *parser) skip(e *element) {
+	for _, prop := range e.props {
+		p.skipProperty(prop)
+	}
+}
+
+func (p *parser) skipProperty(prop property) {
+	if prop.list {
+		p.skipList(prop)
+	} else {
+		p.read(prop.typ)
+	}
+}
+
+func (p *parser) skipList(prop property) {
+	n := int(p.read(prop.countType))
+	for k := 0; k < n; k++ {
+		p.read(prop.typ)
 	}
-	return vertex, faces
 }
 
 type parser struct {
 	b        *bufio.Reader
 	lastLine string
+	read     func(typ int) float64 // reads the next value (ASCII or binary)
+	order    binary.ByteOrder      // byte order of binary formats
+	fields   []string              // remaining values on the current line, for ASCII
+	buf      [8]byte
 }
 
 func (p *parser) readLine() string {
 	line, err := p.b.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil // last line without newline
+	}
 	p.check(err)
 	p.lastLine = line
 	return strings.TrimSpace(line)
 }
 
+// readASCII reads the next number, which may be on the next line.
+func (p *parser) readASCII(typ int) float64 {
+	for len(p.fields) == 0 {
+		p.fields = strings.Fields(p.readLine())
+	}
+	f := p.fields[0]
+	p.fields = p.fields[1:]
+	if typ >= float32T {
+		return p.atof(f)
+	}
+	return float64(p.atoi(f))
+}
+
+func (p *parser) readBinary(typ int) float64 {
+	size := [...]int{int8T: 1, uint8T: 1, int16T: 2, uint16T: 2, int32T: 4, uint32T: 4, float32T: 4, float64T: 8}[typ]
+	b := p.buf[:size]
+	if _, err := io.ReadFull(p.b, b); err != nil {
+		p.panicf("read: %v", err)
+	}
+	switch typ {
+	case int8T:
+		return float64(int8(b[0]))
+	case uint8T:
+		return float64(b[0])
+	case int16T:
+		return float64(int16(p.order.Uint16(b)))
+	case uint16T:
+		return float64(p.order.Uint16(b))
+	case int32T:
+		return float64(int32(p.order.Uint32(b)))
+	case uint32T:
+		return float64(p.order.Uint32(b))
+	case float32T:
+		return float64(math.Float32frombits(p.order.Uint32(b)))
+	default:
+		return math.Float64frombits(p.order.Uint64(b))
+	}
+}
+
 func (p *parser) check(e error) {
 	if e != nil {
 		p.panicf("readline: %v", e)
@@ -0,0 +1,177 @@
+package ply
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const asciiQuad = `ply
+format ascii 1.0
+comment a quad and a triangle
+element vertex 5
+property float x
+property float y
+property float z
+property float nx
+property float ny
+property float nz
+property float s
+property float t
+property uchar red
+property uchar green
+property uchar blue
+element face 2
+property list uchar int vertex_indices
+end_header
+0 0 0 0 0 1 0 0 255 0 0
+1 0 0 0 0 1 1 0 0 255 0
+1 1 0 0 0 1 1 1 0 0 255
+0 1 0 0 0 1 0 1 255 255 255
+2 2 0 0 0 1 0.5 0.5 0 0 0
+4 0 1 2 3
+3 1 4 2
+`
+
+func TestParseMesh_ASCII(t *testing.T) {
+	m, err := ParseMesh(strings.NewReader(asciiQuad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.Faces, [][3]int{{0, 1, 2}, {0, 2, 3}, {1, 4, 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("faces: got %v, want %v", got, want)
+	}
+	if got, want := m.Vertices[2], [3]float64{1, 1, 0}; got != want {
+		t.Errorf("vertex: got %v, want %v", got, want)
+	}
+	if got, want := m.Normals[4], [3]float64{0, 0, 1}; got != want {
+		t.Errorf("normal: got %v, want %v", got, want)
+	}
+	if got, want := m.UV[4], [2]float64{0.5, 0.5}; got != want {
+		t.Errorf("uv: got %v, want %v", got, want)
+	}
+	if got := m.Colors[1]; got.R != 0 || got.G != 1 || got.B != 0 {
+		t.Errorf("color: got %v, want {0 1 0}", got)
+	}
+}
+
+// The binary test file must parse like its ASCII equivalent,
+// in either byte order.
+func TestParseMesh_Binary(t *testing.T) {
+	m, err := ParseMeshFile("testdata/sphere_binary.ply")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Vertices) != 13*24 || len(m.Faces) != 2*24+2*10*24 || m.UV != nil {
+		t.Fatalf("got %v vertices, %v faces, %v UVs", len(m.Vertices), len(m.Faces), len(m.UV))
+	}
+	for i, p := range m.Vertices {
+		n := m.Normals[i]
+		if math.Abs(p[0]-n[0]/2) > 1e-6 || math.Abs(p[1]-n[1]/2) > 1e-6 {
+			t.Fatalf("vertex %v: position %v does not match normal %v", i, p, n)
+		}
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		var buf bytes.Buffer
+		buf.WriteString(strings.Replace(asciiQuad[:strings.Index(asciiQuad, "end_header")],
+			"format ascii 1.0", "format "+formatName(order)+" 1.0", 1))
+		buf.WriteString("end_header\n")
+		type vertex struct {
+			XYZ, N [3]float32
+			ST     [2]float32
+			RGB    [3]uint8
+		}
+		for _, v := range []vertex{
+			{[3]float32{0, 0, 0}, [3]float32{0, 0, 1}, [2]float32{0, 0}, [3]uint8{255, 0, 0}},
+			{[3]float32{1, 0, 0}, [3]float32{0, 0, 1}, [2]float32{1, 0}, [3]uint8{0, 255, 0}},
+			{[3]float32{1, 1, 0}, [3]float32{0, 0, 1}, [2]float32{1, 1}, [3]uint8{0, 0, 255}},
+			{[3]float32{0, 1, 0}, [3]float32{0, 0, 1}, [2]float32{0, 1}, [3]uint8{255, 255, 255}},
+			{[3]float32{2, 2, 0}, [3]float32{0, 0, 1}, [2]float32{0.5, 0.5}, [3]uint8{0, 0, 0}},
+		} {
+			binary.Write(&buf, order, v)
+		}
+		binary.Write(&buf, order, struct {
+			N          uint8
+			A, B, C, D int32
+			M          uint8
+			E, F, G    int32
+		}{4, 0, 1, 2, 3, 3, 1, 4, 2})
+
+		m, err := ParseMesh(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := ParseMesh(strings.NewReader(asciiQuad))
+		if !reflect.DeepEqual(m.Vertices, want.Vertices) || !reflect.DeepEqual(m.Faces, want.Faces) ||
+			!reflect.DeepEqual(m.Normals, want.Normals) || !reflect.DeepEqual(m.UV, want.UV) ||
+			!reflect.DeepEqual(m.Colors, want.Colors) {
+			t.Errorf("%v: got %v, want %v", order, m, want)
+		}
+	}
+}
+
+func formatName(order binary.ByteOrder) string {
+	if order == binary.BigEndian {
+		return "binary_big_endian"
+	}
+	return "binary_little_endian"
+}
+
+// Written meshes are parsed back exactly, colors up to round-off.
+func TestWrite(t *testing.T) {
+	want, err := ParseMesh(strings.NewReader(asciiQuad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Colors[4].R = 2 // colors outside 0..1 are not clipped
+
+	var buf bytes.Buffer
+	if err := Write(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseMesh(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Vertices, want.Vertices) || !reflect.DeepEqual(got.Faces, want.Faces) ||
+		!reflect.DeepEqual(got.Normals, want.Normals) || !reflect.DeepEqual(got.UV, want.UV) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for i, c := range got.Colors {
+		w := want.Colors[i]
+		if math.Abs(c.R-w.R)+math.Abs(c.G-w.G)+math.Abs(c.B-w.B) > 1e-12 {
+			t.Errorf("color %v: got %v, want %v", i, c, w)
+		}
+	}
+
+	// optional attributes are not written if absent
+	buf.Reset()
+	if err := Write(&buf, &Mesh{Vertices: want.Vertices, Faces: want.Faces}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ParseMesh(&buf); err != nil || got.Normals != nil || got.UV != nil || got.Colors != nil {
+		t.Errorf("got %v, %v", got, err)
+	}
+
+	if err := Write(&buf, &Mesh{Vertices: want.Vertices, Faces: [][3]int{{0, 1, 5}}}); err == nil {
+		t.Errorf("expected error for bad index")
+	}
+}
+
+func TestParseMesh_Errors(t *testing.T) {
+	for _, ply := range []string{
+		"ply\nformat binary_middle_endian 1.0\nend_header\n",
+		"ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nproperty float y\nend_header\n0 0\n",
+		"ply\nformat ascii 1.0\nelement vertex 1\nproperty half x\nend_header\n",
+		"ply\nformat ascii 1.0\nelement vertex 1\nproperty float x\nproperty float y\nproperty float z\n" +
+			"element face 1\nproperty list uchar int vertex_indices\nend_header\n0 0 0\n3 0 1 2\n",
+	} {
+		if _, err := ParseMesh(strings.NewReader(ply)); err == nil {
+			t.Errorf("%q: expected error", ply)
+		}
+	}
+}
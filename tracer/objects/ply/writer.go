@@ -0,0 +1,83 @@
+package ply
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Write writes a mesh in binary little endian PLY format, which ParseMesh reads back.
+// Coordinates, normals and texture coordinates are stored in double precision.
+// Colors are stored as doubles in sRGB (like 8-bit colors, which ParseMesh converts to linear).
+// Optional attributes (normals, UV, colors) are written if not nil.
+func Write(w io.Writer, m *Mesh) error {
+	n := len(m.Vertices)
+	for _, a := range []int{len(m.Normals), len(m.UV), len(m.Colors)} {
+		if a != 0 && a != n {
+			return fmt.Errorf("ply: have %v vertices but %v attributes", n, a)
+		}
+	}
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "ply\nformat binary_little_endian 1.0\nelement vertex %v\n", n)
+	props := func(names ...string) {
+		for _, name := range names {
+			fmt.Fprintf(b, "property double %v\n", name)
+		}
+	}
+	props("x", "y", "z")
+	if m.Normals != nil {
+		props("nx", "ny", "nz")
+	}
+	if m.UV != nil {
+		props("u", "v")
+	}
+	if m.Colors != nil {
+		props("red", "green", "blue")
+	}
+	fmt.Fprintf(b, "element face %v\nproperty list uchar int vertex_indices\nend_header\n", len(m.Faces))
+
+	var buf [8]byte
+	double := func(x ...float64) {
+		for _, x := range x {
+			binary.LittleEndian.PutUint64(buf[:], math.Float64bits(x))
+			b.Write(buf[:8])
+		}
+	}
+	for i, v := range m.Vertices {
+		double(v[0], v[1], v[2])
+		if m.Normals != nil {
+			n := m.Normals[i]
+			double(n[0], n[1], n[2])
+		}
+		if m.UV != nil {
+			double(m.UV[i][0], m.UV[i][1])
+		}
+		if m.Colors != nil {
+			c := m.Colors[i]
+			double(toSRGB(c.R), toSRGB(c.G), toSRGB(c.B))
+		}
+	}
+	for _, f := range m.Faces {
+		b.WriteByte(3)
+		for _, idx := range f {
+			if idx < 0 || idx >= n {
+				return fmt.Errorf("ply: vertex index out of range: %v", idx)
+			}
+			binary.LittleEndian.PutUint32(buf[:], uint32(idx))
+			b.Write(buf[:4])
+		}
+	}
+	return b.Flush()
+}
+
+// toSRGB is the exact inverse of colorf.SRGBToLinear, as used by ParseMesh,
+// without clipping, so that colors survive a round trip.
+func toSRGB(c float64) float64 {
+	if c <= 0.04045/12.92 {
+		return 12.92 * c
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
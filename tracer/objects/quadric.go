@@ -3,6 +3,7 @@ package objects
 import (
 	"math"
 
+	"github.com/barnex/bruteray/describe"
 	. "github.com/barnex/bruteray/tracer/types"
 )
 
@@ -144,3 +145,34 @@ func mul3(a, b Vec) Vec {
 		a[Z] * b[Z],
 	}
 }
+
+// Materials implements tracer.MaterialObject.
+func (q *quadric) Materials() []Material {
+	return []Material{q.mat}
+}
+
+// Describe implements describe.Describer.
+// Quadrics are described as the sphere or cylinder they were constructed as.
+func (q *quadric) Describe(e *describe.Encoder) interface{} {
+	n := describe.Node{
+		"material": describeMaterial(e, q.mat),
+		"diam":     2 * math.Sqrt(q.b),
+		"center":   q.origin,
+	}
+	if q.a == (Vec{1, 1, 1}) {
+		n["type"] = "sphere"
+		return n
+	}
+	for dir, axis := range []string{"x", "y", "z"} {
+		a := Vec{1, 1, 1}
+		a[dir] = 0
+		if q.a == a {
+			n["type"] = "cylinder"
+			n["axis"] = axis
+			n["height"] = 2 * (q.bounds.Max[dir] - Tiny - q.origin[dir])
+			return n
+		}
+	}
+	e.Errorf("cannot describe quadric with coefficients %v", q.a)
+	return nil
+}
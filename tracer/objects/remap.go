@@ -24,3 +24,8 @@ func (o *remapped) Inside(v Vec) bool {
 func (o *remapped) Bounds() BoundingBox {
 	return o.orig.Bounds()
 }
+
+// Materials implements tracer.MaterialObject.
+func (o *remapped) Materials() []Material {
+	return MaterialsOf(o.orig)
+}
@@ -0,0 +1,150 @@
+package objects
+
+import (
+	"math"
+
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// Parameters for the binned Surface Area Heuristic.
+// Costs are relative to the cost of intersecting a single object.
+const (
+	sahNumBins       = 16
+	sahTraversalCost = 1. / 8.
+	sahIntersectCost = 1.
+)
+
+// splitSAH divides the objects ch, with bounding box bb, into two groups
+// so that the expected cost of intersecting a random ray is minimal.
+//
+// The expected cost of a split is estimated by the Surface Area Heuristic:
+// the probability that a random ray hitting the parent box also hits a child box
+// is proportional to the child's surface area. To limit the build time,
+// candidate split planes are restricted to the borders of a fixed number of bins
+// along each axis (http://www.sci.utah.edu/~wald/Publications/2007/ParallelBVHBuild/fastbuild.pdf).
+//
+// axis is the direction along which the objects were separated.
+// ok is false if the heuristic deems a leaf node cheaper than any split.
+// This is only allowed for up to leafSize objects.
+func splitSAH(ch []Interface, bb BoundingBox, leafSize int) (left, right []Interface, axis int, ok bool) {
+	area := bb.surfaceArea()
+	if math.IsInf(area, 0) || math.IsNaN(area) || area == 0 {
+		// Infinite objects (e.g. Backdrop) or degenerate (e.g. all in one point):
+		// the heuristic is meaningless.
+		return splitSAHFallback(ch, bb, leafSize)
+	}
+
+	centroids := make([]Vec, len(ch))
+	for i, c := range ch {
+		centroids[i] = c.Bounds().Center()
+	}
+	cbb := boundingBoxFromHull(centroids)
+
+	bestCost := inf
+	bestAxis := -1
+	bestBin := -1
+	for axis := 0; axis < 3; axis++ {
+		if cbb.Max[axis] == cbb.Min[axis] {
+			continue // all centroids in the same plane: cannot separate along this axis.
+		}
+		cost, bin := sahBestBin(ch, centroids, cbb, axis)
+		if cost < bestCost {
+			bestCost, bestAxis, bestBin = cost, axis, bin
+		}
+	}
+
+	if bestAxis == -1 {
+		return splitSAHFallback(ch, bb, leafSize)
+	}
+
+	leafCost := sahIntersectCost * float64(len(ch))
+	bestCost = sahTraversalCost + bestCost/area
+	if len(ch) <= leafSize && bestCost >= leafCost {
+		return nil, nil, 0, false
+	}
+
+	// Partition in-place: objects in bins <= bestBin go left.
+	i := 0
+	for j := range ch {
+		if sahBin(centroids[j], cbb, bestAxis) <= bestBin {
+			ch[i], ch[j] = ch[j], ch[i]
+			centroids[i], centroids[j] = centroids[j], centroids[i]
+			i++
+		}
+	}
+	return ch[:i], ch[i:], bestAxis, true
+}
+
+// sahBestBin returns the unnormalized cost of the optimal split along axis,
+// and the last bin index that goes to the left of it.
+// The cost still needs to be divided by the parent's surface area.
+func sahBestBin(ch []Interface, centroids []Vec, cbb BoundingBox, axis int) (cost float64, bin int) {
+	var (
+		count  [sahNumBins]int
+		bounds [sahNumBins]BoundingBox
+	)
+	for i := range bounds {
+		bounds[i] = emptyBox
+	}
+	for i, c := range ch {
+		b := sahBin(centroids[i], cbb, axis)
+		count[b]++
+		bounds[b] = bounds[b].union(c.Bounds())
+	}
+
+	// Sweep from the right, recording the area and count of all bins right of each split plane.
+	var (
+		rightArea  [sahNumBins]float64
+		rightCount [sahNumBins]int
+	)
+	acc := emptyBox
+	n := 0
+	for i := sahNumBins - 1; i > 0; i-- {
+		acc = acc.union(bounds[i])
+		n += count[i]
+		rightArea[i] = acc.surfaceArea()
+		rightCount[i] = n
+	}
+
+	// Sweep from the left, evaluating the cost of splitting after bin i.
+	cost = inf
+	bin = -1
+	acc = emptyBox
+	n = 0
+	for i := 0; i < sahNumBins-1; i++ {
+		acc = acc.union(bounds[i])
+		n += count[i]
+		if n == 0 || rightCount[i+1] == 0 {
+			continue // not a split
+		}
+		c := sahIntersectCost * (acc.surfaceArea()*float64(n) + rightArea[i+1]*float64(rightCount[i+1]))
+		if c < cost {
+			cost, bin = c, i
+		}
+	}
+	return cost, bin
+}
+
+// sahBin returns the index of the bin along axis where centroid c belongs.
+// cbb is the bounding box of all centroids.
+func sahBin(c Vec, cbb BoundingBox, axis int) int {
+	extent := cbb.Max[axis] - cbb.Min[axis]
+	b := int(sahNumBins * (c[axis] - cbb.Min[axis]) / extent)
+	if b >= sahNumBins {
+		b = sahNumBins - 1
+	}
+	if b < 0 {
+		b = 0
+	}
+	return b
+}
+
+// splitSAHFallback is used when the Surface Area Heuristic cannot be evaluated.
+// It stops when leafSize allows so, or otherwise reverts to a median split.
+func splitSAHFallback(ch []Interface, bb BoundingBox, leafSize int) (left, right []Interface, axis int, ok bool) {
+	if len(ch) <= leafSize {
+		return nil, nil, 0, false
+	}
+	left, right, axis = splitMedian(ch, bb)
+	return left, right, axis, true
+}
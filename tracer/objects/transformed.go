@@ -1,6 +1,9 @@
 package objects
 
 import (
+	"math"
+
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	. "github.com/barnex/bruteray/tracer/types"
 )
@@ -62,7 +65,22 @@ func (o *transformed) Inside(p Vec) bool {
 	return o.orig.Inside(o.inverse.TransformPoint(p))
 }
 
+// Materials implements tracer.MaterialObject.
+func (o *transformed) Materials() []Material {
+	return MaterialsOf(o.orig)
+}
+
+// Describe implements describe.Describer.
+func (o *transformed) Describe(e *describe.Encoder) interface{} {
+	return describe.WithTransform(e.Describe(o.orig), &o.forward)
+}
+
 func transformBounds(orig BoundingBox, t *geom.AffineTransform) BoundingBox {
+	for i := range orig.Min {
+		if math.IsInf(orig.Min[i], 0) || math.IsInf(orig.Max[i], 0) {
+			return infBox // e.g. Backdrop, transforming would yield NaNs
+		}
+	}
 	h := orig.hull()
 	for i := range h {
 		h[i] = t.TransformPoint(h[i])
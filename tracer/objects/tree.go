@@ -1,45 +1,151 @@
 package objects
 
 import (
+	"fmt"
 	"sort"
 
+	"github.com/barnex/bruteray/describe"
 	"github.com/barnex/bruteray/geom"
 	. "github.com/barnex/bruteray/tracer/types"
 	"github.com/barnex/bruteray/util"
 )
 
-const maxFacePerLeaf = 7
+// DefaultLeafSize is the maximum number of objects stored in a Tree's leaf node,
+// unless specified otherwise via TreeWithSplit.
+const DefaultLeafSize = 7
+
+// A SplitMethod determines how a Tree divides its objects over two child nodes.
+type SplitMethod int
+
+const (
+	// SplitMedian divides along the longest dimension of the bounding box,
+	// and always cuts right in the middle (half of the objects go to either side).
+	// Building is fast, but the resulting tree may be far from optimal
+	// when objects are unevenly distributed or vary in size.
+	SplitMedian SplitMethod = iota
+
+	// SplitSAH divides according to the binned Surface Area Heuristic,
+	// which minimizes the expected cost of intersecting a random ray with the tree.
+	// Building is slower, but intersection is typically significantly faster,
+	// especially for large, irregular meshes like 3D scans.
+	// See http://www.pbr-book.org/3ed-2018/Primitives_and_Intersection_Acceleration/Bounding_Volume_Hierarchies.html#TheSurfaceAreaHeuristic
+	SplitSAH
+)
 
 // Tree returns a Bounding Volume Hierarchy containing the given objects,
 // which as an efficient Intersect method.
+//
+// The objects are divided using SplitMedian, with at most DefaultLeafSize objects per leaf.
+// Use TreeWithSplit for control over how the tree is built.
 func Tree(objects ...Interface) Interface {
+	return TreeWithSplit(SplitMedian, DefaultLeafSize, objects...)
+}
+
+// TreeWithSplit is like Tree, but uses the given method to divide objects over child nodes,
+// and stores at most leafSize objects in each leaf node.
+//
+// With SplitSAH, leafSize is an upper bound: leafs may be smaller
+// when the heuristic deems further splitting worthwhile.
+func TreeWithSplit(split SplitMethod, leafSize int, objects ...Interface) Interface {
+	if leafSize < 1 {
+		panic(fmt.Sprintf("objects: TreeWithSplit: invalid leaf size: %v", leafSize))
+	}
+	b := &treeBuilder{split: split, leafSize: leafSize}
+	b.build(objects)
 	return &tree{
-		root: buildTree(objects),
+		nodes: b.nodes,
+		leafs: b.leafs,
 	}
 }
 
+// tree is a Bounding Volume Hierarchy, stored as a flat list of nodes in depth-first order.
+// This layout is compact and cache-friendly, and avoids recursion during traversal.
+//
+// The root node is at index 0.
+// The first child of an inner node immediately follows its parent,
+// the second child is found at index node.offset:
+//
+// 	index:   0   1   2   3   4
+// 	node:  root  A  A.0 A.1  B     (root.offset = 4, A.offset = 3)
+//
+// The objects of all leafs are stored contiguously in leafs.
 type tree struct {
-	root node
+	nodes []node
+	leafs []Interface
 }
 
 type node struct {
 	boundingBox boundingBoxf
-	children    *[2]node
-	leafs       []Interface
+	offset      int32 // inner node: index of second child. leaf node: index of first object in tree.leafs
+	count       int32 // inner node: 0. leaf node: number of objects
+	axis        uint8 // axis along which the children were split, determines traversal order.
 }
 
-// TODO: Currently we divide along the longest dimension
-// and always cut right in the middle.
-// This should be replaced by the Surface Area Heuristic.
-func buildTree(ch []Interface) node {
-	if len(ch) <= maxFacePerLeaf {
-		return node{
-			leafs:       ch,
-			boundingBox: boundingBoxToF(makeBoundingBox(ch)),
-		}
+func (n *node) isLeaf() bool {
+	return n.count != 0
+}
+
+// treeBuilder recursively constructs a tree's nodes.
+type treeBuilder struct {
+	split    SplitMethod
+	leafSize int
+	nodes    []node
+	leafs    []Interface
+}
+
+// build adds a node containing the objects ch (and, recursively, its children),
+// returning its index.
+// The order of ch is modified in the process.
+func (b *treeBuilder) build(ch []Interface) int32 {
+	if len(ch) <= 1 {
+		return b.leaf(ch)
 	}
 
 	bb := makeBoundingBox(ch)
+
+	var left, right []Interface
+	var axis int
+	switch b.split {
+	default:
+		panic(fmt.Sprintf("objects: Tree: invalid SplitMethod: %v", b.split))
+	case SplitMedian:
+		if len(ch) <= b.leafSize {
+			return b.leaf(ch)
+		}
+		left, right, axis = splitMedian(ch, bb)
+	case SplitSAH:
+		var ok bool
+		left, right, axis, ok = splitSAH(ch, bb, b.leafSize)
+		if !ok {
+			return b.leaf(ch)
+		}
+	}
+
+	i := b.add(node{boundingBox: boundingBoxToF(bb), axis: uint8(axis)})
+	b.build(left) // becomes node i+1
+	second := b.build(right)
+	b.nodes[i].offset = second
+	return i
+}
+
+func (b *treeBuilder) leaf(ch []Interface) int32 {
+	i := b.add(node{
+		boundingBox: boundingBoxToF(makeBoundingBox(ch)),
+		offset:      int32(len(b.leafs)),
+		count:       int32(len(ch)),
+	})
+	b.leafs = append(b.leafs, ch...)
+	return i
+}
+
+func (b *treeBuilder) add(n node) int32 {
+	b.nodes = append(b.nodes, n)
+	return int32(len(b.nodes) - 1)
+}
+
+// splitMedian divides along the longest dimension of bounding box bb,
+// right in the middle.
+func splitMedian(ch []Interface, bb BoundingBox) (left, right []Interface, axis int) {
 	bbSize := bb.Max.Sub(bb.Min)
 	splitDir := argMax(bbSize)
 	sort.Slice(ch, func(i, j int) bool {
@@ -48,34 +154,72 @@ func buildTree(ch []Interface) node {
 		return bi.Min[splitDir]+bi.Max[splitDir] < bj.Min[splitDir]+bj.Max[splitDir]
 	})
 	N := len(ch)
-	left := ch[:N/2]
-	right := ch[N/2:]
-	return node{
-		children:    &[2]node{buildTree(left), buildTree(right)},
-		boundingBox: boundingBoxToF(bb),
-	}
+	return ch[:N/2], ch[N/2:], splitDir
 }
 
+// stackEntry is a node waiting to be visited during tree traversal,
+// with the distance where the ray enters its bounding box.
+type stackEntry struct {
+	node  int32
+	enter float64
+}
+
+// Intersect traverses the tree front-to-back: of two children,
+// the one nearest to the ray start (along the split axis) is visited first.
+// Nodes whose bounding box is entered beyond the frontmost hit found so far
+// can then be skipped without intersecting their contents.
 func (t *tree) Intersect(r *Ray) HitRecord {
-	if intersectAABBf(&t.root.boundingBox, r) <= 0 { // TODO: and ray Len
+	ri := makeRayInv(r)
+
+	enter, exit := ri.intersect(&t.nodes[0].boundingBox)
+	if !(exit > 0) { // TODO: and ray Len
 		return HitRecord{}
 	}
-	return t.root.Intersect(r)
-}
 
-func (t *tree) Inside(p Vec) bool {
-	return t.root.Inside(p)
-}
+	// Typical depths are ~20 for a million objects,
+	// so the stack rarely grows beyond this buffer.
+	var buf [64]stackEntry
+	stack := append(buf[:0], stackEntry{0, enter})
+
+	front := HitRecord{T: inf}
+	for len(stack) != 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if e.enter > front.T {
+			continue // a hit in front of this node was found already
+		}
 
-func (t *node) Inside(p Vec) bool {
-	if t.children != nil {
-		if t.children[0].Inside(p) {
-			return true
+		n := &t.nodes[e.node]
+		if n.isLeaf() {
+			for _, o := range t.leafs[n.offset : n.offset+n.count] {
+				frag := o.Intersect(r)
+				if frag.T > 0 && frag.T < front.T {
+					front = frag
+				}
+			}
+			continue
 		}
-		if t.children[1].Inside(p) {
-			return true
+
+		near, far := e.node+1, n.offset
+		if ri.negative[n.axis] {
+			near, far = far, near
+		}
+		// push far first so that near is visited first.
+		if enter, exit := ri.intersect(&t.nodes[far].boundingBox); exit > 0 && enter < front.T {
+			stack = append(stack, stackEntry{far, enter})
 		}
+		if enter, exit := ri.intersect(&t.nodes[near].boundingBox); exit > 0 && enter < front.T {
+			stack = append(stack, stackEntry{near, enter})
+		}
+	}
+
+	if front.T == inf {
+		return HitRecord{}
 	}
+	return front
+}
+
+func (t *tree) Inside(p Vec) bool {
 	for _, l := range t.leafs {
 		if l.Inside(p) {
 			return true
@@ -84,45 +228,15 @@ func (t *node) Inside(p Vec) bool {
 	return false
 }
 
-func (n *node) Intersect(r *Ray) HitRecord {
-	// TODO: use tracer.FrontSolution
-	front := HitRecord{T: 9e99}
-	if n.children == nil {
-		for _, o := range n.leafs {
-			frag := o.Intersect(r)
-			if frag.T > 0 && frag.T < front.T {
-				front = frag
-			}
-		}
-		return front
-	}
-
-	ch0, ch1 := &(n.children[0]), &(n.children[1])
-	t0 := intersectAABBf(&ch0.boundingBox, r)
-	t1 := intersectAABBf(&ch1.boundingBox, r)
-
-	//if t1 < t0 {
-	//	ch0, ch1 = ch1, ch0
-	//	t0, t1 = t1, t0
-	//}
-
-	if t0 > 0 {
-		frag := ch0.Intersect(r)
-		if frag.T > 0 { //&& frag.T < front.T {
-			front = frag
-		}
-	}
-	if t1 > 0 { //&& !(t1 > front.T+0*Tiny) {
-		frag := ch1.Intersect(r)
-		if frag.T > 0 && frag.T < front.T {
-			front = frag
-		}
-	}
+// Materials implements tracer.MaterialObject.
+func (t *tree) Materials() []Material {
+	return materialsOf(t.leafs...)
+}
 
-	if front.T == 9e99 {
-		front.T = 0
-	}
-	return front
+// Describe implements describe.Describer.
+// Only the objects are described, the tree is rebuilt when the description is loaded.
+func (t *tree) Describe(e *describe.Encoder) interface{} {
+	return describe.Node{"type": "tree", "objects": describeAll(e, t.leafs...)}
 }
 
 func intersectAABB(s *BoundingBox, r *Ray) float64 {
@@ -174,7 +288,7 @@ func makeBoundingBox(children []Interface) BoundingBox {
 }
 
 func (n *tree) Bounds() BoundingBox {
-	return n.root.boundingBox.to64()
+	return n.nodes[0].boundingBox.to64()
 }
 
 type boundingBoxf struct {
@@ -211,28 +325,34 @@ func toVecf(a [3]float32) Vec {
 	}
 }
 
-func intersectAABBf(s *boundingBoxf, r *Ray) float64 {
-	idirx := 1 / r.Dir[X]
-	idiry := 1 / r.Dir[Y]
-	idirz := 1 / r.Dir[Z]
-
-	startx := r.Start[X]
-	starty := r.Start[Y]
-	startz := r.Start[Z]
+// rayInv caches the inverse direction of a Ray,
+// to speed up repeated intersection tests with bounding boxes.
+type rayInv struct {
+	start    [3]float64
+	invDir   [3]float64
+	negative [3]bool // direction component is negative
+}
 
-	minx := float64(s.Min[X])
-	miny := float64(s.Min[Y])
-	minz := float64(s.Min[Z])
-	maxx := float64(s.Max[X])
-	maxy := float64(s.Max[Y])
-	maxz := float64(s.Max[Z])
+func makeRayInv(r *Ray) rayInv {
+	var ri rayInv
+	for i := range ri.start {
+		ri.start[i] = r.Start[i]
+		ri.invDir[i] = 1 / r.Dir[i]
+		ri.negative[i] = r.Dir[i] < 0
+	}
+	return ri
+}
 
-	tminx := (minx - startx) * idirx
-	tmaxx := (maxx - startx) * idirx
-	tminy := (miny - starty) * idiry
-	tmaxy := (maxy - starty) * idiry
-	tminz := (minz - startz) * idirz
-	tmaxz := (maxz - startz) * idirz
+// intersect returns the distances where the ray enters and exits bounding box s,
+// like intersectAABB2. On a miss, 0, 0 is returned.
+// A distance is negative if the corresponding intersection lies behind the ray start.
+func (ri *rayInv) intersect(s *boundingBoxf) (enter, exit float64) {
+	tminx := (float64(s.Min[X]) - ri.start[X]) * ri.invDir[X]
+	tmaxx := (float64(s.Max[X]) - ri.start[X]) * ri.invDir[X]
+	tminy := (float64(s.Min[Y]) - ri.start[Y]) * ri.invDir[Y]
+	tmaxy := (float64(s.Max[Y]) - ri.start[Y]) * ri.invDir[Y]
+	tminz := (float64(s.Min[Z]) - ri.start[Z]) * ri.invDir[Z]
+	tmaxz := (float64(s.Max[Z]) - ri.start[Z]) * ri.invDir[Z]
 
 	txen := util.Min(tminx, tmaxx)
 	txex := util.Max(tminx, tmaxx)
@@ -244,12 +364,9 @@ func intersectAABBf(s *boundingBoxf, r *Ray) float64 {
 	tex := min3(txex, tyex, tzex)
 
 	if ten > tex {
-		return 0
-	}
-	if ten < 0 {
-		return tex
+		return 0, 0
 	}
-	return ten
+	return ten, tex
 }
 
 // TODO: move to isosurface
@@ -1,6 +1,7 @@
 package tracer
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"runtime"
@@ -27,7 +28,10 @@ type Sampler struct {
 	antiAlias bool
 	//	placement func(*Sampler)int??
 
-	Stats Stats
+	statsMu sync.Mutex
+	stats   Stats
+
+	aovs []aovChannel // see EnableAOV
 	//Convergence []struct{samples int, error float64}
 }
 
@@ -41,17 +45,32 @@ func NewSampler(f ImageFunc, w, h int, antiAlias bool) *Sampler {
 	}
 }
 
+// Sample adds nPass samples to each pixel.
 func (s *Sampler) Sample(nPass int) {
-	s.SampleWithCancel(nPass, make(chan struct{}))
+	s.SampleContext(context.Background(), nPass)
+}
+
+// SampleContext is like Sample, but stops early when c is cancelled,
+// in which case c.Err() is returned.
+//
+// Cancellation is checked between pixels: each pixel receives either
+// all nPass samples, or none at all. Hence, after cancellation
+// the image accumulated so far remains consistent,
+// and can still be retrieved with Image. PassCount reports
+// how many passes each pixel actually completed.
+func (s *Sampler) SampleContext(c context.Context, nPass int) error {
+	return s.sample(c, nPass, nil)
 }
 
-// TODO: cancellation
-func (s *Sampler) SampleWithCancel(nPass int, _ chan struct{}) {
+// sample adds nPass samples to each pixel, until c is cancelled.
+// If passes is not nil, it overrides nPass per pixel (0: pixel is skipped).
+func (s *Sampler) sample(c context.Context, nPass int, passes [][]int) error {
 	start := time.Now()
 
 	w, h := s.imageSize()
 	const tileSize = 16
 	work := tessellate(w, h, tileSize)
+	done := c.Done()
 
 	var wg sync.WaitGroup
 	for i := 0; i < runtime.NumCPU(); i++ {
@@ -59,23 +78,62 @@ func (s *Sampler) SampleWithCancel(nPass int, _ chan struct{}) {
 		go func() {
 			defer wg.Done()
 			ctx := NewCtx(w * h)
+			s.initCtx(ctx)
+			defer s.addStats(&ctx.Stats)
 			for t := range work {
-				s.sampleTile(ctx, t, nPass)
+				if !s.sampleTile(ctx, t, nPass, passes, done) {
+					return
+				}
 			}
 		}()
 	}
 	wg.Wait()
 
-	s.Stats.WallTime += time.Since(start)
-	//s.Stats.Add(&ctx.Stats)
+	s.addStats(&Stats{WallTime: time.Since(start)})
+	return c.Err()
+}
+
+// Stats returns the performance counters accumulated over all passes so far.
+// It is safe to call concurrently with Sample.
+func (s *Sampler) Stats() Stats {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.stats
+}
+
+// SamplesPerPixel returns the average number of samples per pixel
+// accumulated so far.
+func (s *Sampler) SamplesPerPixel() float64 {
+	w, h := s.imageSize()
+	st := s.Stats()
+	return float64(st.NumSamples) / float64(w*h)
+}
+
+func (s *Sampler) addStats(b *Stats) {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	s.stats.Add(b)
 }
 
-func (s *Sampler) sampleTile(ctx *Ctx, t tile, nPass int) {
+// sampleTile adds nPass samples (or passes[iy][ix], unless nil) to all pixels in tile t,
+// unless cancel is closed first, in which case false is returned.
+func (s *Sampler) sampleTile(ctx *Ctx, t tile, nPass int, passes [][]int, cancel <-chan struct{}) bool {
 	for iy := t.y0; iy < t.y1; iy++ {
 		for ix := t.x0; ix < t.x1; ix++ {
-			s.samplePixel(ctx, ix, iy, nPass)
+			if isCanceled(cancel) {
+				return false
+			}
+			n := nPass
+			if passes != nil {
+				n = passes[iy][ix]
+			}
+			if n == 0 {
+				continue
+			}
+			s.samplePixel(ctx, ix, iy, n)
 		}
 	}
+	return true
 }
 
 func (s *Sampler) samplePixel(ctx *Ctx, ix, iy, n int) {
@@ -97,11 +155,17 @@ func (s *Sampler) samplePixel(ctx *Ctx, ix, iy, n int) {
 		}
 
 		c := s.f(ctx, x, y)
+		ctx.Stats.NumSamples++
 		if !c.IsNaN() {
 			s.sum[iy][ix] = s.sum[iy][ix].Add(c)
 			s.sumSq[iy][ix].R += c.R * c.R
 			s.sumSq[iy][ix].G += c.G * c.G
 			s.sumSq[iy][ix].B += c.B * c.B
+			if ctx.aov.wanted {
+				s.addAOVs(ix, iy, c, &ctx.aov)
+			}
+		} else {
+			ctx.Stats.NumNaN++
 		}
 	}
 }
@@ -143,7 +207,7 @@ func min(a, b int) int {
 	return b
 }
 
-func isCanceled(c chan struct{}) bool {
+func isCanceled(c <-chan struct{}) bool {
 	select {
 	case <-c:
 		return true
@@ -184,6 +248,22 @@ func (s *Sampler) StdDev() Image {
 	return s.memoize(s.stddevf)
 }
 
+// StdErr returns an image whose pixel values are the standard error
+// of the pixel values in Image. I.e., the expected noise amplitude.
+// Pixels with less than two samples have infinite error.
+func (s *Sampler) StdErr() Image {
+	return s.memoize(s.stdErrf)
+}
+
+func (s *Sampler) stdErrf(ix, iy int) Color {
+	n := float64(s.n[iy][ix])
+	if n < 2 {
+		inf := math.Inf(1)
+		return Color{inf, inf, inf}
+	}
+	return s.stddevf(ix, iy).Mul(1 / math.Sqrt(n))
+}
+
 // memoize turns an image function into stored image.
 func (s *Sampler) memoize(f func(ix, iy int) Color) Image {
 	w, h := s.imageSize()
@@ -196,8 +276,26 @@ func (s *Sampler) memoize(f func(ix, iy int) Color) Image {
 	return img
 }
 
+// PassCount returns, for each pixel, the number of passes
+// currently accumulated. Normally, all pixels have the same count,
+// unless sampling was cancelled prematurely (see SampleContext).
+func (s *Sampler) PassCount() [][]int {
+	w, h := s.imageSize()
+	n := makeInt2D(w, h)
+	for iy := range n {
+		copy(n[iy], s.n[iy])
+	}
+	return n
+}
+
+// imagef returns the average of the samples of pixel ix, iy.
+// Pixels that have not been sampled yet are black.
 func (s *Sampler) imagef(ix, iy int) Color {
-	return s.sum[iy][ix].Mul(1 / float64(s.n[iy][ix]))
+	n := s.n[iy][ix]
+	if n == 0 {
+		return Color{}
+	}
+	return s.sum[iy][ix].Mul(1 / float64(n))
 }
 
 func (s *Sampler) stddevf(ix, iy int) Color {
@@ -213,6 +311,9 @@ func (s *Sampler) variancef(ix, iy int) Color {
 	sumSq := s.sumSq[iy][ix]
 	n := float64(s.n[iy][ix])
 	var v Color
+	if n < 2 {
+		return v // not enough samples to estimate
+	}
 	d := 1 / (n * (n - 1))
 	v.R = (n*sumSq.R - util.Sqr(sum.R)) * d
 	v.G = (n*sumSq.G - util.Sqr(sum.G)) * d
@@ -2,11 +2,14 @@ package tracer_test
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/gob"
 	"math"
 	"math/rand"
 	"os"
 	"path"
+	"sync/atomic"
 	"testing"
 
 	"github.com/barnex/bruteray/imagef"
@@ -32,6 +35,306 @@ func TestSampler_StdDev(t *testing.T) {
 	test.Compare(t, 0.06, s.StdDev())
 }
 
+// Cancelling must stop sampling early, while keeping the accumulated image consistent:
+// every pixel has either all passes, or none.
+func TestSampler_Cancel(t *testing.T) {
+	const w, h, nPass = 64, 48, 4
+	c, cancel := context.WithCancel(context.Background())
+	var count int64
+	f := func(ctx *Ctx, u, v float64) Color {
+		if atomic.AddInt64(&count, 1) == w*h*nPass/2 {
+			cancel()
+		}
+		return Color{1, 1, 1}
+	}
+
+	s := tracer.NewSampler(f, w, h, false)
+	if err := s.SampleContext(c, nPass); err != context.Canceled {
+		t.Errorf("SampleContext: got error %v, want %v", err, context.Canceled)
+	}
+
+	numDone := 0
+	img := s.Image()
+	for iy, row := range s.PassCount() {
+		for ix, n := range row {
+			switch n {
+			default:
+				t.Fatalf("pixel %v,%v: got %v passes, want 0 or %v", ix, iy, n, nPass)
+			case 0:
+				if img[iy][ix] != (Color{}) {
+					t.Fatalf("pixel %v,%v: got %v, want black", ix, iy, img[iy][ix])
+				}
+			case nPass:
+				numDone++
+				if img[iy][ix] != (Color{1, 1, 1}) {
+					t.Fatalf("pixel %v,%v: got %v, want white", ix, iy, img[iy][ix])
+				}
+			}
+		}
+	}
+	if numDone == 0 || numDone == w*h {
+		t.Errorf("got %v pixels done, want partial image", numDone)
+	}
+}
+
+// SampleAdaptive must spend extra passes only on noisy pixels:
+// here, the right half of the image.
+func TestSampler_Adaptive(t *testing.T) {
+	const w, h, maxPasses = 32, 16, 64
+	f := func(ctx *Ctx, u, v float64) Color {
+		if u < 0.5 {
+			return Color{0.5, 0.5, 0.5}
+		}
+		return colorf.Gray(rand.Float64())
+	}
+
+	// nPass = 5 does not divide maxPasses: the last batch must be clamped.
+	for _, nPass := range []int{1, 5} {
+		s := tracer.NewSampler(f, w, h, false)
+		for {
+			n, err := s.SampleAdaptive(context.Background(), nPass, 1./256., maxPasses)
+			test.Check(t, err)
+			if n == 0 {
+				break
+			}
+		}
+
+		n := s.PassCount()
+		for iy := 0; iy < h; iy++ {
+			if got, want := n[iy][0], nPass*divUp(tracer.AdaptiveMinPasses, nPass); got != want {
+				t.Errorf("nPass %v: pixel %v,%v: got %v passes, want %v", nPass, 0, iy, got, want)
+			}
+			if got, want := n[iy][w-1], maxPasses; got != want {
+				t.Errorf("nPass %v: pixel %v,%v: got %v passes, want %v", nPass, w-1, iy, got, want)
+			}
+		}
+
+		sampling := s.SamplingImage()
+		if got, want := sampling[0][w-1], colorf.White; got != want {
+			t.Errorf("SamplingImage: got %v, want %v", got, want)
+		}
+	}
+}
+
+func divUp(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// Resuming from a checkpoint must yield exactly the same image
+// as rendering without interruption.
+func TestSampler_Checkpoint(t *testing.T) {
+	f := cornelli().ImageFunc(
+		cameras.Projective(70 * Deg).Translate(Vec{.250, .250001, 0.97}),
+	)
+	const w, h = 32, 24
+
+	want := tracer.NewSampler(f, w, h, true)
+	test.Check(t, want.EnableAOV(tracer.AOVDepth, tracer.AOVObject))
+	want.Sample(5)
+
+	interrupted := tracer.NewSampler(f, w, h, true)
+	test.Check(t, interrupted.EnableAOV(tracer.AOVDepth, tracer.AOVObject))
+	interrupted.Sample(2)
+	var buf bytes.Buffer
+	test.Check(t, interrupted.WriteCheckpoint(&buf))
+
+	resumed := tracer.NewSampler(f, w, h, true)
+	test.Check(t, resumed.EnableAOV(tracer.AOVDepth, tracer.AOVObject))
+	test.Check(t, resumed.ReadCheckpoint(&buf))
+	resumed.Sample(3)
+
+	for _, img := range []struct {
+		name      string
+		got, want imagef.Image
+	}{
+		{"image", resumed.Image(), want.Image()},
+		{"depth", resumed.AOV(tracer.AOVDepth), want.AOV(tracer.AOVDepth)},
+		{"object", resumed.AOV(tracer.AOVObject), want.AOV(tracer.AOVObject)},
+	} {
+		for iy := range img.got {
+			for ix := range img.got[iy] {
+				if got, want := img.got[iy][ix], img.want[iy][ix]; got != want {
+					t.Fatalf("%v: pixel %v,%v: got %v, want %v", img.name, ix, iy, got, want)
+				}
+			}
+		}
+	}
+	if got, want := resumed.Stats().NumSamples, want.Stats().NumSamples; got != want {
+		t.Errorf("NumSamples: got %v, want %v", got, want)
+	}
+
+	test.Check(t, interrupted.WriteCheckpoint(&buf))
+	if err := tracer.NewSampler(f, w+1, h, true).ReadCheckpoint(&buf); err == nil {
+		t.Errorf("ReadCheckpoint: image size mismatch: expected error")
+	}
+}
+
+// Features must record the first surface hit in each pixel.
+func TestSampler_Features(t *testing.T) {
+	f := cornelli().ImageFunc(
+		cameras.Projective(70 * Deg).Translate(Vec{.250, .250001, 0.97}),
+	)
+	const w, h = 32, 24
+	s := tracer.NewSampler(f, w, h, false)
+	s.EnableFeatures()
+	s.Sample(2)
+
+	albedo, normal, depth := s.Albedo(), s.Normal(), s.Depth()
+	// All walls are white.EV(-1), the light is white.
+	// Rays escaping through the open front of the box have zero features.
+	wantAlbedo := Color{1, 1, 1}.EV(-1)
+	for iy := 0; iy < h; iy++ {
+		for ix := 0; ix < w; ix++ {
+			a, n, d := albedo[iy][ix], normal[iy][ix], depth[iy][ix].R
+			if a == (Color{}) {
+				if n != (Color{}) || d != 0 {
+					t.Fatalf("pixel %v,%v: miss: got normal %v, depth %v, want zero", ix, iy, n, d)
+				}
+				continue
+			}
+			if a != wantAlbedo && a != (Color{1, 1, 1}) {
+				t.Fatalf("pixel %v,%v: albedo: got %v, want %v", ix, iy, a, wantAlbedo)
+			}
+			if l := math.Sqrt(n.R*n.R + n.G*n.G + n.B*n.B); math.Abs(l-1) > 1e-6 {
+				t.Fatalf("pixel %v,%v: normal: got length %v, want 1", ix, iy, l)
+			}
+			if !(d > 0 && d < 2) {
+				t.Fatalf("pixel %v,%v: depth: got %v", ix, iy, d)
+			}
+		}
+	}
+	// the sphere, seen in the center, faces the camera.
+	if n := normal[h/2][w/2]; !(n.B > 0) {
+		t.Errorf("center normal: got %v, want facing the camera", n)
+	}
+}
+
+func TestSampler_AOV(t *testing.T) {
+	f := cornelli().ImageFunc(
+		cameras.Projective(70 * Deg).Translate(Vec{.250, .250001, 0.97}),
+	)
+	const w, h = 32, 24
+	s := tracer.NewSampler(f, w, h, false)
+	test.Check(t, s.EnableAOV(tracer.AOVDirect, tracer.AOVIndirect, tracer.AOVLight(0), tracer.AOVObject, tracer.AOVMaterial))
+	if err := s.EnableAOV("bogus"); err == nil {
+		t.Errorf("EnableAOV(bogus): expected error")
+	}
+	s.Sample(2)
+
+	img := s.Image()
+	direct, indirect, light0 := s.AOV(tracer.AOVDirect), s.AOV(tracer.AOVIndirect), s.AOV(tracer.AOVLight(0))
+	object, material := s.AOV(tracer.AOVObject), s.AOV(tracer.AOVMaterial)
+	numDirect := 0
+	for iy := 0; iy < h; iy++ {
+		for ix := 0; ix < w; ix++ {
+			sum := direct[iy][ix].Add(indirect[iy][ix])
+			if d := math.Abs(sum.G - img[iy][ix].G); d > 1e-9 {
+				t.Fatalf("pixel %v,%v: direct + indirect = %v, want %v", ix, iy, sum, img[iy][ix])
+			}
+			if direct[iy][ix] != light0[iy][ix] {
+				t.Fatalf("pixel %v,%v: direct: %v, light0: %v: want equal (only one light)", ix, iy, direct[iy][ix], light0[iy][ix])
+			}
+			if direct[iy][ix].G > 0 {
+				numDirect++
+			}
+			// 6 objects + 1 light, 0 means nothing.
+			// IDs are not averaged, even at edges.
+			if id := object[iy][ix].R; id < 0 || id > 7 || id != math.Round(id) {
+				t.Fatalf("pixel %v,%v: object ID %v", ix, iy, id)
+			}
+			// all objects share the same material, the light has its own
+			if id := material[iy][ix].R; id < 0 || id > 2 || id != math.Round(id) {
+				t.Fatalf("pixel %v,%v: material ID %v", ix, iy, id)
+			}
+		}
+	}
+	if numDirect == 0 {
+		t.Errorf("no direct light recorded")
+	}
+}
+
+// Samples with a NaN color are left out of the AOVs, like out of the color.
+func TestSampler_AOV_NaN(t *testing.T) {
+	n := 0
+	f := func(ctx *tracer.Ctx, u, v float64) Color {
+		n++
+		if n%2 == 1 {
+			return Color{math.NaN(), 0, 0}
+		}
+		return Color{1, 1, 1}
+	}
+	s := tracer.NewSampler(f, 1, 1, false)
+	test.Check(t, s.EnableAOV(tracer.AOVIndirect))
+	s.Sample(4)
+	// 4 samples, of which 2 NaN
+	if got, want := s.AOV(tracer.AOVIndirect)[0][0], s.Image()[0][0]; got != want || got.IsNaN() {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Material IDs must be assigned in order of appearance when the Scene is constructed,
+// so that they are the same for every render.
+func TestScene_MaterialID(t *testing.T) {
+	a, b := materials.Matte(colorf.Red), materials.Flat(colorf.Blue)
+	s := NewScene(1, nil,
+		objects.Sphere(a, 1, O),
+		objects.And(objects.Sphere(b, 1, O), objects.Sphere(a, 1, Ex)),
+	)
+	for _, c := range []struct {
+		m    Material
+		want int
+	}{
+		{a, 1},
+		{b, 2},
+		{materials.Reflective(colorf.White), 0}, // not in the scene
+	} {
+		if got := s.MaterialID(c.m); got != c.want {
+			t.Errorf("MaterialID(%v): got %v, want %v", c.m, got, c.want)
+		}
+	}
+}
+
+// Statistics from all workers must be merged into the Sampler's Stats.
+func TestSampler_Stats(t *testing.T) {
+	f := cornelli().ImageFunc(
+		cameras.Projective(70 * Deg).Translate(Vec{.250, .250001, 0.97}),
+	)
+	const w, h, nPass = 32, 24, 3
+	s := tracer.NewSampler(f, w, h, false)
+	s.Sample(nPass)
+	s.Sample(nPass)
+
+	st := s.Stats()
+	if got, want := st.NumPixels, 2*w*h; got != want {
+		t.Errorf("NumPixels: got %v, want %v", got, want)
+	}
+	if got, want := st.NumSamples, 2*w*h*nPass; got != want {
+		t.Errorf("NumSamples: got %v, want %v", got, want)
+	}
+	if got, want := st.NumRaysByDepth[0], st.NumSamples; got != want {
+		t.Errorf("NumRaysByDepth[0]: got %v, want %v", got, want)
+	}
+	sum := 0
+	for _, n := range st.NumRaysByDepth {
+		sum += n
+	}
+	if sum != st.NumRays {
+		t.Errorf("NumRaysByDepth: sum %v, want NumRays=%v", sum, st.NumRays)
+	}
+	if st.NumRaysByDepth[1] == 0 || st.NumRaysByDepth[2] != 0 {
+		t.Errorf("NumRaysByDepth: got %v, want only depth 0 and 1 (recursion depth 2)", st.NumRaysByDepth)
+	}
+	if st.NumShadowRays == 0 {
+		t.Errorf("NumShadowRays: got 0")
+	}
+	if st.WallTime == 0 || st.RaysPerSecond() == 0 {
+		t.Errorf("WallTime: got %v, RaysPerSecond: got %v", st.WallTime, st.RaysPerSecond())
+	}
+	if got, want := s.SamplesPerPixel(), 2.*nPass; got != want {
+		t.Errorf("SamplesPerPixel: got %v, want %v", got, want)
+	}
+}
+
 func TestSampler_Cornell(t *testing.T) {
 	f := cornelli().ImageFunc(
 		cameras.Projective(70 * Deg).Translate(Vec{.250, .250001, 0.97}),
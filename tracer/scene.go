@@ -16,6 +16,8 @@ type Scene struct {
 	objectsAndLights   []Object
 	objectsMinusLights []Object
 	media              []Medium
+	lightTree          *lightTree          // see SetLightSelection
+	materialIDs        map[interface{}]int // see MaterialID
 	RecursionDepth     int
 }
 
@@ -36,6 +38,7 @@ func NewScene(recursionDepth int, lights []Light, objs ...Object) *Scene {
 		objects:            objs,
 		objectsAndLights:   objAndLights,
 		objectsMinusLights: objMinusLights,
+		materialIDs:        materialIDs(objAndLights),
 		RecursionDepth:     recursionDepth,
 	}
 }
@@ -87,19 +90,21 @@ func (s *Scene) lightField(who []Object, ctx *Ctx, r *Ray) Color {
 	if s.RecursionDepth == ctx.CurrentRecursionDepth {
 		return Color{} // reached maximum recursion depth
 	}
-	ctx.Stats.NumRays++
+	ctx.Stats.countRay(ctx.CurrentRecursionDepth)
 	ctx.CurrentRecursionDepth++ // enter recursive evaluation
 
-	front := intersectFrontmost(who, r)
+	front, idx := intersectFrontmost(who, r)
 	//if front.Material == nil { // TODO: this test should not be neccesary
 	//return Color{}
 	//}
 
-	brightness := front.Material.Shade(ctx, s, r, HitCoords{
+	h := HitCoords{
 		T:      front.T,
 		Normal: front.Normal.Normalized(), // Scale surface normal to unit length now that we are sure we are going to use it
 		Local:  front.Local,
-	})
+	}
+	ctx.recordFeatures(s, r, &front, idx, h)
+	brightness := front.Material.Shade(ctx, s, r, h)
 
 	for _, m := range s.media {
 		brightness = m.Filter(ctx, s, r, front.T, brightness)
@@ -117,7 +122,11 @@ func (s *Scene) ObjectsAndLights() []Object {
 	return s.objectsAndLights
 }
 
-func (s *Scene) Occlude(r *Ray, len float64, orig Color) Color {
+// Occlude returns the light intensity orig, as attenuated by the objects
+// (but not the lights) between the start of shadow ray r and distance len,
+// and by media that implement OccludingMedium.
+func (s *Scene) Occlude(ctx *Ctx, r *Ray, len float64, orig Color) Color {
+	ctx.Stats.NumShadowRays++
 	for _, o := range s.objects { // range over objects only, lights are considered transparent
 		f := o.Intersect(r)
 		if f.T > 0 && f.T < len {
@@ -128,27 +137,36 @@ func (s *Scene) Occlude(r *Ray, len float64, orig Color) Color {
 			}
 		}
 	}
+	for _, m := range s.media {
+		if m, ok := m.(OccludingMedium); ok {
+			orig = orig.Mul(m.Transmittance(ctx, r, len))
+		}
+	}
 	return orig
 }
 
 var blackMat Material = (*black)(nil)
 
+// intersectFrontmost returns the frontmost intersection of r with objs,
+// and the index of the object that was hit (-1 if none).
 // TODO: likewise for lights: per object: cache an occluding object for early return on shadows
-func intersectFrontmost(objs []Object, r *Ray) HitRecord {
+func intersectFrontmost(objs []Object, r *Ray) (HitRecord, int) {
 	front := HitRecord{T: math.Inf(1), Normal: r.Dir, Material: blackMat}
+	idx := -1
 	//if Check {
 	//	CheckRay(r)
 	//}
-	for _, o := range objs {
+	for i, o := range objs {
 		hit := o.Intersect(r)
 		//if Check {
 		//	CheckHit(o, r, &hit) // DEBUG
 		//}
 		if hit.T > 0 && hit.T <= front.T { // handles inf and NaN correctly
 			front = hit
+			idx = i
 		}
 	}
-	return front
+	return front, idx
 }
 
 // black wraps an object in a flat black material.
@@ -18,6 +18,17 @@ func UniformDisk(u, v float64) (x, y float64) {
 	return x, y
 }
 
+// UniformSphere maps a point (u,v) from the unit square to a unit vector,
+// preserving uniformity. I.e. the resulting vectors are uniformly distributed over all directions.
+//
+// This is used for isotropic scattering (e.g. in media.Interior).
+func UniformSphere(u, v float64) geom.Vec {
+	z := 1 - 2*u
+	r := math.Sqrt(math.Max(0, 1-z*z))
+	phi := (2 * math.Pi) * v
+	return geom.Vec{r * math.Cos(phi), r * math.Sin(phi), z}
+}
+
 // CosineSphere transforms a point (u,v) from the unit square to a vector
 // on the heimsphere around the given normal, cosine weighted.
 // I.e. the resulting vectors are distributed proportionally to the cosine of the angle with the normal,
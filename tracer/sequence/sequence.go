@@ -1,9 +1,6 @@
 package sequence
 
 import (
-	"math/rand"
-	"time"
-
 	"github.com/barnex/bruteray/geom"
 	"github.com/barnex/bruteray/util"
 )
@@ -13,18 +10,41 @@ type Sequence interface {
 	Generate2() (u, v float64)
 }
 
-func PseudoRandom() Sequence {
-	return (*pseudoRandom)(rand.New(rand.NewSource(time.Now().UnixNano())))
+// PseudoRandom returns a Sequence of pseudo-random numbers.
+// Unlike math/rand, the numbers only depend on seed and the pixel and pass
+// passed to Init. This keeps renders reproducible (e.g. when resuming from a checkpoint),
+// regardless of which goroutine evaluates which pixel.
+func PseudoRandom(seed uint64) Sequence {
+	return &pseudoRandom{seed: seed}
 }
 
-type pseudoRandom rand.Rand
+// pseudoRandom is a SplitMix64 generator
+// (http://prng.di.unimi.it/splitmix64.c).
+type pseudoRandom struct {
+	seed, state uint64
+}
 
 func (r *pseudoRandom) Init(pixel, pass int) {
+	r.state = r.seed
+	r.state = r.next() ^ uint64(pixel)
+	r.state = r.next() ^ uint64(pass)
 }
 
 func (r *pseudoRandom) Generate2() (u, v float64) {
-	rng := (*rand.Rand)(r)
-	return rng.Float64(), rng.Float64()
+	return r.float64(), r.float64()
+}
+
+func (r *pseudoRandom) next() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+	z := r.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// float64 returns a number in [0, 1).
+func (r *pseudoRandom) float64() float64 {
+	return float64(r.next()>>11) / (1 << 53)
 }
 
 type halton struct {
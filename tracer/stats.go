@@ -1,19 +1,67 @@
 package tracer
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
+// StatsMaxDepth is the number of recursion depths for which
+// rays are counted separately in Stats.NumRaysByDepth.
+// Rays at deeper recursion levels are all counted in the last element.
+const StatsMaxDepth = 8
+
+// Stats holds performance counters.
+// Each Ctx accumulates its own Stats (so that no locking is needed),
+// the Sampler merges them after each pass.
 type Stats struct {
-	NumPixels int // number of pixels evaluated
-	NumRays   int // number of rays evaluated
-	NumNaN    int // number of NaN colors encountered
-	WallTime  time.Duration
+	NumPixels      int                // number of pixels evaluated
+	NumSamples     int                // number of samples (pixel passes) evaluated
+	NumRays        int                // number of rays evaluated
+	NumShadowRays  int                // number of shadow rays evaluated (see Scene.Occlude)
+	NumNaN         int                // number of NaN colors encountered
+	NumRaysByDepth [StatsMaxDepth]int // number of rays evaluated at each recursion depth, starting from camera rays
+	WallTime       time.Duration
 }
 
+// Add adds all counters in b to s.
 func (s *Stats) Add(b *Stats) {
-	if b.WallTime != 0 {
-		panic("tracer.Stats.Add: non-zero walltime")
-	}
 	s.NumPixels += b.NumPixels
+	s.NumSamples += b.NumSamples
 	s.NumRays += b.NumRays
+	s.NumShadowRays += b.NumShadowRays
 	s.NumNaN += b.NumNaN
+	for i := range s.NumRaysByDepth {
+		s.NumRaysByDepth[i] += b.NumRaysByDepth[i]
+	}
+	s.WallTime += b.WallTime
+}
+
+// RaysPerSecond returns the number of rays (including shadow rays)
+// evaluated per second of wall time.
+func (s *Stats) RaysPerSecond() float64 {
+	t := s.WallTime.Seconds()
+	if t == 0 {
+		return 0
+	}
+	return float64(s.NumRays+s.NumShadowRays) / t
+}
+
+// countRay increments the ray counters for a ray at the given recursion depth.
+// depth counts from 0 (camera rays).
+func (s *Stats) countRay(depth int) {
+	s.NumRays++
+	if depth >= StatsMaxDepth {
+		depth = StatsMaxDepth - 1
+	}
+	s.NumRaysByDepth[depth]++
+}
+
+func (s Stats) String() string {
+	var byDepth []string
+	for _, n := range s.NumRaysByDepth {
+		byDepth = append(byDepth, fmt.Sprint(n))
+	}
+	return fmt.Sprintf("%v samples, %v rays (by depth: %v), %v shadow rays, %v NaNs, %.3g rays/s",
+		s.NumSamples, s.NumRays, strings.Join(byDepth, " "), s.NumShadowRays, s.NumNaN, s.RaysPerSecond())
 }
@@ -0,0 +1,39 @@
+package test
+
+import (
+	"github.com/barnex/bruteray/imagef/colorf"
+	"github.com/barnex/bruteray/tracer"
+	"github.com/barnex/bruteray/tracer/cameras"
+	. "github.com/barnex/bruteray/tracer/types"
+)
+
+// WhiteFurnace performs a "white furnace test": it renders a sphere with material m,
+// surrounded by a uniformly white, luminous environment (without light sources),
+// and returns the average brightness of the sphere after nPass passes.
+//
+// Under uniform illumination, a white material that conserves energy
+// is exactly as bright as its environment, i.e., the result is 1.
+// Materials that absorb light are darker,
+// but no physically plausible material is brighter than 1.
+func WhiteFurnace(m Material, nPass int) Color {
+	const size = 16
+	scene := NewScene(
+		4,
+		[]Light{},
+		Sphere(m, 1, O),
+		Sphere(Flat(colorf.White), 100, O),
+	)
+	// The narrow field of view ensures that all pixels see the sphere,
+	// including (nearly) grazing incidence near the corners.
+	cam := cameras.Projective(13*Deg).Translate(Vec{0, 0, 3})
+	s := tracer.NewSampler(scene.ImageFunc(cam), size, size, true)
+	s.Sample(nPass)
+
+	var avg Color
+	for _, row := range s.Image() {
+		for _, c := range row {
+			avg = avg.Add(c)
+		}
+	}
+	return avg.Mul(1. / (size * size))
+}
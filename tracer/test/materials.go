@@ -119,7 +119,7 @@ func (m matte) Shade(ctx *Ctx, s *Scene, r *Ray, h HitCoords) Color {
 		}
 		lDist := lDelta.Len()
 		secundary.Dir = lDir
-		intens = s.Occlude(secundary, lDist, intens)
+		intens = s.Occlude(ctx, secundary, lDist, intens)
 		acc = acc.Add(intens.Mul(cosTheta))
 	}
 	acc = acc.Mul(0.6).Add(Color{0.4, 0.4, 0.4})
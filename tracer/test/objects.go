@@ -28,6 +28,11 @@ func (s *sheet) Intersect(r *Ray) HitRecord {
 	return HitRecord{T: t, Normal: Vec{0, 1, 0}, Material: s.mat, Local: Vec{p[0], p[2], 0}}
 }
 
+// Materials implements tracer.MaterialObject.
+func (s *sheet) Materials() []Material {
+	return []Material{s.mat}
+}
+
 // Sphere returns a minimal implementation of a sphere.
 // Intended for tests that should not depend on package objects/
 func Sphere(m Material, diam float64, origin geom.Vec) Object {
@@ -68,6 +73,11 @@ func (s *sphere) Intersect(r *Ray) HitRecord {
 	return HitRecord{}
 }
 
+// Materials implements tracer.MaterialObject.
+func (s *sphere) Materials() []Material {
+	return []Material{s.mat}
+}
+
 type pointLight struct {
 	origin Vec
 	sphere sphere
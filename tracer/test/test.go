@@ -37,7 +37,13 @@ const (
 
 func Compare(t testing.TB, tolerance float64, img image.Image) {
 	t.Helper()
-	fname := TestName() + ".png"
+	compareTo(t, TestName(), tolerance, img)
+}
+
+// compareTo is like Compare, but uses the golden image with the given name (see TestName).
+func compareTo(t testing.TB, name string, tolerance float64, img image.Image) {
+	t.Helper()
+	fname := name + ".png"
 	got := path.Join(Testdata(), "got", fname)
 	want := path.Join(Testdata(), fname)
 	Save(t, img, got)
@@ -86,6 +92,15 @@ func QuadViewN(t *testing.T, s *Scene, c Camera, fov float64, nPass int, toleran
 }
 
 func Benchmark(b *testing.B, s *Scene, c Camera, tolerance float64) {
+	b.Helper()
+	BenchmarkGolden(b, TestName(), s, c, tolerance)
+}
+
+// BenchmarkGolden is like Benchmark, but compares the result to the golden image
+// with the given name (see TestName). E.g.:
+// 	test.BenchmarkGolden(b, "objects.benchmarktree1000", ...)
+// Intended for variants of a benchmark that must render the same image.
+func BenchmarkGolden(b *testing.B, golden string, s *Scene, c Camera, tolerance float64) {
 	b.Helper()
 	width := DefaultWidth
 	height := DefaultHeight
@@ -100,7 +115,7 @@ func Benchmark(b *testing.B, s *Scene, c Camera, tolerance float64) {
 	}
 	b.StopTimer()
 	//_ = img
-	Compare(b, tolerance, img)
+	compareTo(b, golden, tolerance, img)
 }
 
 func renderNPass(s *Scene, c Camera, numPass, width, height int) imagef.Image {
@@ -219,6 +234,9 @@ func TestName() string {
 		if !(strings.HasPrefix(noPkg, "Test") || strings.HasPrefix(noPkg, "Benchmark")) {
 			continue
 		}
+		if caller == "test.Benchmark" { // our own helper, not the caller's benchmark
+			continue
+		}
 		name := strings.Replace(caller, "_test", "", 1)
 		name = strings.Replace(name, "Test", "", 1)
 		name = strings.ToLower(name)
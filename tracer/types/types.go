@@ -10,6 +10,7 @@ import (
 	"github.com/barnex/bruteray/tracer"
 )
 
+type BSDF = tracer.BSDF
 type Camera = tracer.Camera
 type Color = colorf.Color
 type Ctx = tracer.Ctx
@@ -17,10 +18,15 @@ type HitCoords = tracer.HitCoords
 type HitRecord = tracer.HitRecord
 type Image = imagef.Image
 type ImageFunc = tracer.ImageFunc
+type ImportanceLight = tracer.ImportanceLight
 type Light = tracer.Light
+type LightBounds = tracer.LightBounds
 type Material = tracer.Material
+type MaterialObject = tracer.MaterialObject
 type Medium = tracer.Medium
 type Object = tracer.Object
+type OccludingMedium = tracer.OccludingMedium
+type PDFLight = tracer.PDFLight
 type Ray = tracer.Ray
 type Scene = tracer.Scene
 type Vec = geom.Vec
@@ -35,6 +41,7 @@ var (
 	NewScene          = tracer.NewScene
 	NewSceneWithMedia = tracer.NewSceneWithMedia
 	MakeImage         = imagef.MakeImage
+	MaterialsOf       = tracer.MaterialsOf
 )
 
 const (